@@ -82,17 +82,38 @@ func NewConfig() *Config {
 }
 
 func NewConfigFromFile(paths []string) *Config {
+	config, err := LoadConfigFromFile(paths)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	return config
+}
+
+// LoadConfigFromFile is the same as NewConfigFromFile, but returns an error instead of exit.
+// It is used to reload the config of running file.d.
+func LoadConfigFromFile(paths []string) (*Config, error) {
+	return loadConfigFromFile(paths, true)
+}
+
+// LoadConfigFromFileOffline is the same as LoadConfigFromFile, but it doesn't connect to the vault,
+// so the vault secrets are left as is. It is used to check the config.
+func LoadConfigFromFileOffline(paths []string) (*Config, error) {
+	return loadConfigFromFile(paths, false)
+}
+
+func loadConfigFromFile(paths []string, useVault bool) (*Config, error) {
 	mergedConfig := make(map[interface{}]interface{})
 
 	for _, path := range paths {
 		logger.Infof("reading config %q", path)
 		yamlContents, err := os.ReadFile(path)
 		if err != nil {
-			logger.Fatalf("can't read config file %q: %s", path, err)
+			return nil, fmt.Errorf("can't read config file %q: %w", path, err)
 		}
 		var currentConfig map[interface{}]interface{}
 		if err := yaml.Unmarshal(yamlContents, &currentConfig); err != nil {
-			logger.Fatalf("can't parse config file yaml %q: %s", path, err)
+			return nil, fmt.Errorf("can't parse config file yaml %q: %w", path, err)
 		}
 
 		mergedConfig = mergeYAMLs(mergedConfig, currentConfig)
@@ -100,40 +121,45 @@ func NewConfigFromFile(paths []string) *Config {
 
 	mergedYAML, err := yaml.Marshal(mergedConfig)
 	if err != nil {
-		logger.Fatalf("can't marshal merged config to YAML: %s", err)
+		return nil, fmt.Errorf("can't marshal merged config to YAML: %w", err)
 	}
 
 	jsonContents, err := k8s_yaml.YAMLToJSON(mergedYAML)
 	if err != nil {
 		logger.Infof("config content:\n%s", logger.Numerate(string(mergedYAML)))
-		logger.Fatalf("can't parse config file yaml %q: %s", paths, err.Error())
+		return nil, fmt.Errorf("can't parse config file yaml %q: %w", paths, err)
 	}
 
 	object, err := simplejson.NewJson(jsonContents)
 	if err != nil {
-		logger.Fatalf("can't convert config to json %q: %s", paths, err.Error())
+		return nil, fmt.Errorf("can't convert config to json %q: %w", paths, err)
 	}
 
 	err = applyEnvs(object)
 	if err != nil {
-		logger.Fatalf("can't get config values from environments: %s", err.Error())
+		return nil, fmt.Errorf("can't get config values from environments: %w", err)
 	}
 
-	config := parseConfig(object)
+	config, err := parseConfig(object)
+	if err != nil {
+		return nil, err
+	}
 
 	// if vault is used then set value otherwise it is empty variable
 	vault := &vault{}
-	if config.Vault.ShouldUse {
+	if config.Vault.ShouldUse && useVault {
 		vault, err = newVault(config.Vault.Address, config.Vault.Token)
 		if err != nil {
-			logger.Fatalf("can't create vault client: %s", err.Error())
+			return nil, fmt.Errorf("can't create vault client: %w", err)
 		}
 	}
 
 	// add applicators
 	apps := []funcApplier{
 		&envs{},
-		vault,
+	}
+	if useVault {
+		apps = append(apps, vault)
 	}
 
 	for _, p := range config.Pipelines {
@@ -142,7 +168,7 @@ func NewConfigFromFile(paths []string) *Config {
 
 	logger.Infof("config parsed, found %d pipelines", len(config.Pipelines))
 
-	return config
+	return config, nil
 }
 
 func applyEnvs(object *simplejson.Json) error {
@@ -163,7 +189,7 @@ func applyEnvs(object *simplejson.Json) error {
 	return nil
 }
 
-func parseConfig(object *simplejson.Json) *Config {
+func parseConfig(object *simplejson.Json) (*Config, error) {
 	config := NewConfig()
 	vault := object.Get("vault")
 	var err error
@@ -172,7 +198,7 @@ func parseConfig(object *simplejson.Json) *Config {
 	if addr.Interface() != nil {
 		config.Vault.Address, err = addr.String()
 		if err != nil {
-			logger.Panicf("can't parse vault address: %s", err.Error())
+			return nil, fmt.Errorf("can't parse vault address: %w", err)
 		}
 	}
 
@@ -180,7 +206,7 @@ func parseConfig(object *simplejson.Json) *Config {
 	if token.Interface() != nil {
 		config.Vault.Token, err = token.String()
 		if err != nil {
-			logger.Panicf("can't parse vault token: %s", err.Error())
+			return nil, fmt.Errorf("can't parse vault token: %w", err)
 		}
 	}
 	config.Vault.ShouldUse = config.Vault.Address != "" && config.Vault.Token != ""
@@ -188,17 +214,17 @@ func parseConfig(object *simplejson.Json) *Config {
 	pipelinesJson := object.Get("pipelines")
 	pipelines := pipelinesJson.MustMap()
 	if len(pipelines) == 0 {
-		logger.Fatalf("no pipelines defined in config")
+		return nil, errors.New("no pipelines defined in config")
 	}
 	for name := range pipelines {
 		if err := validatePipelineName(name); err != nil {
-			logger.Fatal(err)
+			return nil, err
 		}
 		raw := pipelinesJson.Get(name)
 		config.Pipelines[name] = &PipelineConfig{Raw: raw}
 	}
 
-	return config
+	return config, nil
 }
 
 func validatePipelineName(name string) error {
@@ -1,6 +1,10 @@
 package cfg
 
-import "go.uber.org/zap"
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+)
 
 func isGroupsUnique(groups []int) bool {
 	uniqueGrp := make(map[int]struct{}, len(groups))
@@ -14,6 +18,26 @@ func isGroupsUnique(groups []int) bool {
 	return true
 }
 
+// CheckGroupNumbers is the same as VerifyGroupNumbers, but returns the error instead of the fatal.
+func CheckGroupNumbers(groups []int, totalGroups int) ([]int, error) {
+	if !isGroupsUnique(groups) {
+		return nil, fmt.Errorf("groups numbers must be unique: %v", groups)
+	}
+
+	if len(groups) > totalGroups {
+		return nil, fmt.Errorf("there are many groups: %d, total groups: %d", len(groups), totalGroups)
+	}
+
+	for _, g := range groups {
+		if g > totalGroups || g < 0 {
+			return nil, fmt.Errorf("wrong group number: %d", g)
+		} else if g == 0 {
+			return []int{0}, nil
+		}
+	}
+	return groups, nil
+}
+
 func VerifyGroupNumbers(groups []int, totalGroups int, logger *zap.Logger) []int {
 	if !isGroupsUnique(groups) {
 		logger.Fatal("groups numbers must be unique", zap.Ints("groups_numbers", groups))
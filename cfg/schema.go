@@ -0,0 +1,123 @@
+package cfg
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	expressionType  = reflect.TypeOf(Expression(""))
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// JSONSchema returns the JSON Schema of the plugin config built from the tags that Parse and SetDefaultValues interpret:
+// `json` is the property name, `default`, `options` and `required` are the default value, the enum and the required properties.
+// The unknown properties aren't allowed, since the config is decoded with the unknown fields disallowed.
+func JSONSchema(config any) map[string]any {
+	return typeSchema(reflect.TypeOf(config), make(map[reflect.Type]bool))
+}
+
+func typeSchema(t reflect.Type, visited map[reflect.Type]bool) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == expressionType:
+		return map[string]any{"type": []string{"string", "integer"}}
+	case reflect.PointerTo(t).Implements(unmarshalerType):
+		// the format is defined by the code, so any value is allowed
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{
+			"type":  "array",
+			"items": typeSchema(t.Elem(), visited),
+		}
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem(), visited),
+		}
+	case reflect.Struct:
+		return structSchema(t, visited)
+	default:
+		return map[string]any{}
+	}
+}
+
+func structSchema(t reflect.Type, visited map[reflect.Type]bool) map[string]any {
+	// recursive types are cut
+	if visited[t] {
+		return map[string]any{"type": "object"}
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	properties := make(map[string]any)
+	required := make([]string, 0)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		// the fields without the json tag are filled by Parse
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+
+		schema := typeSchema(field.Type, visited)
+		if options := field.Tag.Get("options"); options != "" {
+			schema["enum"] = strings.Split(options, "|")
+		}
+		if value, ok := defaultValue(field.Type, field.Tag.Get("default")); ok {
+			schema["default"] = value
+		}
+		if field.Tag.Get("required") == trueValue {
+			required = append(required, name)
+		}
+		properties[name] = schema
+	}
+
+	schema := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// defaultValue converts the `default` tag the same way as SetDefaultValues does.
+func defaultValue(t reflect.Type, value string) (any, bool) {
+	if value == "" {
+		return nil, false
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return value == trueValue, true
+	case reflect.Int:
+		i, err := strconv.Atoi(value)
+		return i, err == nil
+	case reflect.String:
+		return value, true
+	case reflect.Slice:
+		return strings.Fields(value), true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,56 @@
+package cfg
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type schemaChild struct {
+	Name string `json:"name" required:"true"`
+}
+
+type schemaConfig struct {
+	Mode      string `json:"mode" default:"async" options:"async|sync"`
+	Mode_     PersistenceMode
+	Field     FieldSelector `json:"field" parse:"selector" required:"true"`
+	Field_    []string
+	Workers   Expression        `json:"workers" default:"gomaxprocs*4"`
+	Enabled   bool              `json:"enabled" default:"true"`
+	Retry     int               `json:"retry" default:"3"`
+	Labels    []string          `json:"labels" default:"a b"`
+	Meta      map[string]string `json:"meta"`
+	Children  []schemaChild     `json:"children"`
+	Any       any               `json:"any"`
+	OmitEmpty *int              `json:"omit_empty,omitempty"`
+	Skipped   string            `json:"-"`
+}
+
+func TestJSONSchema(t *testing.T) {
+	schema, err := json.Marshal(JSONSchema(&schemaConfig{}))
+	require.NoError(t, err)
+
+	require.JSONEq(t, `{
+		"type": "object",
+		"additionalProperties": false,
+		"required": ["field"],
+		"properties": {
+			"mode": {"type": "string", "enum": ["async", "sync"], "default": "async"},
+			"field": {"type": "string"},
+			"workers": {"type": ["string", "integer"], "default": "gomaxprocs*4"},
+			"enabled": {"type": "boolean", "default": true},
+			"retry": {"type": "integer", "default": 3},
+			"labels": {"type": "array", "items": {"type": "string"}, "default": ["a", "b"]},
+			"meta": {"type": "object", "additionalProperties": {"type": "string"}},
+			"children": {"type": "array", "items": {
+				"type": "object",
+				"additionalProperties": false,
+				"required": ["name"],
+				"properties": {"name": {"type": "string"}}
+			}},
+			"any": {},
+			"omit_empty": {"type": "integer"}
+		}
+	}`, string(schema))
+}
@@ -2,13 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"math"
 	"os"
 	"os/signal"
 	"runtime/debug"
 	"strconv"
 	"syscall"
-	"time"
 
 	"github.com/KimMachineGun/automemlimit/memlimit"
 	"github.com/alecthomas/kingpin"
@@ -19,13 +19,16 @@ import (
 	"github.com/ozontech/file.d/pipeline"
 	_ "github.com/ozontech/file.d/plugin/action/add_file_name"
 	_ "github.com/ozontech/file.d/plugin/action/add_host"
+	_ "github.com/ozontech/file.d/plugin/action/aggregate"
 	_ "github.com/ozontech/file.d/plugin/action/cardinality"
 	_ "github.com/ozontech/file.d/plugin/action/convert_date"
 	_ "github.com/ozontech/file.d/plugin/action/convert_log_level"
 	_ "github.com/ozontech/file.d/plugin/action/convert_utf8_bytes"
 	_ "github.com/ozontech/file.d/plugin/action/debug"
 	_ "github.com/ozontech/file.d/plugin/action/decode"
+	_ "github.com/ozontech/file.d/plugin/action/dedup"
 	_ "github.com/ozontech/file.d/plugin/action/discard"
+	_ "github.com/ozontech/file.d/plugin/action/exec"
 	_ "github.com/ozontech/file.d/plugin/action/flatten"
 	_ "github.com/ozontech/file.d/plugin/action/hash"
 	_ "github.com/ozontech/file.d/plugin/action/join"
@@ -34,6 +37,7 @@ import (
 	_ "github.com/ozontech/file.d/plugin/action/json_encode"
 	_ "github.com/ozontech/file.d/plugin/action/json_extract"
 	_ "github.com/ozontech/file.d/plugin/action/keep_fields"
+	_ "github.com/ozontech/file.d/plugin/action/logs_to_metrics"
 	_ "github.com/ozontech/file.d/plugin/action/mask"
 	_ "github.com/ozontech/file.d/plugin/action/modify"
 	_ "github.com/ozontech/file.d/plugin/action/move"
@@ -41,6 +45,7 @@ import (
 	_ "github.com/ozontech/file.d/plugin/action/parse_re2"
 	_ "github.com/ozontech/file.d/plugin/action/remove_fields"
 	_ "github.com/ozontech/file.d/plugin/action/rename"
+	_ "github.com/ozontech/file.d/plugin/action/sample"
 	_ "github.com/ozontech/file.d/plugin/action/set_time"
 	_ "github.com/ozontech/file.d/plugin/action/split"
 	_ "github.com/ozontech/file.d/plugin/action/throttle"
@@ -51,7 +56,9 @@ import (
 	_ "github.com/ozontech/file.d/plugin/input/journalctl"
 	_ "github.com/ozontech/file.d/plugin/input/k8s"
 	_ "github.com/ozontech/file.d/plugin/input/kafka"
+	_ "github.com/ozontech/file.d/plugin/input/pipeline"
 	_ "github.com/ozontech/file.d/plugin/input/socket"
+	_ "github.com/ozontech/file.d/plugin/input/syslog"
 	_ "github.com/ozontech/file.d/plugin/output/clickhouse"
 	_ "github.com/ozontech/file.d/plugin/output/devnull"
 	_ "github.com/ozontech/file.d/plugin/output/elasticsearch"
@@ -60,6 +67,7 @@ import (
 	_ "github.com/ozontech/file.d/plugin/output/http"
 	_ "github.com/ozontech/file.d/plugin/output/kafka"
 	_ "github.com/ozontech/file.d/plugin/output/loki"
+	_ "github.com/ozontech/file.d/plugin/output/pipeline"
 	_ "github.com/ozontech/file.d/plugin/output/postgres"
 	_ "github.com/ozontech/file.d/plugin/output/s3"
 	_ "github.com/ozontech/file.d/plugin/output/socket"
@@ -80,6 +88,43 @@ var (
 		`Value to set GOMEMLIMIT (https://pkg.go.dev/runtime) with the value from the cgroup's memory limit and given ratio. `+
 			`If there is a need to reduce the load GC, it is recommended to set 0.9. Default is disabled`,
 	).Default("0").Float64()
+	shutdownTimeout = kingpin.Flag(
+		"shutdown-timeout",
+		`How long to wait on SIGTERM or SIGINT for the events in-flight to be committed by the outputs before stopping. `+
+			`The events which aren't committed in time will be processed again after restart`,
+	).Default("30s").Duration()
+	checkConfig = kingpin.Flag(
+		"check-config",
+		`Check the config and exit with the non-zero code if it's invalid. All the errors are reported with their paths. `+
+			`No files, sockets or connections are opened, the vault secrets aren't resolved. `+
+			`The plugin configs are checked as they are parsed, so the errors which happen only on the plugin start, `+
+			`e.g. unreachable hosts or missing files, aren't reported`,
+	).Bool()
+	_ = kingpin.Flag(
+		"json-schema",
+		`Print the JSON Schema of the config with all the plugins and exit`,
+	).PreAction(printJSONSchema).Bool()
+	replay = kingpin.Flag(
+		"replay",
+		`Replay the dead queue events into the pipeline with the given name. `+
+			`Only this pipeline is started, its input is replaced with --replay-input`,
+	).String()
+	replayInput = kingpin.Flag(
+		"replay-input",
+		`JSON config of the input reading the dead queue file or topic, e.g. '{"type":"kafka","brokers":["kafka:9092"],"topics":["dead"]}'`,
+	).String()
+	replayAnnotationField = kingpin.Flag(
+		"replay-annotation-field",
+		`Field with the dead queue annotations to remove from the replayed events`,
+	).String()
+	replayDoIf = kingpin.Flag(
+		"replay-do-if",
+		`JSON of the do_if selecting the events to replay, it can use the annotations`,
+	).String()
+	replayRate = kingpin.Flag(
+		"replay-rate",
+		`Max number of the replayed events per second, 0 is unlimited`,
+	).Default("0").Int()
 	disableFieldsCaching = kingpin.Flag("disable-fields-caching", "Disable field caching when accessing fields. "+
 		"Disabling can reduce memory consumption and CPU, but can increase CPU consumption if you frequently access fields (for example, you have many actions)").
 		Default("false").
@@ -90,6 +135,10 @@ func main() {
 	kingpin.Version(buildinfo.Version)
 	kingpin.Parse()
 
+	if *checkConfig {
+		os.Exit(runCheckConfig())
+	}
+
 	logger.Infof("Hi! I'm file.d version=%s", buildinfo.Version)
 
 	setRuntimeSettings()
@@ -112,11 +161,85 @@ func main() {
 
 func start() {
 	appCfg := cfg.NewConfigFromFile(*config)
+	if err := applyReplay(appCfg); err != nil {
+		logger.Fatalf("can't replay: %s", err.Error())
+	}
 
 	fileD = fd.New(appCfg, *http)
 	fileD.Start()
 }
 
+// runCheckConfig checks the config without starting file.d and returns the exit code.
+func runCheckConfig() int {
+	appCfg, err := cfg.LoadConfigFromFileOffline(*config)
+	if err != nil {
+		logger.Errorf("config is invalid: %s", err.Error())
+		return 1
+	}
+	if err := applyReplay(appCfg); err != nil {
+		logger.Errorf("config is invalid: %s", err.Error())
+		return 1
+	}
+
+	errs := fd.CheckConfig(appCfg, fd.DefaultPluginRegistry)
+	for _, err := range errs {
+		logger.Errorf("config is invalid: %s", err.Error())
+	}
+	if len(errs) > 0 {
+		logger.Errorf("config check failed: %d errors found", len(errs))
+		return 1
+	}
+
+	logger.Infof("config is valid")
+	return 0
+}
+
+// applyReplay changes the config to replay the dead queue if the --replay flag is set.
+func applyReplay(appCfg *cfg.Config) error {
+	if *replay == "" {
+		return nil
+	}
+
+	return fd.ApplyReplay(appCfg, &fd.ReplayOptions{
+		Pipeline:        *replay,
+		Input:           *replayInput,
+		AnnotationField: *replayAnnotationField,
+		DoIf:            *replayDoIf,
+		Rate:            *replayRate,
+	})
+}
+
+func printJSONSchema(_ *kingpin.ParseContext) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(fd.DefaultPluginRegistry.JSONSchema()); err != nil {
+		logger.Fatalf("can't print schema: %s", err.Error())
+	}
+	os.Exit(0)
+	return nil
+}
+
+// reload applies the changed config, the running pipelines with the same config aren't restarted.
+// The previous config keeps working if the new one can't be applied.
+func reload() {
+	appCfg, err := cfg.LoadConfigFromFile(*config)
+	if err != nil {
+		logger.Errorf("can't reload config, the previous one is kept: %s", err.Error())
+		return
+	}
+	if err := applyReplay(appCfg); err != nil {
+		logger.Errorf("can't reload config, the previous one is kept: %s", err.Error())
+		return
+	}
+
+	err = fileD.Reload(appCfg)
+	if err != nil {
+		logger.Errorf("can't reload config, the previous one is kept: %s", err.Error())
+		return
+	}
+	logger.Infof("config reloaded")
+}
+
 func listenSignals() {
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
@@ -128,18 +251,11 @@ func listenSignals() {
 		case syscall.SIGHUP:
 			logger.Infof("SIGHUP received")
 
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-			err := fileD.Stop(ctx)
-			if err != nil {
-				logger.Fatalf("can't stop file.d with SIGHUP: %s", err.Error())
-			}
-			cancel()
-
-			start()
+			reload()
 		case syscall.SIGINT, syscall.SIGTERM:
 			logger.Infof("SIGTERM or SIGINT received")
 
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
 			err := fileD.Stop(ctx)
 			if err != nil {
 				logger.Fatalf("can't stop file.d with SIGTERM or SIGINT: %s", err.Error())
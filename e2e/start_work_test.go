@@ -25,13 +25,16 @@ import (
 	"github.com/ozontech/file.d/fd"
 	_ "github.com/ozontech/file.d/plugin/action/add_file_name"
 	_ "github.com/ozontech/file.d/plugin/action/add_host"
+	_ "github.com/ozontech/file.d/plugin/action/aggregate"
 	_ "github.com/ozontech/file.d/plugin/action/cardinality"
 	_ "github.com/ozontech/file.d/plugin/action/convert_date"
 	_ "github.com/ozontech/file.d/plugin/action/convert_log_level"
 	_ "github.com/ozontech/file.d/plugin/action/convert_utf8_bytes"
 	_ "github.com/ozontech/file.d/plugin/action/debug"
 	_ "github.com/ozontech/file.d/plugin/action/decode"
+	_ "github.com/ozontech/file.d/plugin/action/dedup"
 	_ "github.com/ozontech/file.d/plugin/action/discard"
+	_ "github.com/ozontech/file.d/plugin/action/exec"
 	_ "github.com/ozontech/file.d/plugin/action/flatten"
 	_ "github.com/ozontech/file.d/plugin/action/hash"
 	_ "github.com/ozontech/file.d/plugin/action/join"
@@ -40,6 +43,7 @@ import (
 	_ "github.com/ozontech/file.d/plugin/action/json_encode"
 	_ "github.com/ozontech/file.d/plugin/action/json_extract"
 	_ "github.com/ozontech/file.d/plugin/action/keep_fields"
+	_ "github.com/ozontech/file.d/plugin/action/logs_to_metrics"
 	_ "github.com/ozontech/file.d/plugin/action/mask"
 	_ "github.com/ozontech/file.d/plugin/action/modify"
 	_ "github.com/ozontech/file.d/plugin/action/move"
@@ -47,6 +51,7 @@ import (
 	_ "github.com/ozontech/file.d/plugin/action/parse_re2"
 	_ "github.com/ozontech/file.d/plugin/action/remove_fields"
 	_ "github.com/ozontech/file.d/plugin/action/rename"
+	_ "github.com/ozontech/file.d/plugin/action/sample"
 	_ "github.com/ozontech/file.d/plugin/action/set_time"
 	_ "github.com/ozontech/file.d/plugin/action/split"
 	_ "github.com/ozontech/file.d/plugin/action/throttle"
@@ -57,7 +62,9 @@ import (
 	_ "github.com/ozontech/file.d/plugin/input/journalctl"
 	_ "github.com/ozontech/file.d/plugin/input/k8s"
 	_ "github.com/ozontech/file.d/plugin/input/kafka"
+	_ "github.com/ozontech/file.d/plugin/input/pipeline"
 	_ "github.com/ozontech/file.d/plugin/input/socket"
+	_ "github.com/ozontech/file.d/plugin/input/syslog"
 	_ "github.com/ozontech/file.d/plugin/output/clickhouse"
 	_ "github.com/ozontech/file.d/plugin/output/devnull"
 	_ "github.com/ozontech/file.d/plugin/output/elasticsearch"
@@ -66,6 +73,7 @@ import (
 	_ "github.com/ozontech/file.d/plugin/output/http"
 	_ "github.com/ozontech/file.d/plugin/output/kafka"
 	_ "github.com/ozontech/file.d/plugin/output/loki"
+	_ "github.com/ozontech/file.d/plugin/output/pipeline"
 	_ "github.com/ozontech/file.d/plugin/output/postgres"
 	_ "github.com/ozontech/file.d/plugin/output/s3"
 	_ "github.com/ozontech/file.d/plugin/output/socket"
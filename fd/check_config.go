@@ -0,0 +1,204 @@
+package fd
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/decoder"
+	"github.com/ozontech/file.d/pipeline"
+)
+
+// ConfigError is the error of the config value at the path, e.g. `pipelines.k8s.actions[2].do_if`.
+type ConfigError struct {
+	Path string
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// CheckConfig checks the pipelines of the config the same way as they are checked on creation,
+// but the pipelines aren't created, so no files, sockets or connections are opened.
+// It returns all the errors found instead of stopping at the first one.
+func CheckConfig(config *cfg.Config, plugins *PluginRegistry) []error {
+	names := make([]string, 0, len(config.Pipelines))
+	for name := range config.Pipelines {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	checker := &configChecker{plugins: plugins}
+	for _, name := range names {
+		// the checks modify the raw config, so the copy is checked
+		raw, err := simplejson.NewJson(encodePipelineConfig(name, config.Pipelines[name]))
+		if err != nil {
+			checker.addError("pipelines."+name, err)
+			continue
+		}
+		checker.pipelineName = name
+		checker.checkPipeline("pipelines."+name, raw)
+	}
+
+	return checker.errs
+}
+
+type configChecker struct {
+	plugins *PluginRegistry
+	errs    []error
+	// pipelineName is the name of the checked pipeline.
+	pipelineName string
+}
+
+func (c *configChecker) addError(path string, err error) {
+	// the settings errors are joined, so every one of them is reported
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			c.addError(path, err)
+		}
+		return
+	}
+	c.errs = append(c.errs, &ConfigError{Path: path, Err: err})
+}
+
+func (c *configChecker) checkPipeline(path string, raw *simplejson.Json) {
+	settings, err := extractPipelineParams(raw.Get("settings"))
+	if err != nil {
+		c.addError(path+".settings", err)
+	}
+	if decoder.TypeFromString(settings.Decoder) == decoder.NO {
+		c.addError(path+".settings.decoder", fmt.Errorf("unknown decoder %q", settings.Decoder))
+	}
+
+	values := map[string]int{
+		"capacity":   settings.Capacity,
+		"gomaxprocs": runtime.GOMAXPROCS(0),
+	}
+
+	c.checkPlugin(path+"."+string(pipeline.PluginKindInput), pipeline.PluginKindInput, raw.Get(string(pipeline.PluginKindInput)), values)
+
+	actions := raw.Get("actions")
+	for i := range actions.MustArray() {
+		c.checkAction(fmt.Sprintf("%s.actions[%d]", path, i), actions.GetIndex(i), values)
+	}
+
+	c.checkOutputs(path+"."+string(pipeline.PluginKindOutput), raw.Get(string(pipeline.PluginKindOutput)), values)
+}
+
+func (c *configChecker) checkAction(path string, actionJSON *simplejson.Json, values map[string]int) {
+	if actionJSON.MustMap() == nil {
+		c.addError(path, errors.New("empty action"))
+		return
+	}
+
+	t := actionJSON.Get("type").MustString()
+	if t == "" {
+		c.addError(path, errors.New("action doesn't provide type"))
+		return
+	}
+	info, err := c.plugins.GetActionByType(t)
+	if err != nil {
+		c.addError(path, err)
+	}
+
+	if _, err := extractDoIfChecker(actionJSON.Get("do_if")); err != nil {
+		c.addError(path+".do_if", err)
+	}
+	if extractMatchMode(actionJSON) == pipeline.MatchModeUnknown {
+		c.addError(path+".match_mode", errors.New("unknown match_mode value"))
+	}
+	if _, err := extractConditions(actionJSON.Get("match_fields")); err != nil {
+		c.addError(path+".match_fields", err)
+	}
+
+	if info != nil {
+		c.checkPluginConfig(path, info, makeActionJSON(actionJSON), values)
+	}
+}
+
+func (c *configChecker) checkOutputs(path string, outputsJSON *simplejson.Json, values map[string]int) {
+	outputs := outputsJSON.MustArray()
+	if outputs == nil {
+		c.checkPlugin(path, pipeline.PluginKindOutput, outputsJSON, values)
+		return
+	}
+
+	if len(outputs) == 0 {
+		c.addError(path, fmt.Errorf("empty %s list", pipeline.PluginKindOutput))
+	}
+	if len(outputs) > pipeline.MaxOutputRoutes {
+		c.addError(path, fmt.Errorf("too many outputs: %d, max count is %d", len(outputs), pipeline.MaxOutputRoutes))
+	}
+
+	for i := range outputs {
+		outputPath := fmt.Sprintf("%s[%d]", path, i)
+		outputJSON := outputsJSON.GetIndex(i)
+
+		doIfChecker, err := extractDoIfChecker(outputJSON.Get("do_if"))
+		if err != nil {
+			c.addError(outputPath+".do_if", err)
+		}
+		if outputJSON.Get("default").MustBool() && doIfChecker != nil {
+			c.addError(outputPath, fmt.Errorf(`default %s can't have "do_if" conditions`, pipeline.PluginKindOutput))
+		}
+		outputJSON.Del("do_if")
+		outputJSON.Del("default")
+
+		c.checkPlugin(outputPath, pipeline.PluginKindOutput, outputJSON, values)
+	}
+}
+
+func (c *configChecker) checkPlugin(path string, pluginKind pipeline.PluginKind, configJSON *simplejson.Json, values map[string]int) {
+	if configJSON.MustMap() == nil {
+		c.addError(path, fmt.Errorf("no %s plugin provided", pluginKind))
+		return
+	}
+
+	t := configJSON.Get("type").MustString()
+	configJSON.Del("type")
+	if t == "" {
+		c.addError(path, fmt.Errorf("%s doesn't have type", pluginKind))
+		return
+	}
+	info, err := c.plugins.Get(pluginKind, t)
+	if err != nil {
+		c.addError(path, err)
+		return
+	}
+
+	deadqueue := configJSON.Get("deadqueue")
+	if len(deadqueue.MustMap()) > 0 {
+		if _, err := extractDeadQueueAnnotation(deadqueue.Get("annotate")); err != nil {
+			c.addError(path+".deadqueue.annotate", err)
+		}
+		deadqueue.Del("annotate")
+		c.checkPlugin(path+".deadqueue", pluginKind, deadqueue, values)
+	}
+	configJSON.Del("deadqueue")
+
+	config, err := configJSON.Encode()
+	if err != nil {
+		c.addError(path, err)
+		return
+	}
+	c.checkPluginConfig(path, info, config, values)
+}
+
+func (c *configChecker) checkPluginConfig(path string, info *pipeline.PluginStaticInfo, config []byte, values map[string]int) {
+	parsed, err := pipeline.GetConfig(info, config, values)
+	if err != nil {
+		c.addError(path, fmt.Errorf("wrong config for %q: %w", info.Type, err))
+		return
+	}
+	if err := pipeline.ValidatePipelineConfig(parsed, c.pipelineName); err != nil {
+		c.addError(path, fmt.Errorf("wrong config for %q: %w", info.Type, err))
+	}
+}
@@ -0,0 +1,67 @@
+package fd_test
+
+import (
+	"testing"
+
+	"github.com/ozontech/file.d/fd"
+	_ "github.com/ozontech/file.d/plugin/action/modify"
+	_ "github.com/ozontech/file.d/plugin/action/throttle"
+	_ "github.com/ozontech/file.d/plugin/output/pipeline"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckConfig(t *testing.T) {
+	config := newConfig(t, map[string]string{
+		"valid": `{
+			"input": {"type": "fake"},
+			"actions": [{"type": "modify", "field": "${other}"}],
+			"output": {"type": "devnull", "deadqueue": {"type": "devnull", "annotate": {"field": "deadqueue", "meta": true}}}
+		}`,
+		"invalid": `{
+			"settings": {"maintenance_interval": "abc", "event_timeout": "abc", "decoder": "unknown"},
+			"input": {"type": "fake", "unknown_field": true},
+			"actions": [
+				{"type": "unknown"},
+				{"type": "discard", "do_if": {"op": "unknown"}, "match_mode": "unknown"},
+				{"type": "modify", "field": "${other"},
+				{"type": "throttle", "rules": [{"limit": 10, "limit_distribution": {"field": "level", "ratios": [{"ratio": 2, "values": ["error"]}]}}]}
+			],
+			"output": [
+				{"type": "devnull", "default": true, "do_if": {"op": "equal", "field": "a", "values": ["b"]}},
+				{"type": "unknown"},
+				{"type": "devnull", "deadqueue": {"type": "devnull", "annotate": {"meta": "yes"}}},
+				{"type": "pipeline", "pipeline": "invalid"}
+			]
+		}`,
+	})
+	raw, err := config.Pipelines["invalid"].Raw.Encode()
+	require.NoError(t, err)
+
+	errs := fd.CheckConfig(config, fd.DefaultPluginRegistry)
+
+	paths := make([]string, 0, len(errs))
+	for _, err := range errs {
+		var configErr *fd.ConfigError
+		require.ErrorAs(t, err, &configErr)
+		paths = append(paths, configErr.Path)
+	}
+	require.Equal(t, []string{
+		"pipelines.invalid.settings",
+		"pipelines.invalid.settings",
+		"pipelines.invalid.settings.decoder",
+		"pipelines.invalid.input",
+		"pipelines.invalid.actions[0]",
+		"pipelines.invalid.actions[1].do_if",
+		"pipelines.invalid.actions[1].match_mode",
+		"pipelines.invalid.actions[2]",
+		"pipelines.invalid.actions[3]",
+		"pipelines.invalid.output[0]",
+		"pipelines.invalid.output[1]",
+		"pipelines.invalid.output[2].deadqueue.annotate",
+		"pipelines.invalid.output[3]",
+	}, paths)
+
+	checkedRaw, err := config.Pipelines["invalid"].Raw.Encode()
+	require.NoError(t, err)
+	require.Equal(t, raw, checkedRaw, "config shouldn't be modified by the check")
+}
@@ -1,14 +1,21 @@
 package fd
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"net/http/pprof"
 	"runtime"
 	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/bitly/go-simplejson"
 	"github.com/ozontech/file.d/buildinfo"
@@ -22,6 +29,8 @@ import (
 	"go.uber.org/atomic"
 )
 
+const serverShutdownTimeout = 3 * time.Second
+
 type FileD struct {
 	config     *cfg.Config
 	httpAddr   string
@@ -34,6 +43,15 @@ type FileD struct {
 	stopChan   chan struct{}
 	shouldStop atomic.Bool
 
+	// pipelineConfigs are the encoded configs of the running pipelines.
+	// They are taken before the pipelines creation, since it modifies the raw configs.
+	pipelineConfigs map[string][]byte
+	// pipelineMuxes serve the endpoints of the pipelines, so the endpoints are replaced on reload.
+	pipelineMuxes   map[string]*http.ServeMux
+	pipelineMuxesMu sync.RWMutex
+	// pipelinesMu guards Pipelines, since they are described by the admin API while reloading.
+	pipelinesMu sync.RWMutex
+
 	// file_d metrics
 
 	versionMetric *metric.GaugeVec
@@ -41,11 +59,13 @@ type FileD struct {
 
 func New(config *cfg.Config, httpAddr string) *FileD {
 	return &FileD{
-		config:    config,
-		httpAddr:  httpAddr,
-		mux:       http.NewServeMux(),
-		plugins:   DefaultPluginRegistry,
-		Pipelines: make([]*pipeline.Pipeline, 0),
+		config:          config,
+		httpAddr:        httpAddr,
+		mux:             http.NewServeMux(),
+		plugins:         DefaultPluginRegistry,
+		Pipelines:       make([]*pipeline.Pipeline, 0),
+		pipelineConfigs: make(map[string][]byte),
+		pipelineMuxes:   make(map[string]*http.ServeMux),
 	}
 }
 
@@ -76,18 +96,166 @@ func (f *FileD) createRegistry() {
 }
 
 func (f *FileD) startPipelines() {
-	f.Pipelines = f.Pipelines[:0]
+	pipelines := make([]*pipeline.Pipeline, 0, len(f.config.Pipelines))
 	for name, config := range f.config.Pipelines {
-		f.addPipeline(name, config)
+		f.pipelineConfigs[name] = encodePipelineConfig(name, config)
+		p, mux, err := f.newPipeline(name, config)
+		if err != nil {
+			logger.Fatalf("can't create pipeline %q: %s", name, err.Error())
+		}
+		f.setPipelineMux(name, mux)
+		pipelines = append(pipelines, p)
 	}
+	f.setPipelines(pipelines)
 	for _, p := range f.Pipelines {
-		p.Start()
+		if err := p.Start(); err != nil {
+			logger.Fatalf("can't start pipeline %q: %s", p.Name, err.Error())
+		}
 	}
 }
 
-func (f *FileD) addPipeline(name string, config *cfg.PipelineConfig) {
-	mux := f.mux
-	settings := extractPipelineParams(config.Raw.Get("settings"))
+// Reload applies the new config to the running file.d.
+// Only the pipelines with the changed config are recreated, the others keep running untouched.
+// If any of the pipelines can't be created, the running pipelines aren't affected and the error is returned.
+// If the recreated pipeline can't be started, the previous one is started again with the previous config
+// and the error is returned.
+func (f *FileD) Reload(config *cfg.Config) error {
+	configs := make(map[string][]byte, len(config.Pipelines))
+	created := make([]*pipeline.Pipeline, 0)
+	muxes := make(map[string]*http.ServeMux)
+	for name, pipelineConfig := range config.Pipelines {
+		configs[name] = encodePipelineConfig(name, pipelineConfig)
+		if bytes.Equal(configs[name], f.pipelineConfigs[name]) {
+			continue
+		}
+
+		p, mux, err := f.newPipeline(name, pipelineConfig)
+		if err != nil {
+			f.releasePipelines(created)
+			return fmt.Errorf("can't create pipeline %q: %w", name, err)
+		}
+		created = append(created, p)
+		muxes[name] = mux
+	}
+
+	logger.Infof("reloading pipelines: changed=%d, running=%d", len(created), len(f.Pipelines))
+
+	pipelines := make([]*pipeline.Pipeline, 0, len(config.Pipelines))
+	replaced := make(map[string]*pipeline.Pipeline)
+	for _, p := range f.Pipelines {
+		if bytes.Equal(configs[p.Name], f.pipelineConfigs[p.Name]) {
+			pipelines = append(pipelines, p)
+			continue
+		}
+		if _, has := configs[p.Name]; has {
+			replaced[p.Name] = p
+			continue
+		}
+
+		logger.Infof("stopping removed pipeline %q", p.Name)
+		p.Stop()
+		f.setPipelineMux(p.Name, nil)
+	}
+
+	// the config of the pipelines restarted with the previous config is kept
+	applied := &cfg.Config{Vault: config.Vault, Pipelines: maps.Clone(config.Pipelines)}
+	var errs []error
+	for _, p := range created {
+		// the previous pipeline keeps running until its replacement is started,
+		// it's stopped right before the start since they share the input resources, e.g. the listening address
+		prev := replaced[p.Name]
+		if prev != nil {
+			logger.Infof("stopping pipeline %q to reload", p.Name)
+			prev.Stop()
+		}
+
+		f.setPipelineMux(p.Name, muxes[p.Name])
+		err := p.Start()
+		if err == nil {
+			pipelines = append(pipelines, p)
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("can't start pipeline %q: %w", p.Name, err))
+		f.setPipelineMux(p.Name, nil)
+		delete(configs, p.Name)
+		delete(applied.Pipelines, p.Name)
+		if prev == nil {
+			// there is no running pipeline sharing the metrics
+			p.Release()
+			continue
+		}
+
+		restarted, err := f.restartPipeline(p.Name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("can't restart pipeline %q with the previous config: %w", p.Name, err))
+			continue
+		}
+		pipelines = append(pipelines, restarted)
+		configs[p.Name] = f.pipelineConfigs[p.Name]
+		applied.Pipelines[p.Name] = f.config.Pipelines[p.Name]
+	}
+
+	f.setPipelines(pipelines)
+	f.pipelineConfigs = configs
+	f.config = applied
+
+	return errors.Join(errs...)
+}
+
+// restartPipeline creates and starts the pipeline with the current config again, e.g. since its replacement can't be started.
+func (f *FileD) restartPipeline(name string) (*pipeline.Pipeline, error) {
+	// the raw config is consumed by the plugins setup, so it's decoded again from the encoded one
+	raw, err := simplejson.NewJson(f.pipelineConfigs[name])
+	if err != nil {
+		return nil, err
+	}
+
+	p, mux, err := f.newPipeline(name, &cfg.PipelineConfig{Raw: raw})
+	if err != nil {
+		return nil, err
+	}
+
+	f.setPipelineMux(name, mux)
+	if err := p.Start(); err != nil {
+		f.setPipelineMux(name, nil)
+		return nil, err
+	}
+	return p, nil
+}
+
+// releasePipelines releases the created pipelines which aren't started since the reload has failed.
+func (f *FileD) releasePipelines(created []*pipeline.Pipeline) {
+	running := make(map[string]bool, len(f.Pipelines))
+	for _, p := range f.Pipelines {
+		running[p.Name] = true
+	}
+
+	for _, p := range created {
+		// the metrics of the changed pipeline are shared with the running one
+		if running[p.Name] {
+			continue
+		}
+		p.Release()
+	}
+}
+
+func encodePipelineConfig(name string, config *cfg.PipelineConfig) []byte {
+	// keys of the maps are sorted on encoding, so the same configs have the same encoding
+	encoded, err := config.Raw.Encode()
+	if err != nil {
+		logger.Panicf("can't encode config of pipeline %q: %s", name, err.Error())
+	}
+	return encoded
+}
+
+// newPipeline creates the pipeline and the mux with its endpoints.
+func (f *FileD) newPipeline(name string, config *cfg.PipelineConfig) (*pipeline.Pipeline, *http.ServeMux, error) {
+	mux := http.NewServeMux()
+	settings, err := extractPipelineParams(config.Raw.Get("settings"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("wrong settings: %w", err)
+	}
 
 	values := map[string]int{
 		"capacity":   settings.Capacity,
@@ -99,24 +267,87 @@ func (f *FileD) addPipeline(name string, config *cfg.PipelineConfig) {
 	if settings.Pool == pipeline.PoolTypeLowMem {
 		insaneJSON.StartNodePoolSize = 16
 	}
-	p := pipeline.New(name, settings, f.registry, logger.Instance.Named(name).Desugar())
+	p, err := pipeline.New(name, settings, f.registry, logger.Instance.Named(name).Desugar())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := f.setupPlugins(p, config, values); err != nil {
+		// the pipeline won't be started
+		f.releasePipelines([]*pipeline.Pipeline{p})
+		return nil, nil, err
+	}
+
+	p.SetupHTTPHandlers(mux)
+	return p, mux, nil
+}
+
+func (f *FileD) setupPlugins(p *pipeline.Pipeline, config *cfg.PipelineConfig, values map[string]int) error {
 	err := f.setupInput(p, config, values)
 	if err != nil {
-		logger.Fatalf("can't create pipeline %q: %s", name, err.Error())
+		return err
 	}
 
 	actions := config.Raw.Get("actions")
 	if err := SetupActions(p, f.plugins, actions, values); err != nil {
-		logger.Fatalf("can't create pipeline %q: %s", name, err.Error())
+		return err
 	}
 
-	err = f.setupOutput(p, config, values)
-	if err != nil {
-		logger.Fatalf("can't create pipeline %q: %s", name, err.Error())
+	return f.setupOutput(p, config, values)
+}
+
+// setPipelines replaces the running pipelines, so they are described by the admin API.
+func (f *FileD) setPipelines(pipelines []*pipeline.Pipeline) {
+	f.pipelinesMu.Lock()
+	defer f.pipelinesMu.Unlock()
+
+	f.Pipelines = pipelines
+}
+
+// servePipelinesList describes the running pipelines with their resolved configs and the runtime state.
+func (f *FileD) servePipelinesList(w http.ResponseWriter, _ *http.Request) {
+	f.pipelinesMu.RLock()
+	descriptions := make([]*pipeline.Description, 0, len(f.Pipelines))
+	for _, p := range f.Pipelines {
+		descriptions = append(descriptions, p.Describe())
 	}
+	f.pipelinesMu.RUnlock()
 
-	p.SetupHTTPHandlers(mux)
-	f.Pipelines = append(f.Pipelines, p)
+	slices.SortFunc(descriptions, func(a, b *pipeline.Description) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(descriptions); err != nil {
+		logger.Errorf("can't write pipelines: %s", err.Error())
+	}
+}
+
+// setPipelineMux replaces the endpoints of the pipeline, nil mux removes them.
+func (f *FileD) setPipelineMux(name string, mux *http.ServeMux) {
+	f.pipelineMuxesMu.Lock()
+	defer f.pipelineMuxesMu.Unlock()
+
+	if mux == nil {
+		delete(f.pipelineMuxes, name)
+		return
+	}
+	f.pipelineMuxes[name] = mux
+}
+
+func (f *FileD) servePipelines(w http.ResponseWriter, r *http.Request) {
+	name, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/pipelines/"), "/")
+
+	f.pipelineMuxesMu.RLock()
+	mux := f.pipelineMuxes[name]
+	f.pipelineMuxesMu.RUnlock()
+
+	if mux == nil {
+		http.NotFound(w, r)
+		return
+	}
+	mux.ServeHTTP(w, r)
 }
 
 func (f *FileD) setupInput(p *pipeline.Pipeline, pipelineConfig *cfg.PipelineConfig, values map[string]int) error {
@@ -175,7 +406,7 @@ func setupAction(p *pipeline.Pipeline, plugins *PluginRegistry, index int, t str
 
 	doIfChecker, err := extractDoIfChecker(actionJSON.Get("do_if"))
 	if err != nil {
-		logger.Fatalf(`failed to extract "do_if" conditions for action %d/%s in pipeline %q: %s`, index, t, p.Name, err.Error())
+		return fmt.Errorf(`failed to extract "do_if" conditions for action %d/%s in pipeline %q: %w`, index, t, p.Name, err)
 	}
 
 	matchMode := extractMatchMode(actionJSON)
@@ -212,26 +443,96 @@ func setupAction(p *pipeline.Pipeline, plugins *PluginRegistry, index int, t str
 }
 
 func (f *FileD) setupOutput(p *pipeline.Pipeline, pipelineConfig *cfg.PipelineConfig, values map[string]int) error {
+	outputsJSON := pipelineConfig.Raw.Get(string(pipeline.PluginKindOutput))
+	if outputs := outputsJSON.MustArray(); outputs != nil {
+		return f.setupOutputs(p, outputsJSON, len(outputs), values)
+	}
+
 	info, err := f.getStaticInfo(pipelineConfig, pipeline.PluginKindOutput, values)
 	if err != nil {
 		return err
 	}
+	if err := validateOutputInPipeline(info, p.Name); err != nil {
+		return err
+	}
 
-	p.SetOutput(&pipeline.OutputPluginInfo{
-		PluginStaticInfo:  info,
-		PluginRuntimeInfo: f.instantiatePlugin(info),
-	})
+	p.SetOutput(f.newOutputInfo(info))
 
 	if info.DeadQueueInfo != nil {
-		p.SetDeadQueueOutput(&pipeline.OutputPluginInfo{
-			PluginStaticInfo:  info.DeadQueueInfo,
-			PluginRuntimeInfo: f.instantiatePlugin(info.DeadQueueInfo),
-		})
+		p.SetDeadQueueOutput(f.newOutputInfo(info.DeadQueueInfo))
+		p.SetDeadQueueAnnotation(info.DeadQueueAnnotation)
+	}
+
+	return nil
+}
+
+// setupOutputs routes the pipeline events to the list of outputs.
+func (f *FileD) setupOutputs(p *pipeline.Pipeline, outputsJSON *simplejson.Json, count int, values map[string]int) error {
+	if count == 0 {
+		return fmt.Errorf("empty %s list", pipeline.PluginKindOutput)
+	}
+	if count > pipeline.MaxOutputRoutes {
+		return fmt.Errorf("too many outputs: %d, max count is %d", count, pipeline.MaxOutputRoutes)
+	}
+
+	for i := 0; i < count; i++ {
+		outputJSON := outputsJSON.GetIndex(i)
+
+		doIfChecker, err := extractDoIfChecker(outputJSON.Get("do_if"))
+		if err != nil {
+			return fmt.Errorf(`failed to extract "do_if" conditions for %s #%d: %w`, pipeline.PluginKindOutput, i, err)
+		}
+		isDefault := outputJSON.Get("default").MustBool()
+		if isDefault && doIfChecker != nil {
+			return fmt.Errorf(`default %s #%d can't have "do_if" conditions`, pipeline.PluginKindOutput, i)
+		}
+		// delete for success decode into config
+		outputJSON.Del("do_if")
+		outputJSON.Del("default")
+
+		info, err := f.getPluginStaticInfo(outputJSON, pipeline.PluginKindOutput, values)
+		if err != nil {
+			return fmt.Errorf("%s #%d: %w", pipeline.PluginKindOutput, i, err)
+		}
+		if err := validateOutputInPipeline(info, p.Name); err != nil {
+			return fmt.Errorf("%s #%d: %w", pipeline.PluginKindOutput, i, err)
+		}
+
+		route := &pipeline.OutputRoute{
+			Output:      f.newOutputInfo(info),
+			DoIfChecker: doIfChecker,
+			IsDefault:   isDefault,
+		}
+		if info.DeadQueueInfo != nil {
+			route.DeadQueue = f.newOutputInfo(info.DeadQueueInfo)
+			route.DeadQueueAnnotation = info.DeadQueueAnnotation
+		}
+		p.AddOutput(route)
 	}
 
 	return nil
 }
 
+// validateOutputInPipeline checks the configs of the output and its dead queue which depend on the pipeline.
+func validateOutputInPipeline(info *pipeline.PluginStaticInfo, pipelineName string) error {
+	if err := pipeline.ValidatePipelineConfig(info.Config, pipelineName); err != nil {
+		return fmt.Errorf("wrong config for %s with type %q: %w", pipeline.PluginKindOutput, info.Type, err)
+	}
+	if info.DeadQueueInfo != nil {
+		if err := pipeline.ValidatePipelineConfig(info.DeadQueueInfo.Config, pipelineName); err != nil {
+			return fmt.Errorf("wrong config for deadqueue with type %q: %w", info.DeadQueueInfo.Type, err)
+		}
+	}
+	return nil
+}
+
+func (f *FileD) newOutputInfo(info *pipeline.PluginStaticInfo) *pipeline.OutputPluginInfo {
+	return &pipeline.OutputPluginInfo{
+		PluginStaticInfo:  info,
+		PluginRuntimeInfo: f.instantiatePlugin(info),
+	}
+}
+
 func (f *FileD) instantiatePlugin(info *pipeline.PluginStaticInfo) *pipeline.PluginRuntimeInfo {
 	plugin, _ := info.Factory()
 	return &pipeline.PluginRuntimeInfo{
@@ -241,7 +542,10 @@ func (f *FileD) instantiatePlugin(info *pipeline.PluginStaticInfo) *pipeline.Plu
 }
 
 func (f *FileD) getStaticInfo(pipelineConfig *cfg.PipelineConfig, pluginKind pipeline.PluginKind, values map[string]int) (*pipeline.PluginStaticInfo, error) {
-	configJSON := pipelineConfig.Raw.Get(string(pluginKind))
+	return f.getPluginStaticInfo(pipelineConfig.Raw.Get(string(pluginKind)), pluginKind, values)
+}
+
+func (f *FileD) getPluginStaticInfo(configJSON *simplejson.Json, pluginKind pipeline.PluginKind, values map[string]int) (*pipeline.PluginStaticInfo, error) {
 	if configJSON.MustMap() == nil {
 		return nil, fmt.Errorf("no %s plugin provided", pluginKind)
 	}
@@ -258,7 +562,10 @@ func (f *FileD) getStaticInfo(pipelineConfig *cfg.PipelineConfig, pluginKind pip
 	}
 
 	deadqueue := configJSON.Get("deadqueue")
-	var deadqueueInfo *pipeline.PluginStaticInfo
+	var (
+		deadqueueInfo       *pipeline.PluginStaticInfo
+		deadqueueAnnotation *pipeline.DeadQueueAnnotation
+	)
 	if deadqueueMap := deadqueue.MustMap(); deadqueueMap != nil {
 		if len(deadqueueMap) > 0 {
 			deadqueueType := deadqueue.Get("type").MustString()
@@ -272,6 +579,12 @@ func (f *FileD) getStaticInfo(pipelineConfig *cfg.PipelineConfig, pluginKind pip
 
 			deadqueue.Del("type")
 
+			deadqueueAnnotation, err = extractDeadQueueAnnotation(deadqueue.Get("annotate"))
+			if err != nil {
+				return nil, fmt.Errorf("deadqueue of %s: %w", pluginKind, err)
+			}
+			deadqueue.Del("annotate")
+
 			deadqueueConfigJson, err := deadqueue.Encode()
 			if err != nil {
 				logger.Panicf("can't create config json for %s deadqueue", deadqueueType)
@@ -279,7 +592,7 @@ func (f *FileD) getStaticInfo(pipelineConfig *cfg.PipelineConfig, pluginKind pip
 
 			config, err := pipeline.GetConfig(deadqueueInfo, deadqueueConfigJson, values)
 			if err != nil {
-				logger.Fatalf("error on creating deadqueue of %s with type %q: %s", deadqueueType, pluginKind, err.Error())
+				return nil, fmt.Errorf("error on creating deadqueue of %s with type %q: %w", pluginKind, deadqueueType, err)
 			}
 			deadqueueInfo.Config = config
 
@@ -295,35 +608,67 @@ func (f *FileD) getStaticInfo(pipelineConfig *cfg.PipelineConfig, pluginKind pip
 	}
 	config, err := pipeline.GetConfig(info, configJson, values)
 	if err != nil {
-		logger.Fatalf("error on creating %s with type %q: %s", t, pluginKind, err.Error())
+		return nil, fmt.Errorf("error on creating %s with type %q: %w", pluginKind, t, err)
 	}
 
 	infoCopy := *info
 	infoCopy.Config = config
 	if deadqueueInfo != nil {
 		infoCopy.DeadQueueInfo = deadqueueInfo
+		infoCopy.DeadQueueAnnotation = deadqueueAnnotation
 	}
 
 	return &infoCopy, nil
 }
 
+// Stop drains the pipelines until the context is done and then stops them.
+// The events which aren't committed before the deadline will be read again after restart.
 func (f *FileD) Stop(ctx context.Context) error {
-	logger.Infof("stopping pipelines=%d", len(f.Pipelines))
 	f.shouldStop.Store(true)
+	f.drain(ctx)
 
+	logger.Infof("stopping pipelines=%d", len(f.Pipelines))
 	for _, p := range f.Pipelines {
 		p.Stop()
 	}
 
 	var err error
 	if f.server != nil {
-		err = f.server.Shutdown(ctx)
+		// the drain may take all the time, so the server has its own timeout
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), serverShutdownTimeout)
+		err = f.server.Shutdown(shutdownCtx)
+		cancel()
+		<-f.stopChan
 	}
-	<-f.stopChan
 
 	return err
 }
 
+// drain drains all the pipelines at the same time, since the pipelines can pass the events to each other.
+func (f *FileD) drain(ctx context.Context) {
+	logger.Infof("draining pipelines=%d", len(f.Pipelines))
+	start := time.Now()
+
+	wg := sync.WaitGroup{}
+	notDrained := atomic.NewInt32(0)
+	for _, p := range f.Pipelines {
+		wg.Add(1)
+		go func(p *pipeline.Pipeline) {
+			defer wg.Done()
+			if err := p.Drain(ctx); err != nil {
+				notDrained.Inc()
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	if notDrained.Load() > 0 {
+		logger.Warnf("pipelines=%d aren't drained in %s, the events in-flight will be processed again after restart", notDrained.Load(), time.Since(start))
+		return
+	}
+	logger.Infof("pipelines are drained in %s", time.Since(start))
+}
+
 func (f *FileD) startHTTP() {
 	if f.httpAddr == "off" {
 		return
@@ -338,9 +683,12 @@ func (f *FileD) startHTTP() {
 	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
 
+	mux.HandleFunc("/pipelines", f.servePipelinesList)
+	mux.HandleFunc("/pipelines/", f.servePipelines)
 	mux.HandleFunc("/live", f.serveLive)
 	mux.HandleFunc("/ready", f.serveReady)
 	mux.HandleFunc("/freeosmem", f.serveFreeOsMem)
+	mux.HandleFunc("/schema", f.serveSchema)
 	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(
 		f.registry, promhttp.HandlerFor(f.registry, promhttp.HandlerOpts{}),
 	))
@@ -385,6 +733,15 @@ func (f *FileD) serveFreeOsMem(_ http.ResponseWriter, _ *http.Request) {
 	logger.Infof("free OS memory OK")
 }
 
+func (f *FileD) serveSchema(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(f.plugins.JSONSchema()); err != nil {
+		logger.Errorf("can't write schema: %s", err.Error())
+	}
+}
+
 func (f *FileD) serveReady(w http.ResponseWriter, _ *http.Request) {
 	if f.shouldStop.Load() {
 		w.WriteHeader(http.StatusServiceUnavailable)
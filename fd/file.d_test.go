@@ -0,0 +1,148 @@
+package fd_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	_ "github.com/ozontech/file.d/plugin/action/discard"
+	_ "github.com/ozontech/file.d/plugin/input/fake"
+	_ "github.com/ozontech/file.d/plugin/output/devnull"
+	"github.com/stretchr/testify/require"
+)
+
+func newConfig(t *testing.T, pipelines map[string]string) *cfg.Config {
+	config := cfg.NewConfig()
+	for name, raw := range pipelines {
+		json, err := simplejson.NewJson([]byte(raw))
+		require.NoError(t, err)
+		config.Pipelines[name] = &cfg.PipelineConfig{Raw: json}
+	}
+	return config
+}
+
+func getPipelines(fileD *fd.FileD) map[string]*pipeline.Pipeline {
+	pipelines := make(map[string]*pipeline.Pipeline, len(fileD.Pipelines))
+	for _, p := range fileD.Pipelines {
+		pipelines[p.Name] = p
+	}
+	return pipelines
+}
+
+func TestReload(t *testing.T) {
+	const (
+		devnull = `{"input": {"type": "fake"}, "output": {"type": "devnull"}}`
+		discard = `{"input": {"type": "fake"}, "actions": [{"type": "discard"}], "output": {"type": "devnull"}}`
+		invalid = `{"input": {"type": "fake"}, "actions": [{"type": "unknown"}], "output": {"type": "devnull"}}`
+	)
+
+	fileD := fd.New(newConfig(t, map[string]string{
+		"unchanged": devnull,
+		"changed":   devnull,
+		"removed":   devnull,
+	}), "off")
+	fileD.Start()
+	defer func() {
+		require.NoError(t, fileD.Stop(context.Background()))
+	}()
+	before := getPipelines(fileD)
+
+	err := fileD.Reload(newConfig(t, map[string]string{
+		"unchanged": devnull,
+		"changed":   discard,
+		"added":     devnull,
+	}))
+	require.NoError(t, err)
+
+	after := getPipelines(fileD)
+	require.Len(t, after, 3)
+	require.Same(t, before["unchanged"], after["unchanged"], "unchanged pipeline shouldn't be recreated")
+	require.NotSame(t, before["changed"], after["changed"], "changed pipeline should be recreated")
+	require.NotNil(t, after["added"])
+	require.NotContains(t, after, "removed")
+
+	err = fileD.Reload(newConfig(t, map[string]string{
+		"unchanged": invalid,
+		"changed":   devnull,
+		"added":     devnull,
+	}))
+	require.Error(t, err)
+	require.Equal(t, after, getPipelines(fileD), "running pipelines shouldn't be affected by failed reload")
+}
+
+func TestReloadStartFailure(t *testing.T) {
+	const devnull = `{"input": {"type": "fake"}, "output": {"type": "devnull"}}`
+
+	dir := t.TempDir()
+	// the spill queues can't be opened since their committed positions are dirs
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "changed", "committed"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "added", "committed"), 0o755))
+	spilled := fmt.Sprintf(`{"input": {"type": "fake"}, "settings": {"spill_queue": {"dir": %q}}, "output": {"type": "devnull"}}`, dir)
+
+	fileD := fd.New(newConfig(t, map[string]string{
+		"unchanged": devnull,
+		"changed":   devnull,
+	}), "off")
+	fileD.Start()
+	defer func() {
+		require.NoError(t, fileD.Stop(context.Background()))
+	}()
+	before := getPipelines(fileD)
+
+	err := fileD.Reload(newConfig(t, map[string]string{
+		"unchanged": devnull,
+		"changed":   spilled,
+		"added":     spilled,
+	}))
+	require.Error(t, err)
+
+	after := getPipelines(fileD)
+	require.Len(t, after, 2)
+	require.Same(t, before["unchanged"], after["unchanged"], "unchanged pipeline shouldn't be recreated")
+	require.NotNil(t, after["changed"], "changed pipeline should be restarted with the previous config")
+	require.NotContains(t, after, "added")
+
+	err = fileD.Reload(newConfig(t, map[string]string{
+		"unchanged": devnull,
+		"changed":   devnull,
+	}))
+	require.NoError(t, err)
+	require.Same(t, after["changed"], getPipelines(fileD)["changed"], "restarted pipeline should have the previous config")
+}
+
+func TestApplyReplay(t *testing.T) {
+	config := newConfig(t, map[string]string{
+		"target": `{"input": {"type": "unknown"}, "settings": {"capacity": 64}, "actions": [{"type": "discard"}], "output": {"type": "devnull"}}`,
+		"other":  `{"input": {"type": "fake"}, "output": {"type": "devnull"}}`,
+	})
+
+	err := fd.ApplyReplay(config, &fd.ReplayOptions{Pipeline: "unknown", Input: `{"type": "fake"}`})
+	require.Error(t, err)
+	err = fd.ApplyReplay(config, &fd.ReplayOptions{Pipeline: "target", Input: `[]`})
+	require.Error(t, err)
+	require.Len(t, config.Pipelines, 2, "config shouldn't be changed by failed replay")
+
+	err = fd.ApplyReplay(config, &fd.ReplayOptions{
+		Pipeline:        "target",
+		Input:           `{"type": "fake"}`,
+		AnnotationField: "dq",
+		DoIf:            `{"op": "equal", "field": "dq.output", "values": ["kafka"]}`,
+		Rate:            100,
+	})
+	require.NoError(t, err)
+	require.Len(t, config.Pipelines, 1)
+
+	raw := config.Pipelines["target"].Raw
+	require.Equal(t, "fake", raw.GetPath("input", "type").MustString())
+	require.Equal(t, 64, raw.GetPath("settings", "capacity").MustInt())
+	require.Equal(t, "discard", raw.Get("actions").GetIndex(0).Get("type").MustString())
+	require.Equal(t, 100, raw.GetPath("settings", "replay", "rate").MustInt())
+
+	require.Empty(t, fd.CheckConfig(config, fd.DefaultPluginRegistry))
+}
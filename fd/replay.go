@@ -0,0 +1,82 @@
+package fd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/ozontech/file.d/cfg"
+)
+
+// ReplayOptions configure the replay of the dead queue events into the pipeline.
+type ReplayOptions struct {
+	// Pipeline is the name of the pipeline to replay the events into.
+	Pipeline string
+	// Input is the JSON config of the input reading the dead queue file or topic.
+	Input string
+	// AnnotationField is the path of the annotations field to remove.
+	AnnotationField string
+	// DoIf is the JSON of the do_if selecting the events to replay, all the events are replayed if it's empty.
+	DoIf string
+	// Rate is the max number of the events per second, it's unlimited if it's zero.
+	Rate int
+}
+
+// ApplyReplay changes the config to replay the dead queue events:
+// only the pipeline to replay into is kept, its input is replaced with the dead queue input
+// and the "replay" pipeline settings are set, so its actions and outputs are kept as is.
+func ApplyReplay(config *cfg.Config, opts *ReplayOptions) error {
+	pipelineConfig, has := config.Pipelines[opts.Pipeline]
+	if !has {
+		return fmt.Errorf("pipeline %q isn't found", opts.Pipeline)
+	}
+
+	if opts.Input == "" {
+		return errors.New("replay input isn't set")
+	}
+	input, err := simplejson.NewJson([]byte(opts.Input))
+	if err != nil {
+		return fmt.Errorf("can't parse replay input: %w", err)
+	}
+	if input.MustMap() == nil {
+		return errors.New("replay input must be an object")
+	}
+	if opts.Rate < 0 {
+		return errors.New("replay rate must be non-negative")
+	}
+
+	replay := map[string]any{
+		"rate": opts.Rate,
+	}
+	if opts.AnnotationField != "" {
+		replay["annotation_field"] = opts.AnnotationField
+	}
+	if opts.DoIf != "" {
+		doIf, err := simplejson.NewJson([]byte(opts.DoIf))
+		if err != nil {
+			return fmt.Errorf("can't parse replay do_if: %w", err)
+		}
+		replay["do_if"] = doIf.Interface()
+	}
+
+	// the raw config is copied, so the loaded config isn't changed if the replay can't be applied
+	raw, err := copyJSON(pipelineConfig.Raw)
+	if err != nil {
+		return err
+	}
+	raw.Set("input", input.Interface())
+	raw.SetPath([]string{"settings", "replay"}, replay)
+
+	config.Pipelines = map[string]*cfg.PipelineConfig{
+		opts.Pipeline: {Raw: raw},
+	}
+	return nil
+}
+
+func copyJSON(j *simplejson.Json) (*simplejson.Json, error) {
+	data, err := j.Encode()
+	if err != nil {
+		return nil, fmt.Errorf("can't encode pipeline config: %w", err)
+	}
+	return simplejson.NewJson(data)
+}
@@ -0,0 +1,200 @@
+package fd
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/pipeline"
+)
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema returns the JSON Schema of the file.d config with the configs of all the registered plugins.
+// It can be used by the editors for the autocompletion and for checking the config before it reaches file.d.
+func (r *PluginRegistry) JSONSchema() map[string]any {
+	ids := make([]string, 0, len(r.plugins))
+	for id := range r.plugins {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	defs := map[string]any{
+		"pipeline": pipelineSchema(),
+		"settings": settingsSchema(),
+		"do_if":    map[string]any{"type": "object"},
+	}
+	refs := map[pipeline.PluginKind][]any{}
+	for _, id := range ids {
+		info := r.plugins[id]
+		kind, _, _ := strings.Cut(id, "_")
+		pluginKind := pipeline.PluginKind(kind)
+
+		defs[id] = pluginSchema(pluginKind, info)
+		refs[pluginKind] = append(refs[pluginKind], map[string]any{"$ref": "#/$defs/" + id})
+	}
+	for _, kind := range []pipeline.PluginKind{pipeline.PluginKindInput, pipeline.PluginKindAction, pipeline.PluginKindOutput} {
+		defs[string(kind)] = map[string]any{"oneOf": append([]any{}, refs[kind]...)}
+	}
+
+	return map[string]any{
+		"$schema": jsonSchemaDialect,
+		"title":   "file.d config",
+		"type":    "object",
+		"properties": map[string]any{
+			"vault": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"address": map[string]any{"type": "string"},
+					"token":   map[string]any{"type": "string"},
+				},
+			},
+			"pipelines": map[string]any{
+				"type":                 "object",
+				"propertyNames":        map[string]any{"pattern": "^[a-zA-Z0-9_]+$"},
+				"additionalProperties": map[string]any{"$ref": "#/$defs/pipeline"},
+				"minProperties":        1,
+			},
+		},
+		"required": []string{"pipelines"},
+		"$defs":    defs,
+	}
+}
+
+func pipelineSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"settings": map[string]any{"$ref": "#/$defs/settings"},
+			"input":    map[string]any{"$ref": "#/$defs/input"},
+			"actions": map[string]any{
+				"type":  "array",
+				"items": map[string]any{"$ref": "#/$defs/action"},
+			},
+			"output": map[string]any{
+				"oneOf": []any{
+					map[string]any{"$ref": "#/$defs/output"},
+					map[string]any{
+						"type":     "array",
+						"items":    map[string]any{"$ref": "#/$defs/output"},
+						"minItems": 1,
+						"maxItems": pipeline.MaxOutputRoutes,
+					},
+				},
+			},
+		},
+		"required":             []string{"input", "output"},
+		"additionalProperties": false,
+	}
+}
+
+// pluginSchema returns the schema of the plugin config with the properties handled by file.d itself.
+func pluginSchema(kind pipeline.PluginKind, info *pipeline.PluginStaticInfo) map[string]any {
+	_, config := info.Factory()
+	schema := cfg.JSONSchema(config)
+	schema["type"] = "object"
+
+	properties, ok := schema["properties"].(map[string]any)
+	if !ok {
+		properties = make(map[string]any)
+		schema["properties"] = properties
+	}
+	properties["type"] = map[string]any{"const": info.Type}
+	required, _ := schema["required"].([]string)
+	schema["required"] = append([]string{"type"}, required...)
+
+	switch kind {
+	case pipeline.PluginKindAction:
+		matchModes := make([]string, 0, len(pipeline.MatchModes))
+		for mode := range pipeline.MatchModes {
+			matchModes = append(matchModes, mode)
+		}
+		slices.Sort(matchModes)
+
+		properties["do_if"] = map[string]any{"$ref": "#/$defs/do_if"}
+		properties["match_fields"] = map[string]any{"type": "object"}
+		properties["match_mode"] = map[string]any{"type": "string", "enum": matchModes}
+		properties["match_invert"] = map[string]any{"type": "boolean"}
+		properties["metric_name"] = map[string]any{"type": "string"}
+		properties["metric_labels"] = map[string]any{"type": "array", "items": map[string]any{"type": "string"}}
+		properties["metric_skip_status"] = map[string]any{"type": "boolean"}
+	case pipeline.PluginKindOutput:
+		// do_if and default are used only if the pipeline has the list of outputs
+		properties["do_if"] = map[string]any{"$ref": "#/$defs/do_if"}
+		properties["default"] = map[string]any{"type": "boolean"}
+		properties["deadqueue"] = map[string]any{"$ref": "#/$defs/output"}
+		// annotate is used only in the deadqueue section
+		properties["annotate"] = map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"field": map[string]any{"type": "string"},
+				"meta":  map[string]any{"type": "boolean"},
+			},
+			"additionalProperties": false,
+		}
+	}
+
+	return schema
+}
+
+// settingsConfig describes the pipeline settings parsed by extractPipelineParams, it's used only to build the schema.
+// The defaults must be the same as the pipeline ones.
+type settingsConfig struct {
+	Capacity                int                    `json:"capacity" default:"1024"`
+	MetaCacheSize           int                    `json:"meta_cache_size" default:"1024"`
+	AvgLogSize              int                    `json:"avg_log_size" default:"4096"`
+	MaxEventSize            int                    `json:"max_event_size"`
+	CutOffEventByLimit      bool                   `json:"cut_off_event_by_limit"`
+	CutOffEventByLimitField string                 `json:"cut_off_event_by_limit_field"`
+	Decoder                 string                 `json:"decoder" default:"auto" options:"auto|json|raw|cri|postgres|nginx_error|protobuf|syslog_rfc3164|syslog_rfc5424|csv"`
+	DecoderParams           map[string]any         `json:"decoder_params"`
+	StreamField             string                 `json:"stream_field" default:"stream"`
+	MaintenanceInterval     cfg.Duration           `json:"maintenance_interval" default:"5s"`
+	EventTimeout            cfg.Duration           `json:"event_timeout" default:"30s"`
+	Antispam                antispamSettingsConfig `json:"antispam"`
+	AntispamThreshold       int                    `json:"antispam_threshold"`
+	AntispamExceptions      []map[string]any       `json:"antispam_exceptions"`
+	SourceNameMetaField     string                 `json:"source_name_meta_field"`
+	MetaOutOfBand           bool                   `json:"meta_out_of_band"`
+	EventTimeField          string                 `json:"event_time_field"`
+	EventTimeFormat         string                 `json:"event_time_format" default:"rfc3339nano"`
+	IsStrict                bool                   `json:"is_strict"`
+	Pool                    string                 `json:"pool" options:"std|low_memory"`
+	Metrics                 metricSettingsConfig   `json:"metrics"`
+	MetricHoldDuration      cfg.Duration           `json:"metric_hold_duration"`
+	SpillQueue              spillQueueConfig       `json:"spill_queue"`
+	Replay                  replaySettingsConfig   `json:"replay"`
+}
+
+type antispamSettingsConfig struct {
+	Threshold           int                  `json:"threshold"`
+	MaintenanceInterval cfg.Duration         `json:"maintenance_interval" default:"5s"`
+	Rules               []antispamRuleConfig `json:"rules"`
+}
+
+type antispamRuleConfig struct {
+	Name      string         `json:"name" required:"true"`
+	Threshold int            `json:"threshold"`
+	DoIf      map[string]any `json:"do_if" required:"true"`
+}
+
+type metricSettingsConfig struct {
+	HoldDuration        cfg.Duration `json:"hold_duration" default:"30m0s"`
+	MaxLabelValueLength int          `json:"max_label_value_length"`
+}
+
+type spillQueueConfig struct {
+	Dir         string `json:"dir"`
+	MaxSize     int64  `json:"max_size"`
+	SegmentSize int64  `json:"segment_size"`
+}
+
+type replaySettingsConfig struct {
+	AnnotationField string         `json:"annotation_field"`
+	DoIf            map[string]any `json:"do_if"`
+	Rate            int            `json:"rate"`
+}
+
+func settingsSchema() map[string]any {
+	return cfg.JSONSchema(&settingsConfig{})
+}
@@ -0,0 +1,66 @@
+package fd_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSchema(t *testing.T) {
+	raw, err := json.Marshal(fd.DefaultPluginRegistry.JSONSchema())
+	require.NoError(t, err)
+
+	var schema struct {
+		Defs map[string]struct {
+			OneOf []struct {
+				Ref string `json:"$ref"`
+			} `json:"oneOf"`
+			Properties map[string]json.RawMessage `json:"properties"`
+			Required   []string                   `json:"required"`
+		} `json:"$defs"`
+	}
+	require.NoError(t, json.Unmarshal(raw, &schema))
+
+	refs := make([]string, 0)
+	for _, ref := range schema.Defs["output"].OneOf {
+		refs = append(refs, ref.Ref)
+	}
+	require.Contains(t, refs, "#/$defs/output_devnull")
+
+	discard := schema.Defs["action_discard"]
+	require.JSONEq(t, `{"const": "discard"}`, string(discard.Properties["type"]))
+	require.Contains(t, discard.Properties, "do_if")
+	require.Equal(t, []string{"type"}, discard.Required)
+
+	modify := schema.Defs["action_modify"]
+	require.Contains(t, modify.Properties, "match_fields", "the map config should get the common properties")
+}
+
+func TestSettingsSchemaDefaults(t *testing.T) {
+	raw, err := json.Marshal(fd.DefaultPluginRegistry.JSONSchema())
+	require.NoError(t, err)
+
+	var schema struct {
+		Defs struct {
+			Settings struct {
+				Properties map[string]struct {
+					Default any `json:"default"`
+				} `json:"properties"`
+			} `json:"settings"`
+		} `json:"$defs"`
+	}
+	require.NoError(t, json.Unmarshal(raw, &schema))
+
+	// the defaults of the settings schema are the same as the pipeline ones
+	properties := schema.Defs.Settings.Properties
+	require.EqualValues(t, pipeline.DefaultCapacity, properties["capacity"].Default)
+	require.EqualValues(t, pipeline.DefaultMetaCacheSize, properties["meta_cache_size"].Default)
+	require.EqualValues(t, pipeline.DefaultAvgInputEventSize, properties["avg_log_size"].Default)
+	require.Equal(t, pipeline.DefaultDecoder, properties["decoder"].Default)
+	require.Equal(t, pipeline.DefaultStreamField, properties["stream_field"].Default)
+	require.Equal(t, pipeline.DefaultMaintenanceInterval.String(), properties["maintenance_interval"].Default)
+	require.Equal(t, pipeline.DefaultEventTimeout.String(), properties["event_timeout"].Default)
+}
@@ -3,6 +3,7 @@ package fd
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -12,9 +13,13 @@ import (
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/pipeline/antispam"
 	"github.com/ozontech/file.d/pipeline/doif"
+	"github.com/ozontech/file.d/xtime"
 )
 
-func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
+// extractPipelineParams returns the settings of the pipeline and all the errors found in them.
+func extractPipelineParams(settings *simplejson.Json) (*pipeline.Settings, error) {
+	var errs []error
+
 	capacity := pipeline.DefaultCapacity
 	sourceNameMetaField := pipeline.DefaultSourceNameMetaField
 	avgInputEventSize := pipeline.DefaultAvgInputEventSize
@@ -28,6 +33,9 @@ func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
 	isStrict := pipeline.DefaultIsStrict
 	eventTimeout := pipeline.DefaultEventTimeout
 	metaCacheSize := pipeline.DefaultMetaCacheSize
+	metaOutOfBand := false
+	eventTimeField := ""
+	eventTimeFormat := ""
 	pool := ""
 
 	antispamThreshold := pipeline.DefaultAntispamThreshold
@@ -38,6 +46,9 @@ func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
 	metricHoldDuration := pipeline.DefaultMetricHoldDuration
 	metricMaxLabelValueLength := pipeline.DefaultMetricMaxLabelValueLength
 
+	var spillQueue pipeline.SpillQueueSettings
+	var replay *pipeline.ReplaySettings
+
 	if settings != nil {
 		val := settings.Get("capacity").MustInt()
 		if val != 0 {
@@ -78,7 +89,7 @@ func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
 		if str != "" {
 			i, err := time.ParseDuration(str)
 			if err != nil {
-				logger.Fatalf("can't parse pipeline maintenance interval: %s", err.Error())
+				errs = append(errs, fmt.Errorf("can't parse pipeline maintenance interval: %w", err))
 			}
 			maintenanceInterval = i
 		}
@@ -87,7 +98,7 @@ func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
 		if str != "" {
 			i, err := time.ParseDuration(str)
 			if err != nil {
-				logger.Fatalf("can't parse pipeline event timeout: %s", err.Error())
+				errs = append(errs, fmt.Errorf("can't parse pipeline event timeout: %w", err))
 			}
 			eventTimeout = i
 		}
@@ -95,7 +106,7 @@ func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
 		var err error
 		antispamExceptions, err = extractAntispamExceptions(settings)
 		if err != nil {
-			logger.Fatalf("extract exceptions: %s", err)
+			errs = append(errs, fmt.Errorf("extract exceptions: %w", err))
 		}
 		antispamExceptions.Prepare()
 
@@ -104,7 +115,7 @@ func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
 		if str != "" {
 			i, err := time.ParseDuration(str)
 			if err != nil {
-				logger.Fatalf("can't parse antispam maintenance interval: %s", err.Error())
+				errs = append(errs, fmt.Errorf("can't parse antispam maintenance interval: %w", err))
 			}
 			antispamMaintenanceInterval = i
 		}
@@ -123,10 +134,21 @@ func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
 
 		antispamRules, err = extractAntispamRules(antispamSettings, antispamMaintenanceInterval)
 		if err != nil {
-			logger.Fatalf("extract antispam rules: %s", err)
+			errs = append(errs, fmt.Errorf("extract antispam rules: %w", err))
 		}
 
 		sourceNameMetaField = settings.Get("source_name_meta_field").MustString()
+		metaOutOfBand = settings.Get("meta_out_of_band").MustBool()
+
+		eventTimeField = settings.Get("event_time_field").MustString()
+		if str := settings.Get("event_time_format").MustString(); str != "" {
+			format, err := xtime.ParseFormatName(str)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("can't parse pipeline event time format: %w", err))
+			}
+			eventTimeFormat = format
+		}
+
 		isStrict = settings.Get("is_strict").MustBool()
 
 		if str := settings.Get("pool").MustString(); str != "" {
@@ -141,7 +163,7 @@ func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
 		if str != "" {
 			i, err := time.ParseDuration(str)
 			if err != nil {
-				logger.Fatalf("can't parse pipeline metric hold duration: %s", err.Error())
+				errs = append(errs, fmt.Errorf("can't parse pipeline metric hold duration: %w", err))
 			}
 			metricHoldDuration = i
 		}
@@ -151,6 +173,19 @@ func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
 			logger.Warn("negative max_label_value_length value, metric label truncation is disabled")
 			metricMaxLabelValueLength = 0
 		}
+
+		spillQueueSettings := settings.Get("spill_queue")
+		spillQueue.Dir = spillQueueSettings.Get("dir").MustString()
+		spillQueue.MaxSize = spillQueueSettings.Get("max_size").MustInt64()
+		spillQueue.SegmentSize = spillQueueSettings.Get("segment_size").MustInt64()
+		if spillQueue.MaxSize < 0 || spillQueue.SegmentSize < 0 {
+			errs = append(errs, errors.New("spill queue sizes must be positive"))
+		}
+
+		replay, err = extractReplaySettings(settings.Get("replay"))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("extract replay settings: %w", err))
+		}
 	}
 
 	return &pipeline.Settings{
@@ -169,6 +204,9 @@ func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
 			MaintenanceInterval: antispamMaintenanceInterval,
 		},
 		SourceNameMetaField: sourceNameMetaField,
+		MetaOutOfBand:       metaOutOfBand,
+		EventTimeField:      eventTimeField,
+		EventTimeFormat:     eventTimeFormat,
 		MaintenanceInterval: maintenanceInterval,
 		EventTimeout:        eventTimeout,
 		StreamField:         streamField,
@@ -178,7 +216,9 @@ func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
 			HoldDuration:        metricHoldDuration,
 			MaxLabelValueLength: metricMaxLabelValueLength,
 		},
-	}
+		SpillQueue: spillQueue,
+		Replay:     replay,
+	}, errors.Join(errs...)
 }
 
 func extractAntispamExceptions(settings *simplejson.Json) (antispam.Exceptions, error) {
@@ -314,6 +354,69 @@ func extractDoIfChecker(actionJSON *simplejson.Json) (*doif.Checker, error) {
 	return doif.NewFromMap(m)
 }
 
+// extractDeadQueueAnnotation parses the "annotate" section of the dead queue, it returns nil if there is no section.
+func extractDeadQueueAnnotation(annotateJSON *simplejson.Json) (*pipeline.DeadQueueAnnotation, error) {
+	if annotateJSON.Interface() == nil {
+		return nil, nil
+	}
+	if annotateJSON.MustMap() == nil {
+		return nil, errors.New(`"annotate" must be an object`)
+	}
+
+	annotation := &pipeline.DeadQueueAnnotation{}
+	if fieldJSON, has := annotateJSON.CheckGet("field"); has {
+		field, err := fieldJSON.String()
+		if err != nil {
+			return nil, errors.New(`"annotate.field" must be a string`)
+		}
+		annotation.Field = cfg.ParseFieldSelector(field)
+	}
+	if metaJSON, has := annotateJSON.CheckGet("meta"); has {
+		meta, err := metaJSON.Bool()
+		if err != nil {
+			return nil, errors.New(`"annotate.meta" must be a bool`)
+		}
+		annotation.Meta = meta
+	}
+
+	return annotation, nil
+}
+
+// extractReplaySettings parses the "replay" section of the pipeline settings, it returns nil if there is no section.
+func extractReplaySettings(replayJSON *simplejson.Json) (*pipeline.ReplaySettings, error) {
+	if replayJSON.Interface() == nil {
+		return nil, nil
+	}
+	if replayJSON.MustMap() == nil {
+		return nil, errors.New(`"replay" must be an object`)
+	}
+
+	replay := &pipeline.ReplaySettings{}
+	if fieldJSON, has := replayJSON.CheckGet("annotation_field"); has {
+		field, err := fieldJSON.String()
+		if err != nil {
+			return nil, errors.New(`"replay.annotation_field" must be a string`)
+		}
+		replay.AnnotationField = cfg.ParseFieldSelector(field)
+	}
+
+	doIfChecker, err := extractDoIfChecker(replayJSON.Get("do_if"))
+	if err != nil {
+		return nil, fmt.Errorf(`can't parse "replay.do_if": %w`, err)
+	}
+	replay.DoIf = doIfChecker
+
+	if rateJSON, has := replayJSON.CheckGet("rate"); has {
+		rate, err := rateJSON.Int()
+		if err != nil || rate < 0 {
+			return nil, errors.New(`"replay.rate" must be a non-negative number`)
+		}
+		replay.Rate = rate
+	}
+
+	return replay, nil
+}
+
 func makeActionJSON(actionJSON *simplejson.Json) []byte {
 	actionJSON.Del("type")
 	actionJSON.Del("match_fields")
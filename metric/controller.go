@@ -1,6 +1,7 @@
 package metric
 
 import (
+	"errors"
 	"sync"
 	"time"
 
@@ -21,8 +22,10 @@ type Ctl struct {
 	subsystem string
 	register  *prometheus.Registry
 
-	holder                    *Holder
-	metrics                   map[string]prometheus.Collector
+	holder  *Holder
+	metrics map[string]prometheus.Collector
+	// reloadable is registered on the first reloadable metric, the unchecked collector can't be unregistered
+	reloadable                *reloadableCollector
 	metricMaxLabelValueLength int
 	mu                        sync.RWMutex
 }
@@ -126,6 +129,104 @@ func (mc *Ctl) RegisterHistogramVec(name, help string, buckets []float64, labels
 	return newHistogramVec(mc.registerMetric(name, histogramVec).(*prometheus.HistogramVec), mc.metricMaxLabelValueLength)
 }
 
+// RegisterReloadableCounterVec is the same as RegisterCounterVec,
+// but the metric can be registered again with the other labels or help after it's unregistered.
+func (mc *Ctl) RegisterReloadableCounterVec(name, help string, labels ...string) *CounterVec {
+	counterVec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: PromNamespace,
+		Subsystem: mc.subsystem,
+		Name:      name,
+		Help:      help,
+	}, labels)
+
+	return newCounterVec(mc.registerReloadableMetric(name, counterVec).(*prometheus.CounterVec), mc.metricMaxLabelValueLength)
+}
+
+// RegisterReloadableGaugeVec is the same as RegisterGaugeVec,
+// but the metric can be registered again with the other labels or help after it's unregistered.
+func (mc *Ctl) RegisterReloadableGaugeVec(name, help string, labels ...string) *GaugeVec {
+	gaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: PromNamespace,
+		Subsystem: mc.subsystem,
+		Name:      name,
+		Help:      help,
+	}, labels)
+
+	return newGaugeVec(mc.registerReloadableMetric(name, gaugeVec).(*prometheus.GaugeVec), mc.metricMaxLabelValueLength)
+}
+
+// RegisterReloadableHistogramVec is the same as RegisterHistogramVec,
+// but the metric can be registered again with the other labels, help or buckets after it's unregistered.
+func (mc *Ctl) RegisterReloadableHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	histogramVec := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: PromNamespace,
+		Subsystem: mc.subsystem,
+		Name:      name,
+		Help:      help,
+		Buckets:   buckets,
+	}, labels)
+
+	return newHistogramVec(mc.registerReloadableMetric(name, histogramVec).(*prometheus.HistogramVec), mc.metricMaxLabelValueLength)
+}
+
+// IsRegistered checks if the metric with the name is registered by the controller.
+func (mc *Ctl) IsRegistered(name string) bool {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+
+	_, has := mc.metrics[name]
+	return has
+}
+
+// Unregister removes the metric from the registry.
+func (mc *Ctl) Unregister(name string) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	metric, has := mc.metrics[name]
+	if !has {
+		return
+	}
+	mc.unregisterMetric(name, metric)
+}
+
+// UnregisterAll removes all the metrics of the controller from the registry.
+func (mc *Ctl) UnregisterAll() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	for name, metric := range mc.metrics {
+		mc.unregisterMetric(name, metric)
+	}
+}
+
+// unregisterMetric removes the metric from the registry or from the collector of the reloadable metrics,
+// it should be called under the lock.
+func (mc *Ctl) unregisterMetric(name string, metric prometheus.Collector) {
+	if mc.reloadable == nil || !mc.reloadable.remove(name) {
+		mc.register.Unregister(metric)
+	}
+	delete(mc.metrics, name)
+}
+
+func (mc *Ctl) registerReloadableMetric(name string, newMetric prometheus.Collector) prometheus.Collector {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	metric, has := mc.metrics[name]
+	if !has {
+		if mc.reloadable == nil {
+			mc.reloadable = newReloadableCollector()
+			mc.register.MustRegister(mc.reloadable)
+		}
+		metric = newMetric
+		mc.reloadable.add(name, metric)
+		mc.metrics[name] = metric
+	}
+
+	return metric
+}
+
 func (mc *Ctl) registerMetric(name string, newMetric prometheus.Collector) prometheus.Collector {
 	mc.mu.RLock()
 	metric, has := mc.metrics[name]
@@ -139,8 +240,16 @@ func (mc *Ctl) registerMetric(name string, newMetric prometheus.Collector) prome
 	metric, has = mc.metrics[name]
 	if !has {
 		metric = newMetric
+		err := mc.register.Register(metric)
+		// the metric is registered by another controller with the same subsystem,
+		// e.g. by the previous instance of the reloaded pipeline
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if errors.As(err, &alreadyRegistered) {
+			metric = alreadyRegistered.ExistingCollector
+		} else if err != nil {
+			panic(err)
+		}
 		mc.metrics[name] = metric
-		mc.register.MustRegister(metric)
 	}
 
 	return metric
@@ -81,6 +81,49 @@ func TestLabelTruncation(t *testing.T) {
 	r.Equal(float64(0), c.WithLabelValues("some_long_").ToFloat64())
 }
 
+func TestUnregisterAll(t *testing.T) {
+	r := require.New(t)
+
+	registry := prometheus.NewRegistry()
+	ctl := NewCtl("test", registry, 0, 0)
+	ctl.RegisterCounter("events", "").Inc()
+	ctl.RegisterReloadableGaugeVec("size", "", "name").WithLabelValues("a").Set(1)
+
+	families, err := registry.Gather()
+	r.NoError(err)
+	r.Len(families, 2)
+
+	ctl.UnregisterAll()
+	r.False(ctl.IsRegistered("events"))
+	families, err = registry.Gather()
+	r.NoError(err)
+	r.Empty(families)
+
+	// the metrics can be registered again
+	NewCtl("test", registry, 0, 0).RegisterCounter("events", "").Inc()
+	families, err = registry.Gather()
+	r.NoError(err)
+	r.Len(families, 1)
+}
+
+func TestReloadable(t *testing.T) {
+	r := require.New(t)
+
+	registry := prometheus.NewRegistry()
+	ctl := NewCtl("test", registry, 0, 0)
+	ctl.RegisterReloadableGaugeVec("size", "", "name").WithLabelValues("a").Set(1)
+	ctl.Unregister("size")
+
+	// the controller of the reloaded pipeline registers the metric with the other labels
+	reloaded := NewCtl("test", registry, 0, 0)
+	reloaded.RegisterReloadableGaugeVec("size", "Size", "name", "kind").WithLabelValues("a", "b").Set(1)
+
+	families, err := registry.Gather()
+	r.NoError(err)
+	r.Len(families, 1)
+	r.Len(families[0].GetMetric()[0].GetLabel(), 2)
+}
+
 var holderBenchCases = []struct {
 	Labels      []string
 	LabelValues [][]string
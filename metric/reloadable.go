@@ -0,0 +1,50 @@
+package metric
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// reloadableCollector collects the reloadable metrics of the controller.
+// It's registered as the unchecked collector, so the registry doesn't keep the descriptors of its metrics
+// and they can be registered again with the other labels or help, e.g. by the controller of the reloaded pipeline.
+// The previous pipeline unregisters its metrics on stop before the reloaded one registers them,
+// so the collectors of the controllers don't collect the same metric.
+type reloadableCollector struct {
+	mu      sync.RWMutex
+	metrics map[string]prometheus.Collector // name -> metric
+}
+
+func newReloadableCollector() *reloadableCollector {
+	return &reloadableCollector{metrics: make(map[string]prometheus.Collector)}
+}
+
+// Describe sends no descriptors, so the collector is unchecked.
+func (c *reloadableCollector) Describe(_ chan<- *prometheus.Desc) {}
+
+func (c *reloadableCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, metric := range c.metrics {
+		metric.Collect(ch)
+	}
+}
+
+func (c *reloadableCollector) add(name string, metric prometheus.Collector) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.metrics[name] = metric
+}
+
+// remove deletes the metric, it returns false if the metric isn't reloadable.
+func (c *reloadableCollector) remove(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, has := c.metrics[name]
+	delete(c.metrics, name)
+	return has
+}
@@ -12,7 +12,7 @@ type RetriableBatcher struct {
 	batcher              *Batcher
 	backoffOpts          BackoffOpts
 	isDeadQueueAvailable bool
-	onRetryError         func(err error, events []*Event)
+	onRetryError         func(failure *Failure)
 }
 
 type RetriableBatcherOutFn func(*WorkerData, *Batch) error
@@ -24,7 +24,7 @@ type BackoffOpts struct {
 	IsDeadQueueAvailable bool
 }
 
-func NewRetriableBatcher(batcherOpts *BatcherOptions, batcherOutFn RetriableBatcherOutFn, opts BackoffOpts, onError func(err error, events []*Event)) *RetriableBatcher {
+func NewRetriableBatcher(batcherOpts *BatcherOptions, batcherOutFn RetriableBatcherOutFn, opts BackoffOpts, onError func(failure *Failure)) *RetriableBatcher {
 	batcherBackoff := &RetriableBatcher{
 		outFn:                batcherOutFn,
 		backoffOpts:          opts,
@@ -61,11 +61,15 @@ func (b *RetriableBatcher) Out(data *WorkerData, batch *Batch) {
 		}
 		next := exponentionalBackoff.NextBackOff()
 		if next == backoff.Stop || (b.backoffOpts.AttemptNum >= 0 && numTries > b.backoffOpts.AttemptNum) {
-			var events []*Event
+			failure := &Failure{
+				Err:     err,
+				Retries: numTries,
+			}
 			if batch != nil {
-				events = batch.events
+				failure.Events = batch.events
+				failure.BatchID = batch.seq
 			}
-			b.onRetryError(err, events)
+			b.onRetryError(failure)
 			if batch != nil && b.isDeadQueueAvailable {
 				batch.reset()
 				batch.status = BatchStatusInDeadQueue
@@ -18,7 +18,7 @@ func TestBackoff(t *testing.T) {
 	eventCount := &atomic.Int32{}
 	eventCountBefore := eventCount.Load()
 
-	errorFn := func(err error, events []*Event) {
+	errorFn := func(failure *Failure) {
 		errorCount.Inc()
 	}
 
@@ -48,7 +48,7 @@ func TestBackoff(t *testing.T) {
 func TestBackoffWithError(t *testing.T) {
 	errorCount := &atomic.Int32{}
 	prevValue := errorCount.Load()
-	errorFn := func(err error, events []*Event) {
+	errorFn := func(failure *Failure) {
 		errorCount.Inc()
 	}
 
@@ -78,7 +78,7 @@ func TestBackoffWithError(t *testing.T) {
 func TestBackoffWithErrorWithDeadQueue(t *testing.T) {
 	errorCount := &atomic.Int32{}
 	prevValue := errorCount.Load()
-	errorFn := func(err error, events []*Event) {
+	errorFn := func(failure *Failure) {
 		errorCount.Inc()
 	}
 
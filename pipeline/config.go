@@ -13,5 +13,19 @@ func GetConfig(info *PluginStaticInfo, configJson []byte, values map[string]int)
 		return nil, err
 	}
 
+	if validatable, ok := config.(ValidatableConfig); ok {
+		if err := validatable.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
 	return config, nil
 }
+
+// ValidatePipelineConfig checks the plugin config of the pipeline if the config depends on the pipeline.
+func ValidatePipelineConfig(config AnyConfig, pipelineName string) error {
+	if validatable, ok := config.(PipelineValidatableConfig); ok {
+		return validatable.ValidatePipeline(pipelineName)
+	}
+	return nil
+}
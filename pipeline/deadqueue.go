@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"strconv"
+	"time"
+)
+
+// The names of the annotations of the dead queue events.
+// The metadata keys have the DeadQueueMetaPrefix prefix.
+const (
+	DeadQueueMetaPrefix = "deadqueue_"
+
+	DeadQueueAnnotationOutput    = "output"
+	DeadQueueAnnotationError     = "error"
+	DeadQueueAnnotationRetries   = "retries"
+	DeadQueueAnnotationBatchID   = "batch_id"
+	DeadQueueAnnotationTimestamp = "timestamp"
+)
+
+// Failure is the batch of the events which the output has failed to send after all the retries.
+type Failure struct {
+	Events  []*Event
+	Err     error
+	Retries int
+	// BatchID is the sequence number of the batch in the output.
+	BatchID int64
+}
+
+// DeadQueueAnnotation adds the info about the failure to the events passed to the dead queue.
+type DeadQueueAnnotation struct {
+	// Field is the path of the object field with the annotations, the events aren't changed if it's empty.
+	Field []string
+	// Meta enables the annotations in the event metadata.
+	Meta bool
+}
+
+func (a *DeadQueueAnnotation) isEnabled() bool {
+	return a != nil && (len(a.Field) > 0 || a.Meta)
+}
+
+// annotate adds the annotations to the event.
+func (a *DeadQueueAnnotation) annotate(event *Event, output string, failure *Failure, now time.Time) {
+	errText := ""
+	if failure.Err != nil {
+		errText = failure.Err.Error()
+	}
+	timestamp := now.Format(time.RFC3339Nano)
+
+	if len(a.Field) > 0 && event.Root != nil {
+		node := CreateNestedField(event.Root, a.Field)
+		node.AddFieldNoAlloc(event.Root, DeadQueueAnnotationOutput).MutateToString(output)
+		node.AddFieldNoAlloc(event.Root, DeadQueueAnnotationError).MutateToString(errText)
+		node.AddFieldNoAlloc(event.Root, DeadQueueAnnotationRetries).MutateToInt(failure.Retries)
+		node.AddFieldNoAlloc(event.Root, DeadQueueAnnotationBatchID).MutateToInt64(failure.BatchID)
+		node.AddFieldNoAlloc(event.Root, DeadQueueAnnotationTimestamp).MutateToString(timestamp)
+	}
+
+	if a.Meta {
+		event.SetMeta(DeadQueueMetaPrefix+DeadQueueAnnotationOutput, output)
+		event.SetMeta(DeadQueueMetaPrefix+DeadQueueAnnotationError, errText)
+		event.SetMeta(DeadQueueMetaPrefix+DeadQueueAnnotationRetries, strconv.Itoa(failure.Retries))
+		event.SetMeta(DeadQueueMetaPrefix+DeadQueueAnnotationBatchID, strconv.FormatInt(failure.BatchID, 10))
+		event.SetMeta(DeadQueueMetaPrefix+DeadQueueAnnotationTimestamp, timestamp)
+	}
+}
@@ -0,0 +1,115 @@
+package pipeline
+
+import (
+	"github.com/ozontech/file.d/cfg"
+)
+
+// Description is the resolved config and the runtime state of the pipeline shown by the admin API.
+// The secrets of the plugin configs are redacted.
+type Description struct {
+	Name     string               `json:"name"`
+	Settings SettingsDescription  `json:"settings"`
+	State    StateDescription     `json:"state"`
+	Input    *PluginDescription   `json:"input"`
+	Actions  []*PluginDescription `json:"actions"`
+	Outputs  []*PluginDescription `json:"outputs"`
+}
+
+type SettingsDescription struct {
+	Capacity            int    `json:"capacity"`
+	Decoder             string `json:"decoder"`
+	StreamField         string `json:"stream_field"`
+	MaintenanceInterval string `json:"maintenance_interval"`
+	EventTimeout        string `json:"event_timeout"`
+	AvgEventSize        int    `json:"avg_log_size"`
+	MaxEventSize        int    `json:"max_event_size"`
+	AntispamThreshold   int    `json:"antispam_threshold"`
+	MetaOutOfBand       bool   `json:"meta_out_of_band"`
+	EventTimeField      string `json:"event_time_field,omitempty"`
+	Pool                string `json:"pool,omitempty"`
+	SpillQueueDir       string `json:"spill_queue_dir,omitempty"`
+	IsStrict            bool   `json:"is_strict"`
+}
+
+type StateDescription struct {
+	Started      bool  `json:"started"`
+	Draining     bool  `json:"draining"`
+	Paused       bool  `json:"paused"`
+	InUseEvents  int64 `json:"in_use_events"`
+	Procs        int32 `json:"procs"`
+	ActiveProcs  int32 `json:"active_procs"`
+	InputEvents  int64 `json:"input_events"`
+	InputSize    int64 `json:"input_size"`
+	OutputEvents int64 `json:"output_events"`
+	OutputSize   int64 `json:"output_size"`
+}
+
+type PluginDescription struct {
+	Type       string             `json:"type"`
+	Config     any                `json:"config"`
+	MetricName string             `json:"metric_name,omitempty"`
+	DeadQueue  *PluginDescription `json:"deadqueue,omitempty"`
+}
+
+// Describe returns the description of the pipeline.
+func (p *Pipeline) Describe() *Description {
+	d := &Description{
+		Name: p.Name,
+		Settings: SettingsDescription{
+			Capacity:            p.settings.Capacity,
+			Decoder:             p.settings.Decoder,
+			StreamField:         p.settings.StreamField,
+			MaintenanceInterval: p.settings.MaintenanceInterval.String(),
+			EventTimeout:        p.settings.EventTimeout.String(),
+			AvgEventSize:        p.settings.AvgEventSize,
+			MaxEventSize:        p.settings.MaxEventSize,
+			AntispamThreshold:   p.settings.Antispam.Threshold,
+			MetaOutOfBand:       p.settings.MetaOutOfBand,
+			EventTimeField:      p.settings.EventTimeField,
+			Pool:                string(p.settings.Pool),
+			SpillQueueDir:       p.settings.SpillQueue.Dir,
+			IsStrict:            p.settings.IsStrict,
+		},
+		State: StateDescription{
+			Started:      p.started.Load(),
+			Draining:     p.draining.Load(),
+			Paused:       p.IsPaused(),
+			InUseEvents:  p.eventPool.inUse(),
+			InputEvents:  p.inputEvents.Load(),
+			InputSize:    p.inputSize.Load(),
+			OutputEvents: p.outputEvents.Load(),
+			OutputSize:   p.outputSize.Load(),
+		},
+		Actions: make([]*PluginDescription, 0, len(p.actionInfos)),
+		Outputs: make([]*PluginDescription, 0),
+	}
+	if p.procCount != nil {
+		d.State.Procs = p.procCount.Load()
+		d.State.ActiveProcs = p.activeProcs.Load()
+	}
+
+	if p.inputInfo != nil {
+		d.Input = describePlugin(p.inputInfo.PluginStaticInfo)
+	}
+	for _, info := range p.actionInfos {
+		action := describePlugin(info.PluginStaticInfo)
+		action.MetricName = info.MetricName
+		d.Actions = append(d.Actions, action)
+	}
+	for _, route := range p.router.outputRouters() {
+		output := describePlugin(route.outputInfo.PluginStaticInfo)
+		if route.deadQueueInfo != nil {
+			output.DeadQueue = describePlugin(route.deadQueueInfo.PluginStaticInfo)
+		}
+		d.Outputs = append(d.Outputs, output)
+	}
+
+	return d
+}
+
+func describePlugin(info *PluginStaticInfo) *PluginDescription {
+	return &PluginDescription{
+		Type:   info.Type,
+		Config: cfg.RedactedConfig(info.Config),
+	}
+}
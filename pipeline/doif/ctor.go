@@ -12,6 +12,10 @@ const (
 
 	fieldNameCaseSensitive = "case_sensitive"
 
+	fieldNameData = "data"
+	dataEventTag  = "event"
+	dataMetaTag   = "meta"
+
 	fieldNameValues = "values"
 
 	fieldNameCmpOp    = "cmp_op"
@@ -83,12 +87,26 @@ func extractFieldOpNode(opName string, node map[string]any) (Node, error) {
 		return nil, err
 	}
 
+	fromMeta := false
+	data, err := get[string](node, fieldNameData)
+	if err == nil {
+		switch data {
+		case dataEventTag:
+		case dataMetaTag:
+			fromMeta = true
+		default:
+			return nil, fmt.Errorf("unknown field op data %q", data)
+		}
+	} else if errors.Is(err, errTypeMismatch) {
+		return nil, err
+	}
+
 	vals, err := extractOpValues(node)
 	if err != nil {
 		return nil, fmt.Errorf("extract field op values: %w", err)
 	}
 
-	result, err = NewFieldOpNode(opName, fieldPath, caseSensitive, vals)
+	result, err = newFieldOpNode(opName, fieldPath, caseSensitive, fromMeta, vals)
 	if err != nil {
 		return nil, fmt.Errorf("init field op: %w", err)
 	}
@@ -408,6 +408,17 @@ func Test_extractDoIfChecker(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "error_invalid_field_op_data",
+			args: args{
+				cfgStr: `{
+					"op": "equal",
+					"field": "a",
+					"values": ["abc"],
+					"data": "body"}`,
+			},
+			wantErr: true,
+		},
 		{
 			name: "error_invalid_logical_op",
 			args: args{
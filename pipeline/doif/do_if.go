@@ -28,6 +28,12 @@ type Data interface {
 	Get(...string) []byte
 }
 
+// MetaData is the Data which also provides the out-of-band event metadata.
+type MetaData interface {
+	Data
+	GetMeta(key string) []byte
+}
+
 type Node interface {
 	Type() NodeType
 	Check(Data) bool
@@ -1958,3 +1958,32 @@ func TestNodeIsEqual(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckMeta(t *testing.T) {
+	metaNode, err := NewMetaFieldOpNode("equal", "k8s.tenant", true, [][]byte{[]byte("test"), []byte("")})
+	require.NoError(t, err)
+	eventNode, err := NewFieldOpNode("equal", "k8s.tenant", true, [][]byte{[]byte("test")})
+	require.NoError(t, err)
+
+	eventRoot, err := insaneJSON.DecodeString(`{"k8s":{"tenant":"test"}}`)
+	require.NoError(t, err)
+
+	tests := []struct {
+		meta      map[string]string
+		metaCheck bool
+	}{
+		{meta: map[string]string{"k8s.tenant": "test"}, metaCheck: true},
+		{meta: map[string]string{"k8s.tenant": ""}, metaCheck: true},
+		{meta: map[string]string{"k8s.tenant": "other"}, metaCheck: false},
+		{meta: nil, metaCheck: false},
+	}
+	for index, test := range tests {
+		data := NewEventDataWithMeta(eventRoot, test.meta)
+		require.Equal(t, test.metaCheck, newChecker(metaNode).Check(data), "invalid meta result; test id: %d", index)
+		require.True(t, newChecker(eventNode).Check(data), "invalid event result; test id: %d", index)
+	}
+
+	// the data without metadata never matches the meta node
+	require.False(t, newChecker(metaNode).Check(NewEventData(eventRoot)))
+	require.Error(t, metaNode.isEqualTo(eventNode, 1))
+}
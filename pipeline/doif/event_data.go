@@ -1,17 +1,34 @@
 package doif
 
-import insaneJSON "github.com/ozontech/insane-json"
+import (
+	"unsafe"
+
+	insaneJSON "github.com/ozontech/insane-json"
+)
 
 type eventData struct {
 	root *insaneJSON.Root
 }
 
+type eventMetaData struct {
+	eventData
+	meta map[string]string
+}
+
 func NewEventData(root *insaneJSON.Root) eventData {
 	return eventData{
 		root: root,
 	}
 }
 
+// NewEventDataWithMeta returns the data which also checks the event metadata in the `meta` field op nodes.
+func NewEventDataWithMeta(root *insaneJSON.Root, meta map[string]string) eventMetaData {
+	return eventMetaData{
+		eventData: eventData{root: root},
+		meta:      meta,
+	}
+}
+
 func (d eventData) Get(path ...string) []byte {
 	var data []byte
 	if d.root == nil {
@@ -26,3 +43,16 @@ func (d eventData) Get(path ...string) []byte {
 	}
 	return data
 }
+
+func (d eventMetaData) GetMeta(key string) []byte {
+	value, ok := d.meta[key]
+	if !ok {
+		return nil
+	}
+	if value == "" {
+		// empty value differs from the absent one
+		return []byte{}
+	}
+	// the value isn't modified by the nodes, so there is no need to copy it
+	return unsafe.Slice(unsafe.StringData(value), len(value))
+}
@@ -197,6 +197,8 @@ Params:
   - `values` - list of values to check field. Required non-empty.
   - `case_sensitive` - flag indicating whether checks are performed in case sensitive way. Default `true`.
     Note: case insensitive checks can cause CPU and memory overhead since every field value will be converted to lower letters.
+  - `data` - where the field is looked up: `event` for the event JSON or `meta` for the out-of-band event metadata.
+  In the `meta` mode the `field` is the metadata key as is, without splitting by dots. Default `event`.
 
 Example:
 ```yaml
@@ -209,6 +211,12 @@ pipelines:
           field: pod
           values: [pod-1, pod-2]
           case_sensitive: true
+      - type: discard
+        do_if:
+          op: equal
+          data: meta
+          field: tenant
+          values: [test]
 ```
 }*/
 
@@ -217,6 +225,7 @@ type fieldOpNode struct {
 	fieldPath     []string
 	fieldPathStr  string
 	caseSensitive bool
+	fromMeta      bool
 	values        [][]byte
 	valuesBySize  map[int][][]byte
 	reValues      []*regexp.Regexp
@@ -226,6 +235,15 @@ type fieldOpNode struct {
 }
 
 func NewFieldOpNode(op string, field string, caseSensitive bool, values [][]byte) (Node, error) {
+	return newFieldOpNode(op, field, caseSensitive, false, values)
+}
+
+// NewMetaFieldOpNode creates the field op node which checks the value of the event metadata key.
+func NewMetaFieldOpNode(op string, key string, caseSensitive bool, values [][]byte) (Node, error) {
+	return newFieldOpNode(op, key, caseSensitive, true, values)
+}
+
+func newFieldOpNode(op string, field string, caseSensitive bool, fromMeta bool, values [][]byte) (Node, error) {
 	if len(values) == 0 {
 		return nil, errors.New("values are not provided")
 	}
@@ -235,7 +253,10 @@ func NewFieldOpNode(op string, field string, caseSensitive bool, values [][]byte
 	var minValLen, maxValLen int
 	var fop fieldOpType
 
-	fieldPath := cfg.ParseFieldSelector(field)
+	var fieldPath []string
+	if !fromMeta {
+		fieldPath = cfg.ParseFieldSelector(field)
+	}
 
 	switch op {
 	case fieldEqualOpTag:
@@ -301,6 +322,7 @@ func NewFieldOpNode(op string, field string, caseSensitive bool, values [][]byte
 		fieldPath:     fieldPath,
 		fieldPathStr:  field,
 		caseSensitive: caseSensitive,
+		fromMeta:      fromMeta,
 		values:        vals,
 		valuesBySize:  valsBySize,
 		reValues:      reValues,
@@ -313,8 +335,19 @@ func (n *fieldOpNode) Type() NodeType {
 	return NodeFieldOp
 }
 
+func (n *fieldOpNode) getData(data Data) []byte {
+	if !n.fromMeta {
+		return data.Get(n.fieldPath...)
+	}
+	metaData, ok := data.(MetaData)
+	if !ok {
+		return nil
+	}
+	return metaData.GetMeta(n.fieldPathStr)
+}
+
 func (n *fieldOpNode) Check(data Data) bool {
-	eventData := data.Get(n.fieldPath...)
+	eventData := n.getData(data)
 	// fast check for data
 	if n.op != fieldRegexOp && n.op != fieldContainsAnyOp &&
 		len(eventData) < n.minValLen {
@@ -400,6 +433,9 @@ func (n *fieldOpNode) isEqualTo(n2 Node, _ int) error {
 	if n.caseSensitive != n2f.caseSensitive {
 		return fmt.Errorf("nodes have different caseSensitive expected: %v", n.caseSensitive)
 	}
+	if n.fromMeta != n2f.fromMeta {
+		return fmt.Errorf("nodes have different fromMeta expected: %v", n.fromMeta)
+	}
 	if n.fieldPathStr != n2f.fieldPathStr || slices.Compare(n.fieldPath, n2f.fieldPath) != 0 {
 		return fmt.Errorf("nodes have different fieldPathStr expected: fieldPathStr=%q fieldPath=%v",
 			n.fieldPathStr, n.fieldPath,
@@ -2,12 +2,14 @@ package pipeline
 
 import (
 	"fmt"
+	"maps"
 	"math/bits"
 	"runtime"
 	"sync"
 	"time"
 
 	"github.com/ozontech/file.d/logger"
+	"github.com/ozontech/file.d/pipeline/metadata"
 	insaneJSON "github.com/ozontech/insane-json"
 	"go.uber.org/atomic"
 )
@@ -27,11 +29,28 @@ type Event struct {
 	streamName StreamName
 	// Size in bytes of the raw event before any action plugin.
 	Size int
+	// Meta is the out-of-band metadata of the event, it isn't written to the event JSON.
+	// It's filled by the input and can be changed by the actions and used by the outputs.
+	Meta metadata.MetaData
+	// inTime is the time the event has been passed to the pipeline by the input,
+	// it's used to measure the end-to-end latency of the event.
+	inTime time.Time
+	// emitted is set for the events created by the actions with Emitter, they aren't committed to the input.
+	emitted bool
 
 	action int
 	next   *Event
 	stream *stream
 
+	// pendingAcks is the count of outputs that haven't committed the event yet,
+	// it's used only if the pipeline has several outputs.
+	pendingAcks atomic.Int32
+	// origin is set for the copy of the event passed to one of the outputs, see outputCopy.
+	origin *Event
+	// collapsedOffsets are the offsets of the events collapsed by the action holding the event,
+	// they are committed with the event.
+	collapsedOffsets []int64
+
 	// some debugging shit
 	stage eventStage
 }
@@ -52,6 +71,8 @@ const (
 	eventKindChildParent
 	EventKindTimeout
 	EventKindUnlock
+	// eventKindSpilled is the kind of the events read from the spill queue, they aren't from the event pool.
+	eventKindSpilled
 )
 
 func (k Kind) String() string {
@@ -66,6 +87,8 @@ func (k Kind) String() string {
 		return "CHILD"
 	case EventKindUnlock:
 		return "UNLOCK"
+	case eventKindSpilled:
+		return "SPILLED"
 	}
 	return "UNKNOWN"
 }
@@ -115,6 +138,33 @@ func (e *Event) reset() {
 	e.stream = nil
 	e.children = e.children[:0]
 	e.kind = EventKindRegular
+	e.emitted = false
+	e.collapsedOffsets = e.collapsedOffsets[:0]
+	clear(e.Meta)
+}
+
+// CollapsedOffsets returns the offsets of the events of the same source collapsed into the event,
+// e.g. by the join action. Such events aren't committed themselves, the input should commit them with the event.
+func (e *Event) CollapsedOffsets() []int64 {
+	return e.collapsedOffsets
+}
+
+// SetMeta sets the metadata value of the event.
+// The value must not reference the event JSON since the event can be reused.
+func (e *Event) SetMeta(key, value string) {
+	if e.Meta == nil {
+		e.Meta = make(metadata.MetaData)
+	}
+	e.Meta[key] = value
+}
+
+func (e *Event) GetMeta(key string) (string, bool) {
+	value, ok := e.Meta[key]
+	return value, ok
+}
+
+func (e *Event) DeleteMeta(key string) {
+	delete(e.Meta, key)
 }
 
 func (e *Event) StreamNameBytes() []byte {
@@ -161,6 +211,37 @@ func (e *Event) IsChildParentKind() bool {
 	return e.kind == eventKindChildParent
 }
 
+func (e *Event) isSpilledKind() bool {
+	return e.kind == eventKindSpilled
+}
+
+// outputCopy copies the event for one of the outputs, so the output can change the copy
+// while the other outputs of the pipeline still use the original event.
+// The commit of the copy is the commit of the original event.
+func (e *Event) outputCopy() *Event {
+	root, err := insaneJSON.DecodeBytes(e.Root.Encode(nil))
+	if err != nil {
+		// the event JSON is always valid, so it's unreachable
+		root = insaneJSON.Spawn()
+	}
+
+	return &Event{
+		kind:       e.kind,
+		Root:       root,
+		SeqID:      e.SeqID,
+		Offset:     e.Offset,
+		SourceID:   e.SourceID,
+		SourceName: e.SourceName,
+		streamName: e.streamName,
+		Size:       e.Size,
+		Meta:       maps.Clone(e.Meta),
+		inTime:     e.inTime,
+		stream:     e.stream,
+		stage:      e.stage,
+		origin:     e,
+	}
+}
+
 func (e *Event) Encode(outBuf []byte) ([]byte, int) {
 	l := len(outBuf)
 	outBuf = e.Root.Encode(outBuf)
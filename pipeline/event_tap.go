@@ -0,0 +1,142 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ozontech/file.d/pipeline/doif"
+	"go.uber.org/atomic"
+)
+
+const (
+	defaultTapRate   = 10
+	maxTapRate       = 1000
+	tapBufferSize    = 256
+	tapFlushInterval = time.Second
+)
+
+// eventTap streams the events passed by the actions to the `/tap` endpoint subscribers.
+// It's shared by all the processors of the pipeline.
+type eventTap struct {
+	// subscribers is the map of actionIndex to the subscribers of this action.
+	subscribers map[int][]*tapSubscriber
+	// subscribersLen is needed for not locking the processor in case of nobody listens the tap.
+	subscribersLen *atomic.Int64
+	mu             sync.RWMutex
+}
+
+// tapSubscriber receives the encoded events of the action,
+// the events are dropped if the subscriber doesn't keep up or exceeds the rate.
+type tapSubscriber struct {
+	ch      chan []byte
+	checker *doif.Checker
+
+	rate        int
+	windowStart time.Time
+	windowCount int
+	mu          sync.Mutex
+
+	dropped *atomic.Uint64
+}
+
+type tapEvent struct {
+	ProcessorID int               `json:"processor_id"`
+	Event       json.RawMessage   `json:"event"`
+	Meta        map[string]string `json:"meta,omitempty"`
+}
+
+func newEventTap() *eventTap {
+	return &eventTap{
+		subscribers:    make(map[int][]*tapSubscriber),
+		subscribersLen: atomic.NewInt64(0),
+	}
+}
+
+// subscribe adds the subscriber of the action with the optional do_if filter
+// and the cap of the events per second.
+func (t *eventTap) subscribe(actionIdx int, checker *doif.Checker, rate int) *tapSubscriber {
+	s := &tapSubscriber{
+		ch:      make(chan []byte, tapBufferSize),
+		checker: checker,
+		rate:    rate,
+		dropped: atomic.NewUint64(0),
+	}
+
+	t.mu.Lock()
+	t.subscribers[actionIdx] = append(t.subscribers[actionIdx], s)
+	t.subscribersLen.Inc()
+	t.mu.Unlock()
+
+	return s
+}
+
+func (t *eventTap) unsubscribe(actionIdx int, subscriber *tapSubscriber) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	subscribers := t.subscribers[actionIdx]
+	for i, s := range subscribers {
+		if s != subscriber {
+			continue
+		}
+
+		subscribers[i] = subscribers[len(subscribers)-1]
+		subscribers[len(subscribers)-1] = nil
+		t.subscribers[actionIdx] = subscribers[:len(subscribers)-1]
+		t.subscribersLen.Dec()
+		return
+	}
+}
+
+// emit passes the event left the action to the subscribers of the action.
+func (t *eventTap) emit(procID int, actionIdx int, event *Event) {
+	if t == nil || t.subscribersLen.Load() <= 0 || event.IsTimeoutKind() {
+		return
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var data []byte
+	for _, s := range t.subscribers[actionIdx] {
+		if s.checker != nil && !s.checker.Check(doif.NewEventDataWithMeta(event.Root, event.Meta)) {
+			continue
+		}
+		if !s.allow(time.Now()) {
+			s.dropped.Inc()
+			continue
+		}
+
+		// the event is encoded once for all the subscribers
+		if data == nil {
+			data, _ = json.Marshal(tapEvent{
+				ProcessorID: procID,
+				Event:       event.Root.EncodeToByte(),
+				Meta:        event.Meta,
+			})
+		}
+
+		select {
+		case s.ch <- data:
+		default:
+			s.dropped.Inc()
+		}
+	}
+}
+
+// allow checks if the subscriber hasn't exceeded the rate in the current second.
+func (s *tapSubscriber) allow(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.windowStart) >= time.Second {
+		s.windowStart = now
+		s.windowCount = 0
+	}
+	if s.windowCount >= s.rate {
+		return false
+	}
+	s.windowCount++
+	return true
+}
@@ -0,0 +1,112 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/pipeline/doif"
+	insaneJSON "github.com/ozontech/insane-json"
+	"github.com/stretchr/testify/require"
+)
+
+func newTapTestEvent(t *testing.T, data string) *Event {
+	root, err := insaneJSON.DecodeString(data)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		insaneJSON.Release(root)
+	})
+	return &Event{Root: root}
+}
+
+func TestEventTapEmit(t *testing.T) {
+	tap := newEventTap()
+	checker, err := doif.NewFromMap(map[string]any{
+		"op":     "equal",
+		"field":  "level",
+		"values": []any{"error"},
+	})
+	require.NoError(t, err)
+
+	subscriber := tap.subscribe(1, checker, 2)
+	for i := 0; i < 5; i++ {
+		tap.emit(0, 1, newTapTestEvent(t, `{"level":"error"}`))
+	}
+	tap.emit(0, 1, newTapTestEvent(t, `{"level":"info"}`))
+	tap.emit(0, 0, newTapTestEvent(t, `{"level":"error"}`))
+
+	require.Len(t, subscriber.ch, 2, "the rate must be capped")
+	require.Equal(t, uint64(3), subscriber.dropped.Load())
+	require.JSONEq(t, `{"processor_id":0,"event":{"level":"error"}}`, string(<-subscriber.ch))
+
+	tap.unsubscribe(1, subscriber)
+	require.Equal(t, int64(0), tap.subscribersLen.Load())
+	tap.emit(0, 1, newTapTestEvent(t, `{"level":"error"}`))
+	require.Len(t, subscriber.ch, 1)
+}
+
+func TestServeActionTap(t *testing.T) {
+	p := &Pipeline{eventTap: newEventTap()}
+	handler := p.serveActionTap(0)
+
+	doIf := `{"op":"equal","field":"level","values":["error"]}`
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/tap?rate=100&do_if="+url.QueryEscape(doIf), http.NoBody).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		handler(rec, req)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		return p.eventTap.subscribersLen.Load() == 1
+	}, time.Second, time.Millisecond)
+
+	event := newTapTestEvent(t, `{"level":"info"}`)
+	event.SetMeta("tenant", "test")
+	p.eventTap.emit(1, 0, event)
+
+	event = newTapTestEvent(t, `{"level":"error"}`)
+	event.SetMeta("tenant", "test")
+	p.eventTap.emit(1, 0, event)
+
+	require.Eventually(t, func() bool {
+		return len(p.eventTap.subscribers[0][0].ch) == 0
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	require.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(strings.NewReader(rec.Body.String()))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.Len(t, lines, 1)
+
+	var tapped tapEvent
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &tapped))
+	require.Equal(t, 1, tapped.ProcessorID)
+	require.JSONEq(t, `{"level":"error"}`, string(tapped.Event))
+	require.Equal(t, map[string]string{"tenant": "test"}, tapped.Meta)
+	require.Equal(t, int64(0), p.eventTap.subscribersLen.Load())
+}
+
+func TestServeActionTapBadRequest(t *testing.T) {
+	p := &Pipeline{eventTap: newEventTap()}
+	handler := p.serveActionTap(0)
+
+	for _, query := range []string{"rate=0", "rate=abc", "do_if=" + url.QueryEscape(`{"op":"unknown"}`)} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/tap?"+query, http.NoBody))
+		require.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/xtime"
+)
+
+// eventLatency measures how long the events take from the input to the commit by the outputs.
+type eventLatency struct {
+	latencyMetric *metric.HistogramVec
+
+	// eventTimeField is set if the lag of the commit behind the event time is measured.
+	eventTimeField  []string
+	eventTimeFormat string
+	lagMetric       *metric.HistogramVec
+	lagErrorsMetric *metric.Counter
+}
+
+func newEventLatency(settings *Settings, metricCtl *metric.Ctl) *eventLatency {
+	l := &eventLatency{
+		latencyMetric: metricCtl.RegisterHistogramVec(
+			"event_latency_seconds",
+			"Time from the event input to its commit by the output",
+			metric.SecondsBucketsLong,
+			"output", "output_index",
+		),
+	}
+
+	if settings.EventTimeField == "" {
+		return l
+	}
+
+	l.eventTimeField = cfg.ParseFieldSelector(settings.EventTimeField)
+	l.eventTimeFormat = settings.EventTimeFormat
+	if l.eventTimeFormat == "" {
+		l.eventTimeFormat = time.RFC3339Nano
+	}
+	l.lagMetric = metricCtl.RegisterHistogramVec(
+		"event_time_lag_seconds",
+		"Time from the event time to its commit by the output",
+		metric.SecondsBucketsLong,
+		"output", "output_index",
+	)
+	l.lagErrorsMetric = metricCtl.RegisterCounter(
+		"event_time_lag_errors_total",
+		"Count of committed events without the valid event time",
+	)
+	return l
+}
+
+// controller returns the controller of the output which observes the latency of the committed events.
+func (l *eventLatency) controller(controller OutputPluginController, outputType string, outputIndex int) OutputPluginController {
+	c := &latencyController{
+		OutputPluginController: controller,
+		eventLatency:           l,
+		latency:                l.latencyMetric.WithLabelValues(outputType, strconv.Itoa(outputIndex)),
+	}
+	if l.lagMetric != nil {
+		c.lag = l.lagMetric.WithLabelValues(outputType, strconv.Itoa(outputIndex))
+	}
+	return c
+}
+
+type latencyController struct {
+	OutputPluginController
+	*eventLatency
+
+	latency *metric.Histogram
+	lag     *metric.Histogram
+}
+
+func (c *latencyController) Commit(event *Event) {
+	// the event can't be used after the commit
+	c.observe(event, time.Now())
+	c.OutputPluginController.Commit(event)
+}
+
+func (c *latencyController) observe(event *Event, now time.Time) {
+	if !event.inTime.IsZero() {
+		c.latency.Observe(now.Sub(event.inTime).Seconds())
+	}
+
+	if c.lag == nil || event.Root == nil {
+		return
+	}
+
+	node := event.Root.Dig(c.eventTimeField...)
+	if node == nil {
+		c.lagErrorsMetric.Inc()
+		return
+	}
+	eventTime, err := xtime.ParseTime(c.eventTimeFormat, node.AsString())
+	if err != nil {
+		c.lagErrorsMetric.Inc()
+		return
+	}
+	// the event time can be ahead of the local clock
+	c.lag.Observe(max(now.Sub(eventTime), 0).Seconds())
+}
@@ -0,0 +1,79 @@
+package pipeline
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/metric"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+type commitsCounter struct {
+	commits int
+}
+
+func (c *commitsCounter) Commit(_ *Event) {
+	c.commits++
+}
+
+func (c *commitsCounter) Error(_ string) {}
+
+func gatherHistograms(t *testing.T, registry *prometheus.Registry) map[string]*dto.Histogram {
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	histograms := make(map[string]*dto.Histogram)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			if m.GetHistogram() == nil {
+				continue
+			}
+			name := family.GetName()
+			for _, label := range m.GetLabel() {
+				name += "," + label.GetName() + "=" + label.GetValue()
+			}
+			histograms[name] = m.GetHistogram()
+		}
+	}
+	return histograms
+}
+
+func TestEventLatency(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metricCtl := metric.NewCtl("test", registry, time.Minute, 0)
+	latency := newEventLatency(&Settings{
+		EventTimeField:  "ts",
+		EventTimeFormat: "unixtime",
+	}, metricCtl)
+
+	counter := &commitsCounter{}
+	controller := latency.controller(counter, "clickhouse", 1)
+
+	now := time.Now()
+	events := []string{
+		`{"ts":` + strconv.FormatInt(now.Add(-30*time.Second).Unix(), 10) + `}`,
+		`{"ts":"wrong"}`,
+		`{}`,
+	}
+	for _, data := range events {
+		event := newTapTestEvent(t, data)
+		event.inTime = now.Add(-2 * time.Second)
+		controller.Commit(event)
+	}
+	require.Equal(t, len(events), counter.commits, "commits must be passed to the controller")
+
+	histograms := gatherHistograms(t, registry)
+	latencyHistogram := histograms["file_d_test_event_latency_seconds,output=clickhouse,output_index=1"]
+	require.NotNil(t, latencyHistogram)
+	require.Equal(t, uint64(len(events)), latencyHistogram.GetSampleCount())
+	require.GreaterOrEqual(t, latencyHistogram.GetSampleSum(), float64(3*2))
+
+	lagHistogram := histograms["file_d_test_event_time_lag_seconds,output=clickhouse,output_index=1"]
+	require.NotNil(t, lagHistogram)
+	require.Equal(t, uint64(1), lagHistogram.GetSampleCount())
+	require.InDelta(t, 30, lagHistogram.GetSampleSum(), 2)
+	require.Equal(t, float64(2), latency.lagErrorsMetric.ToFloat64())
+}
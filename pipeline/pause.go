@@ -0,0 +1,131 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ozontech/file.d/metric"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// pauser blocks the input events while the pipeline is paused.
+// The blocked events aren't accepted by the pipeline, so the input doesn't commit their offsets
+// and continues reading from the same place after the pipeline is resumed.
+type pauser struct {
+	paused   atomic.Bool
+	mu       sync.Mutex
+	resumeCh chan struct{} // it's closed on resume
+	since    time.Time
+
+	pausedMetric        *metric.Gauge
+	pausedSecondsMetric *metric.Counter
+}
+
+func newPauser(ctl *metric.Ctl) *pauser {
+	return &pauser{
+		pausedMetric:        ctl.RegisterGauge("paused", "Whether the pipeline input is paused via the HTTP API"),
+		pausedSecondsMetric: ctl.RegisterCounter("paused_seconds_total", "Total time the pipeline input was paused"),
+	}
+}
+
+// pause returns false if the pipeline is already paused.
+func (p *pauser) pause() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.resumeCh != nil {
+		return false
+	}
+	p.resumeCh = make(chan struct{})
+	p.since = time.Now()
+	p.paused.Store(true)
+	p.pausedMetric.Set(1)
+	return true
+}
+
+// resume returns false if the pipeline isn't paused.
+func (p *pauser) resume() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.resumeCh == nil {
+		return false
+	}
+	p.paused.Store(false)
+	close(p.resumeCh)
+	p.resumeCh = nil
+	p.pausedMetric.Set(0)
+	p.pausedSecondsMetric.Add(time.Since(p.since).Seconds())
+	return true
+}
+
+// wait blocks until the pipeline is resumed.
+func (p *pauser) wait() {
+	if !p.paused.Load() {
+		return
+	}
+
+	p.mu.Lock()
+	resumeCh := p.resumeCh
+	p.mu.Unlock()
+
+	if resumeCh != nil {
+		<-resumeCh
+	}
+}
+
+// Pause stops accepting the input events: the calls of InputPluginController.In block until the pipeline is resumed.
+// The events in-flight are processed and committed as usual.
+// It returns false if the pipeline is already paused.
+func (p *Pipeline) Pause() bool {
+	if !p.pauser.pause() {
+		return false
+	}
+	p.logger.Info("pipeline is paused")
+	return true
+}
+
+// Resume unblocks the input of the paused pipeline. It returns false if the pipeline isn't paused.
+func (p *Pipeline) Resume() bool {
+	if !p.pauser.resume() {
+		return false
+	}
+	p.logger.Info("pipeline is resumed")
+	return true
+}
+
+// IsPaused returns true if the pipeline is paused.
+func (p *Pipeline) IsPaused() bool {
+	return p.pauser.paused.Load()
+}
+
+// servePause creates a handlerFunc which pauses or resumes the pipeline.
+func (p *Pipeline) servePause(pause bool) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			writeErr(w, "only POST method is allowed")
+			return
+		}
+
+		if pause {
+			p.Pause()
+		} else {
+			p.Resume()
+		}
+
+		resp, _ := json.Marshal(map[string]bool{"paused": p.IsPaused()})
+		_, _ = w.Write(resp)
+	}
+}
+
+func (p *Pipeline) resumeOnStop(reason string) {
+	if p.pauser.resume() {
+		p.logger.Info("pipeline is resumed", zap.String("reason", reason))
+	}
+}
@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,7 +16,9 @@ import (
 	"github.com/ozontech/file.d/logger"
 	"github.com/ozontech/file.d/metric"
 	"github.com/ozontech/file.d/pipeline/antispam"
+	"github.com/ozontech/file.d/pipeline/doif"
 	"github.com/ozontech/file.d/pipeline/metadata"
+	"github.com/ozontech/file.d/pipeline/spill"
 	insaneJSON "github.com/ozontech/insane-json"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/atomic"
@@ -42,10 +45,20 @@ const (
 	DefaultMetricHoldDuration        = time.Minute * 30
 	DefaultMetaCacheSize             = 1024
 	DefaultMetricMaxLabelValueLength = 0
+	DefaultSpillQueueMaxSize         = 1024 * 1024 * 1024
+	DefaultSpillQueueSegmentSize     = 64 * 1024 * 1024
 
 	EventSeqIDError = uint64(0)
 
 	antispamUnbanIterations = 4
+
+	drainCheckInterval  = 50 * time.Millisecond
+	drainReportInterval = time.Second
+	// emitFlushTimeout is how long the stop waits for the events emitted by the flushed actions to be committed.
+	emitFlushTimeout = 5 * time.Second
+
+	// emittedSourceID is the source of the events emitted by the actions
+	emittedSourceID = SourceID(math.MaxUint64)
 )
 
 type finalizeFn = func(event *Event, notifyInput bool, backEvent bool)
@@ -65,6 +78,14 @@ type ActionPluginController interface {
 	IncMaxEventSizeExceeded(lvs ...string) // inc max event size exceeded counter
 }
 
+// Emitter passes the events created by the action outside of the event processing, e.g. on the timer.
+type Emitter interface {
+	// Emit passes the event to the actions following the action and then to the outputs.
+	// The emitted events aren't committed to the input and don't take the place in the event pool.
+	// It returns false if the event isn't passed since the pipeline is stopped.
+	Emit(data []byte) bool
+}
+
 type OutputPluginController interface {
 	Commit(event *Event) // notify input plugin that event is successfully processed and save offsets
 	Error(err string)
@@ -86,7 +107,7 @@ type pool interface {
 
 type Pipeline struct {
 	Name     string
-	started  bool
+	started  atomic.Bool
 	settings *Settings
 
 	decoderType decoder.Type // decoder type set in the config
@@ -99,11 +120,26 @@ type Pipeline struct {
 	disableStreams bool
 	singleProc     bool
 	shouldStop     atomic.Bool
-
-	input      InputPlugin
-	inputInfo  *InputPluginInfo
-	antispamer *antispam.Antispammer
-	metricCtl  *metric.Ctl
+	draining       atomic.Bool
+	// emitStopped is set on stop after the actions are flushed, the events aren't emitted anymore.
+	emitStopped atomic.Bool
+	// emittedInFlight is the number of the emitted events which aren't committed by the outputs yet.
+	emittedInFlight atomic.Int64
+	// drainStopCh is closed on stop, the inputs which don't stop themselves on drain are blocked until then.
+	drainStopCh   chan struct{}
+	drainStopOnce sync.Once
+	pauser        *pauser
+	// replayLimiter is set if the pipeline replays the dead queue events with the rate limit.
+	replayLimiter *replayLimiter
+
+	input     InputPlugin
+	inputInfo *InputPluginInfo
+	// discardAwareInput is set if the input must be notified about discarded events.
+	discardAwareInput DiscardAwareInputPlugin
+	// drainAwareInput is set if the input stops receiving the events itself on drain.
+	drainAwareInput DrainAwareInputPlugin
+	antispamer      *antispam.Antispammer
+	metricCtl       *metric.Ctl
 
 	actionInfos   []*ActionPluginStaticInfo
 	actionMetrics actionMetrics
@@ -114,9 +150,12 @@ type Pipeline struct {
 	activeProcs *atomic.Int32
 
 	router *Router
+	// spiller is set if the events are passed to the router through the disk queue.
+	spiller *spiller
 
 	// some debugging stuff
 	logger          *zap.Logger
+	eventTap        *eventTap
 	eventLogEnabled bool
 	eventLog        []string
 	eventLogMu      *sync.Mutex
@@ -138,6 +177,8 @@ type Pipeline struct {
 	wrongEventCRIFormatMetric  *metric.Counter
 	maxEventSizeExceededMetric *metric.CounterVec
 	eventPoolLatency           *metric.Histogram
+	drainInFlightEventsMetric  *metric.Gauge
+	drainRejectedEventsMetric  *metric.Counter
 
 	countEventPanicsRecoveredMetric *metric.Counter
 }
@@ -151,6 +192,9 @@ type Settings struct {
 	EventTimeout            time.Duration
 	Antispam                AntispamSettings
 	SourceNameMetaField     string
+	MetaOutOfBand           bool
+	EventTimeField          string
+	EventTimeFormat         string
 	AvgEventSize            int
 	MaxEventSize            int
 	CutOffEventByLimit      bool
@@ -159,6 +203,8 @@ type Settings struct {
 	IsStrict                bool
 	Pool                    PoolType
 	Metric                  *MetricSettings
+	SpillQueue              SpillQueueSettings
+	Replay                  *ReplaySettings
 }
 
 type MetricSettings struct {
@@ -166,6 +212,13 @@ type MetricSettings struct {
 	MaxLabelValueLength int
 }
 
+// SpillQueueSettings enables the disk queue between the processors and the outputs if Dir is set.
+type SpillQueueSettings struct {
+	Dir         string
+	MaxSize     int64
+	SegmentSize int64
+}
+
 type AntispamSettings struct {
 	Threshold           int
 	Rules               antispam.Rules
@@ -181,17 +234,37 @@ const (
 )
 
 // New creates new pipeline. Consider using `SetupHTTPHandlers` next.
-func New(name string, settings *Settings, registry *prometheus.Registry, lg *zap.Logger) *Pipeline {
+// It returns the error if the settings are wrong, e.g. the pool or the decoder is unknown
+// or the spill queue dir can't be opened.
+func New(name string, settings *Settings, registry *prometheus.Registry, lg *zap.Logger) (*Pipeline, error) {
+	switch settings.Pool {
+	case PoolTypeStd, PoolTypeLowMem, "":
+	default:
+		return nil, fmt.Errorf("unknown pool type %q", settings.Pool)
+	}
+
+	decoderType := decoder.TypeFromString(settings.Decoder)
+	if decoderType == decoder.NO {
+		return nil, fmt.Errorf("unknown decoder %q", settings.Decoder)
+	}
+	dec, err := decoder.New(decoderType, settings.DecoderParams)
+	if err != nil {
+		return nil, fmt.Errorf("can't create decoder %q: %w", settings.Decoder, err)
+	}
+
+	if settings.SpillQueue.Dir != "" {
+		if err := spill.CheckDir(spillQueueDir(name, settings)); err != nil {
+			return nil, fmt.Errorf("can't open spill queue: %w", err)
+		}
+	}
+
 	metricCtl := metric.NewCtl("pipeline_"+name, registry, settings.Metric.HoldDuration, settings.Metric.MaxLabelValueLength)
 
 	var eventPool pool
-	switch settings.Pool {
-	case PoolTypeStd:
+	if settings.Pool == PoolTypeStd {
 		eventPool = newEventPool(settings.Capacity, settings.AvgEventSize)
-	case PoolTypeLowMem, "":
+	} else {
 		eventPool = newLowMemoryEventPool(settings.Capacity)
-	default:
-		logger.Fatal("unknown pool type", zap.String("pool", string(settings.Pool)))
 	}
 
 	pipeline := &Pipeline{
@@ -210,8 +283,10 @@ func New(name string, settings *Settings, registry *prometheus.Registry, lg *zap
 			m:  make(map[string]*actionMetric),
 			mu: new(sync.RWMutex),
 		},
-		streamer:  newStreamer(settings.EventTimeout),
-		eventPool: eventPool,
+		streamer:    newStreamer(settings.EventTimeout),
+		eventPool:   eventPool,
+		decoderType: decoderType,
+		decoder:     dec,
 		antispamer: antispam.NewAntispammer(&antispam.Options{
 			Threshold:           settings.Antispam.Threshold,
 			MaintenanceInterval: settings.Antispam.MaintenanceInterval,
@@ -221,27 +296,26 @@ func New(name string, settings *Settings, registry *prometheus.Registry, lg *zap
 			Rules:               settings.Antispam.Rules,
 			Exceptions:          settings.Antispam.Exceptions,
 		}),
-		metricCtl: metricCtl,
+		metricCtl:   metricCtl,
+		pauser:      newPauser(metricCtl),
+		drainStopCh: make(chan struct{}),
 
 		eventLog:   make([]string, 0, 128),
 		eventLogMu: &sync.Mutex{},
+		eventTap:   newEventTap(),
 	}
 
 	pipeline.registerMetrics()
 	pipeline.setDefaultMetrics()
 
-	pipeline.decoderType = decoder.TypeFromString(settings.Decoder)
-	if pipeline.decoderType == decoder.NO {
-		pipeline.logger.Fatal("unknown decoder", zap.String("decoder", settings.Decoder))
-	}
-
-	var err error
-	pipeline.decoder, err = decoder.New(pipeline.decoderType, pipeline.settings.DecoderParams)
-	if err != nil {
-		pipeline.logger.Fatal("can't create decoder", zap.String("decoder", settings.Decoder), zap.Error(err))
+	if settings.Replay != nil {
+		if settings.Replay.Rate > 0 {
+			pipeline.replayLimiter = newReplayLimiter(settings.Replay.Rate)
+		}
+		pipeline.AddAction(newReplayActionInfo(settings.Replay))
 	}
 
-	return pipeline
+	return pipeline, nil
 }
 
 func (p *Pipeline) IncReadOps() {
@@ -269,6 +343,8 @@ func (p *Pipeline) registerMetrics() {
 	p.maxEventSizeExceededMetric = m.RegisterCounterVec("max_event_size_exceeded_total", "Max event size exceeded counter", "source_name")
 	p.countEventPanicsRecoveredMetric = m.RegisterCounter("count_event_panics_recovered_total", "Count of processor.countEvent panics recovered")
 	p.eventPoolLatency = m.RegisterHistogram("event_pool_latency_seconds", "How long we are wait an event from the pool", metric.SecondsBucketsDetailedNano)
+	p.drainInFlightEventsMetric = m.RegisterGauge("drain_in_flight_events", "Count of events which aren't committed yet while the pipeline is drained")
+	p.drainRejectedEventsMetric = m.RegisterCounter("drain_rejected_events_total", "Count of input events rejected while the pipeline is drained")
 }
 
 func (p *Pipeline) setDefaultMetrics() {
@@ -279,12 +355,12 @@ func (p *Pipeline) setDefaultMetrics() {
 // Plugin endpoints can be accessed via
 // URL `/pipelines/<pipeline_name>/<plugin_index_in_config>/<plugin_endpoint>`.
 // Input plugin has the index of zero, output plugin has the last index.
-// Actions also have the standard endpoints `/info` and `/sample`.
+// Actions also have the standard endpoints `/info`, `/sample` and `/tap`.
 func (p *Pipeline) SetupHTTPHandlers(mux *http.ServeMux) {
 	if p.input == nil {
 		p.logger.Panic("input isn't set")
 	}
-	if p.router.output == nil {
+	if !p.router.hasOutput() {
 		p.logger.Panic("output isn't set")
 	}
 
@@ -292,6 +368,8 @@ func (p *Pipeline) SetupHTTPHandlers(mux *http.ServeMux) {
 	mux.HandleFunc(prefix, p.servePipeline)
 	prefixBanList := fmt.Sprintf("/pipelines/%s/ban_list", p.Name)
 	mux.HandleFunc(prefixBanList, p.servePipelineBanList)
+	mux.HandleFunc(prefix+"/pause", p.servePause(true))
+	mux.HandleFunc(prefix+"/resume", p.servePause(false))
 	for hName, handler := range p.inputInfo.PluginStaticInfo.Endpoints {
 		mux.HandleFunc(fmt.Sprintf("%s/0/%s", prefix, hName), handler)
 	}
@@ -299,34 +377,57 @@ func (p *Pipeline) SetupHTTPHandlers(mux *http.ServeMux) {
 	for i, info := range p.actionInfos {
 		mux.HandleFunc(fmt.Sprintf("%s/%d/info", prefix, i+1), p.serveActionInfo(info))
 		mux.HandleFunc(fmt.Sprintf("%s/%d/sample", prefix, i+1), p.serveActionSample(i))
+		mux.HandleFunc(fmt.Sprintf("%s/%d/tap", prefix, i+1), p.serveActionTap(i))
 		for hName, handler := range info.PluginStaticInfo.Endpoints {
 			mux.HandleFunc(fmt.Sprintf("%s/%d/%s", prefix, i+1, hName), handler)
 		}
 	}
 
-	for hName, handler := range p.router.outputInfo.PluginStaticInfo.Endpoints {
-		mux.HandleFunc(fmt.Sprintf("%s/%d/%s", prefix, len(p.actionInfos)+1, hName), handler)
+	for i, info := range p.router.outputInfos() {
+		for hName, handler := range info.PluginStaticInfo.Endpoints {
+			mux.HandleFunc(fmt.Sprintf("%s/%d/%s", prefix, len(p.actionInfos)+1+i, hName), handler)
+		}
 	}
 }
 
-func (p *Pipeline) Start() {
+// Start starts the plugins of the pipeline. It returns the error if the spill queue can't be opened,
+// nothing is started in this case.
+func (p *Pipeline) Start() error {
 	if p.input == nil {
 		p.logger.Panic("input isn't set")
 	}
-	if p.router.output == nil {
+	if !p.router.hasOutput() {
 		p.logger.Panic("output isn't set")
 	}
 
+	if p.settings.SpillQueue.Dir != "" {
+		var err error
+		p.spiller, err = newSpiller(p.Name, p.settings, p.router, p.finalize, p.discard, p.metricCtl, p.logger.Named("spill_queue"))
+		if err != nil {
+			return fmt.Errorf("can't open spill queue: %w", err)
+		}
+	}
+
 	p.initProcs()
 
+	outputLogger := p.logger.Sugar().Named("output")
+	if !p.router.isFanOut() {
+		outputLogger = outputLogger.Named(p.router.outputInfo.Type)
+	}
 	outputParams := &OutputPluginParams{
 		PluginDefaultParams: p.actionParams,
 		Controller:          p,
-		Logger:              p.logger.Sugar().Named("output").Named(p.router.outputInfo.Type),
+		Logger:              outputLogger,
+	}
+	for _, info := range p.router.outputInfos() {
+		p.logger.Info("starting output plugin", zap.String("name", info.Type))
 	}
-	p.logger.Info("starting output plugin", zap.String("name", p.router.outputInfo.Type))
 
+	p.router.latency = newEventLatency(p.settings, p.metricCtl)
 	p.router.Start(outputParams)
+	if p.spiller != nil {
+		p.spiller.start()
+	}
 
 	p.logger.Info("stating processors", zap.Int("count", len(p.Procs)))
 	for _, processor := range p.Procs {
@@ -357,11 +458,77 @@ func (p *Pipeline) Start() {
 	if !p.useSpread {
 		go p.growProcs()
 	}
-	p.started = true
+	p.started.Store(true)
+	return nil
+}
+
+// Drain stops accepting the new input events and waits until the events in-flight
+// are committed by the outputs, so the pipeline can be stopped without losing or resending them.
+// It returns the context error if the events aren't committed before the deadline.
+// The pipeline must be stopped after the drain.
+func (p *Pipeline) Drain(ctx context.Context) error {
+	p.logger.Info("draining pipeline")
+	p.draining.Store(true)
+	// the blocked input events must be rejected or accepted by the drain-aware input
+	p.resumeOnStop("drain")
+	if p.drainAwareInput != nil {
+		p.drainAwareInput.Drain()
+	}
+
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+
+	lastReport := time.Now()
+	for {
+		inFlight, spillUnread := p.inFlight()
+		p.drainInFlightEventsMetric.Set(float64(inFlight))
+		if inFlight <= 0 && spillUnread <= 0 {
+			p.logger.Info("pipeline is drained")
+			return nil
+		}
+
+		if time.Since(lastReport) >= drainReportInterval {
+			p.logger.Info("draining pipeline", zap.Int64("in_flight_events", inFlight), zap.Int64("spill_queue_unread_bytes", spillUnread))
+			lastReport = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			p.logger.Warn("pipeline isn't drained before the deadline", zap.Int64("in_flight_events", inFlight), zap.Int64("spill_queue_unread_bytes", spillUnread))
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// inFlight returns the number of the events which aren't committed by the outputs yet
+// and the size of the spilled events which aren't read from the spill queue yet.
+func (p *Pipeline) inFlight() (events, spillUnread int64) {
+	events = p.eventPool.inUse() + p.emittedInFlight.Load()
+	if p.spiller != nil {
+		events += p.spiller.inFlightEvents()
+		spillUnread = p.spiller.queue.Unread()
+	}
+	return events, spillUnread
+}
+
+// Release unregisters the metrics of the pipeline which isn't started, e.g. since the reload has failed.
+// The metrics are shared with the running pipeline of the same name, so it must be released only if there is no such pipeline.
+func (p *Pipeline) Release() {
+	p.metricCtl.UnregisterAll()
 }
 
 func (p *Pipeline) Stop() {
 	p.logger.Info("stopping pipeline", zap.Int64("committed", p.outputEvents.Load()))
+	// the input can't be stopped while it's blocked by the pause or the drain
+	p.resumeOnStop("stop")
+	// the pipeline may be stopped several times
+	p.drainStopOnce.Do(func() { close(p.drainStopCh) })
+	if p.replayLimiter != nil {
+		p.replayLimiter.stop()
+	}
+
+	p.flushActions()
 
 	p.logger.Info("stopping processors", zap.Int32("count", p.procCount.Load()))
 	for _, processor := range p.Procs {
@@ -373,17 +540,52 @@ func (p *Pipeline) Stop() {
 	p.logger.Info("stopping input")
 	p.input.Stop()
 
+	if p.spiller != nil {
+		p.logger.Info("stopping spill queue")
+		p.spiller.stop()
+	}
+
 	p.logger.Info("stopping output")
 	p.router.Stop()
 
+	if p.spiller != nil {
+		// persist the commits made by the outputs on stop
+		p.spiller.sync()
+	}
+
 	p.shouldStop.Store(true)
 
 	p.eventPool.stop()
 }
 
+// flushActions makes the flushable actions emit the events they have accumulated
+// and waits until the emitted events are committed by the outputs.
+func (p *Pipeline) flushActions() {
+	if p.emitStopped.Load() {
+		return
+	}
+
+	for _, processor := range p.Procs {
+		processor.flush()
+	}
+
+	deadline := time.Now().Add(emitFlushTimeout)
+	for p.emittedInFlight.Load() > 0 {
+		if time.Now().After(deadline) {
+			p.logger.Warn("emitted events aren't committed before the deadline", zap.Int64("in_flight_events", p.emittedInFlight.Load()))
+			break
+		}
+		time.Sleep(drainCheckInterval)
+	}
+
+	p.emitStopped.Store(true)
+}
+
 func (p *Pipeline) SetInput(info *InputPluginInfo) {
 	p.inputInfo = info
 	p.input = info.Plugin.(InputPlugin)
+	p.discardAwareInput, _ = info.Plugin.(DiscardAwareInputPlugin)
+	p.drainAwareInput, _ = info.Plugin.(DrainAwareInputPlugin)
 }
 
 func (p *Pipeline) GetInput() InputPlugin {
@@ -398,6 +600,16 @@ func (p *Pipeline) SetDeadQueueOutput(info *OutputPluginInfo) {
 	p.router.SetDeadQueueOutput(info)
 }
 
+func (p *Pipeline) SetDeadQueueAnnotation(annotation *DeadQueueAnnotation) {
+	p.router.SetDeadQueueAnnotation(annotation)
+}
+
+// AddOutput adds one more output to the pipeline, so events are routed to all the matched outputs.
+// The event is committed to the input only after all the matched outputs have committed it.
+func (p *Pipeline) AddOutput(route *OutputRoute) {
+	p.router.AddOutput(route)
+}
+
 func (p *Pipeline) GetOutput() OutputPlugin {
 	return p.router.output
 }
@@ -408,6 +620,19 @@ func (p *Pipeline) In(sourceID SourceID, sourceName string, offsets Offsets, byt
 		ok     bool
 		cutoff bool
 	)
+	p.pauser.wait()
+	if p.replayLimiter != nil {
+		p.replayLimiter.wait()
+	}
+
+	// the input which doesn't stop itself is blocked until the pipeline is stopped, so it doesn't spin.
+	// The input events aren't committed, so they will be read again after restart
+	if p.draining.Load() && p.drainAwareInput == nil {
+		<-p.drainStopCh
+		p.drainRejectedEventsMetric.Inc()
+		return EventSeqIDError
+	}
+
 	// don't process mud.
 	bytes, cutoff, ok = p.checkInputBytes(bytes, sourceName, meta)
 	if !ok {
@@ -522,7 +747,10 @@ func (p *Pipeline) In(sourceID SourceID, sourceName string, offsets Offsets, byt
 		return EventSeqIDError
 	}
 
-	if len(meta) > 0 {
+	for k, v := range meta {
+		event.SetMeta(k, v)
+	}
+	if len(meta) > 0 && !p.settings.MetaOutOfBand {
 		if event.Root.IsArray() {
 			nodeArray := event.Root.AsArray()
 			for _, elem := range nodeArray {
@@ -546,6 +774,7 @@ func (p *Pipeline) In(sourceID SourceID, sourceName string, offsets Offsets, byt
 	event.SourceID = sourceID
 	event.SourceName = sourceName
 	event.streamName = DefaultStreamName
+	event.inTime = now
 
 	return p.streamEvent(event)
 }
@@ -603,8 +832,44 @@ func (p *Pipeline) streamEvent(event *Event) uint64 {
 	return p.streamer.putEvent(streamID, event.streamName, event)
 }
 
+// emit passes the event created by the action to the actions following it.
+// The emitted events have their own stream, so they don't delay the events of the input.
+// They are allocated outside the event pool, so the action isn't blocked by the full pool.
+func (p *Pipeline) emit(action int, data []byte) bool {
+	if p.emitStopped.Load() {
+		return false
+	}
+
+	event := newEvent()
+	if err := event.Root.DecodeBytes(data); err != nil {
+		p.logger.Error("can't decode emitted event", zap.Error(err))
+		insaneJSON.Release(event.Root)
+		return false
+	}
+
+	p.emittedInFlight.Inc()
+	event.emitted = true
+	event.stage = eventStageInput
+	event.Size = len(data)
+	event.action = action + 1
+	event.SourceID = emittedSourceID
+	event.SourceName = "emitted"
+	event.streamName = DefaultStreamName
+	event.inTime = time.Now()
+
+	p.streamer.putEvent(StreamID(emittedSourceID), event.streamName, event)
+	return true
+}
+
 func (p *Pipeline) Commit(event *Event) {
-	p.router.Ack(event)
+	if event.origin != nil {
+		origin := event.origin
+		insaneJSON.Release(event.Root)
+		event = origin
+	}
+	if !p.router.Ack(event) {
+		return
+	}
 	p.finalize(event, true, true)
 }
 
@@ -617,11 +882,18 @@ func (p *Pipeline) Error(err string) {
 }
 
 func (p *Pipeline) finalize(event *Event, notifyInput bool, backEvent bool) {
+	// spilled events are committed to the input on spilling, so they are committed only to the spill queue
+	if event.isSpilledKind() {
+		p.spiller.commit(event)
+		return
+	}
+
 	if event.IsTimeoutKind() || event.IsChildKind() {
 		return
 	}
 
-	if notifyInput {
+	// the emitted events aren't read from the input, so there is nothing to commit
+	if notifyInput && !event.emitted {
 		p.input.Commit(event)
 		p.outputEvents.Inc()
 		p.outputSize.Add(int64(event.Size))
@@ -645,9 +917,25 @@ func (p *Pipeline) finalize(event *Event, notifyInput bool, backEvent bool) {
 		event.children[i] = nil
 	}
 
+	// the emitted events aren't taken from the event pool
+	if event.emitted {
+		insaneJSON.Release(event.Root)
+		p.emittedInFlight.Dec()
+		return
+	}
+
 	p.eventPool.back(event)
 }
 
+// discard finalizes the event which is dropped by the pipeline and won't be committed,
+// e.g. it's discarded by the action or isn't routed to any output.
+func (p *Pipeline) discard(event *Event) {
+	if p.discardAwareInput != nil && (event.IsRegularKind() || event.IsChildParentKind()) && !event.emitted {
+		p.discardAwareInput.Discard(event)
+	}
+	p.finalize(event, false, true)
+}
+
 type actionMetric struct {
 	count *metric.CounterVec
 	size  *metric.CounterVec
@@ -743,6 +1031,10 @@ func (p *Pipeline) newProc(id int) *processor {
 		p.IncMaxEventSizeExceeded,
 		p.IncCountEventPanicsRecovered,
 	)
+	proc.spiller = p.spiller
+	proc.discard = p.discard
+	proc.eventTap = p.eventTap
+	proc.emit = p.emit
 	for j, info := range p.actionInfos {
 		plugin, _ := info.Factory()
 		proc.AddActionPlugin(&ActionPluginInfo{
@@ -872,6 +1164,9 @@ func (p *Pipeline) maintenance() {
 		}
 
 		p.metricCtl.Maintenance()
+		if p.spiller != nil {
+			p.spiller.maintenance()
+		}
 
 		myDeltas := p.incMetrics(inputEvents, inputSize, outputEvents, outputSize, readOps)
 		p.setMetrics(p.eventPool.inUse())
@@ -891,7 +1186,7 @@ func (p *Pipeline) antispammerMaintenance() {
 }
 
 func (p *Pipeline) UseSpread() {
-	if p.started {
+	if p.started.Load() {
 		p.logger.Panic("don't use (*Pipeline).UseSpread after the pipeline has started")
 	}
 	p.useSpread = true
@@ -1032,6 +1327,99 @@ func (p *Pipeline) serveActionSample(actionIndex int) func(http.ResponseWriter,
 	}
 }
 
+// serveActionTap creates a handlerFunc which streams the events passed by the given action.
+// The events are written as NDJSON or as server-sent events if `format=sse` is set.
+// Query params:
+//   - `do_if` is the JSON encoded do_if tree to filter the events;
+//   - `rate` is the max number of the events per second, the rest of the events are dropped.
+//
+// The number of the dropped events is reported every second in the `{"dropped":<count>}` message.
+func (p *Pipeline) serveActionTap(actionIndex int) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		sse := query.Get("format") == "sse"
+
+		var checker *doif.Checker
+		if str := query.Get("do_if"); str != "" {
+			var m map[string]any
+			err := json.Unmarshal([]byte(str), &m)
+			if err == nil {
+				checker, err = doif.NewFromMap(m)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				writeErr(w, fmt.Sprintf("can't parse do_if: %s", err.Error()))
+				return
+			}
+		}
+
+		rate := defaultTapRate
+		if str := query.Get("rate"); str != "" {
+			val, err := strconv.Atoi(str)
+			if err != nil || val <= 0 || val > maxTapRate {
+				w.WriteHeader(http.StatusBadRequest)
+				writeErr(w, fmt.Sprintf("rate must be an integer in range [1, %d]", maxTapRate))
+				return
+			}
+			rate = val
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			writeErr(w, "streaming isn't supported")
+			return
+		}
+
+		if sse {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		subscriber := p.eventTap.subscribe(actionIndex, checker, rate)
+		defer p.eventTap.unsubscribe(actionIndex, subscriber)
+
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		write := func(event string, data []byte) error {
+			var err error
+			if sse {
+				_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+			} else {
+				_, err = fmt.Fprintf(w, "%s\n", data)
+			}
+			flusher.Flush()
+			return err
+		}
+
+		ticker := time.NewTicker(tapFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case data := <-subscriber.ch:
+				if err := write("event", data); err != nil {
+					return
+				}
+			case <-ticker.C:
+				if p.shouldStop.Load() {
+					return
+				}
+				dropped := subscriber.dropped.Swap(0)
+				if dropped == 0 {
+					continue
+				}
+				if err := write("dropped", fmt.Appendf(nil, `{"dropped":%d}`, dropped)); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
 func writeErr(w io.Writer, err string) {
 	type ErrResp struct {
 		Error string `json:"error"`
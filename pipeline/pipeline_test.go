@@ -1,16 +1,24 @@
 package pipeline_test
 
 import (
+	"context"
 	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/pipeline/doif"
 	"github.com/ozontech/file.d/pipeline/metadata"
 	"github.com/ozontech/file.d/plugin/input/fake"
 	"github.com/ozontech/file.d/plugin/output/devnull"
 	"github.com/ozontech/file.d/test"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 )
 
@@ -29,6 +37,176 @@ func getFakeInputInfo() *pipeline.InputPluginInfo {
 	}
 }
 
+// noCommitOutput receives the events but never commits them like a stuck output.
+type noCommitOutput struct {
+	received atomic.Int32
+}
+
+func (o *noCommitOutput) Start(_ pipeline.AnyConfig, _ *pipeline.OutputPluginParams) {}
+
+func (o *noCommitOutput) Stop() {}
+
+func (o *noCommitOutput) Out(_ *pipeline.Event) {
+	o.received.Inc()
+}
+
+// newTestPipeline creates the pipeline with the fake input, the spill queue is used if the dir is set.
+// The outputs must be added by the caller if the output is nil.
+func newTestPipeline(t *testing.T, spillDir string, output pipeline.OutputPlugin) (*pipeline.Pipeline, *fake.Plugin) {
+	t.Helper()
+	settings := &pipeline.Settings{
+		Capacity:            16,
+		MaintenanceInterval: time.Second,
+		EventTimeout:        pipeline.DefaultEventTimeout,
+		Antispam: pipeline.AntispamSettings{
+			Threshold:           pipeline.DefaultAntispamThreshold,
+			MaintenanceInterval: time.Second,
+		},
+		AvgEventSize: 1024,
+		StreamField:  "stream",
+		Decoder:      "json",
+		Metric: &pipeline.MetricSettings{
+			HoldDuration: pipeline.DefaultMetricHoldDuration,
+		},
+		SpillQueue: pipeline.SpillQueueSettings{
+			Dir: spillDir,
+		},
+	}
+
+	p, err := pipeline.New("test_pipeline", settings, prometheus.NewRegistry(), zap.NewNop())
+	require.NoError(t, err)
+	p.DisableParallelism()
+
+	input := getFakeInputInfo()
+	p.SetInput(input)
+	if output != nil {
+		p.SetOutput(&pipeline.OutputPluginInfo{
+			PluginStaticInfo:  &pipeline.PluginStaticInfo{Type: "test"},
+			PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: output},
+		})
+	}
+
+	return p, input.Plugin.(*fake.Plugin)
+}
+
+func TestDrain(t *testing.T) {
+	// the stuck output doesn't commit the event before the deadline
+	stuckOutput := &noCommitOutput{}
+	p, input := newTestPipeline(t, "", stuckOutput)
+	require.NoError(t, p.Start())
+	input.In(0, "test.log", test.NewOffset(0), []byte(`{"id":0}`))
+	require.Eventually(t, func() bool {
+		return stuckOutput.received.Load() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, p.Drain(ctx), context.DeadlineExceeded)
+
+	// the new events are blocked while the pipeline is drained and rejected on stop
+	seqIDCh := make(chan uint64, 1)
+	go func() {
+		seqIDCh <- p.In(0, "test.log", test.NewOffset(1), []byte(`{"id":1}`), false, nil)
+	}()
+	select {
+	case <-seqIDCh:
+		require.Fail(t, "the event isn't blocked while the pipeline is drained")
+	case <-time.After(100 * time.Millisecond):
+	}
+	p.Stop()
+	require.Equal(t, pipeline.EventSeqIDError, <-seqIDCh)
+
+	// the drain is finished as soon as the output commits the events
+	anyPlugin, _ := devnull.Factory()
+	output := anyPlugin.(*devnull.Plugin)
+	p, input = newTestPipeline(t, "", output)
+	outputs := atomic.NewInt32(1)
+	output.SetOutFn(func(_ *pipeline.Event) {
+		outputs.Dec()
+	})
+	require.NoError(t, p.Start())
+	input.In(0, "test.log", test.NewOffset(0), []byte(`{"id":0}`))
+	test.WaitForEvents(outputs)
+
+	require.NoError(t, p.Drain(context.Background()))
+	p.Stop()
+}
+
+func TestPause(t *testing.T) {
+	anyPlugin, _ := devnull.Factory()
+	output := anyPlugin.(*devnull.Plugin)
+	p, input := newTestPipeline(t, "", output)
+	outputs := atomic.NewInt32(0)
+	output.SetOutFn(func(_ *pipeline.Event) {
+		outputs.Inc()
+	})
+
+	mux := http.NewServeMux()
+	p.SetupHTTPHandlers(mux)
+	call := func(method, action string) string {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, "/pipelines/test_pipeline/"+action, nil))
+		return rec.Body.String()
+	}
+
+	require.NoError(t, p.Start())
+	defer p.Stop()
+
+	require.JSONEq(t, `{"error":"only POST method is allowed"}`, call(http.MethodGet, "pause"))
+	require.False(t, p.IsPaused())
+	require.JSONEq(t, `{"paused":true}`, call(http.MethodPost, "pause"))
+	require.True(t, p.IsPaused())
+	require.True(t, p.Describe().State.Paused)
+
+	inDone := atomic.NewBool(false)
+	go func() {
+		input.In(0, "test.log", test.NewOffset(0), []byte(`{"id":0}`))
+		inDone.Store(true)
+	}()
+
+	// the input is blocked while the pipeline is paused
+	time.Sleep(100 * time.Millisecond)
+	require.False(t, inDone.Load())
+	require.Equal(t, int32(0), outputs.Load())
+
+	require.JSONEq(t, `{"paused":false}`, call(http.MethodPost, "resume"))
+	require.Eventually(t, func() bool {
+		return inDone.Load() && outputs.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.False(t, p.Resume(), "the pipeline is already resumed")
+}
+
+func TestDescribe(t *testing.T) {
+	type actionConfig struct {
+		Field    string `json:"field"`
+		Password string `json:"password"`
+	}
+
+	p, _ := newTestPipeline(t, "", &noCommitOutput{})
+	p.AddAction(&pipeline.ActionPluginStaticInfo{
+		PluginStaticInfo: &pipeline.PluginStaticInfo{
+			Type:   "test_action",
+			Config: &actionConfig{Field: "message", Password: "qwerty"},
+		},
+		MetricName: "test_metric",
+	})
+
+	d := p.Describe()
+	require.Equal(t, "test_pipeline", d.Name)
+	require.Equal(t, 16, d.Settings.Capacity)
+	require.Equal(t, "json", d.Settings.Decoder)
+	require.False(t, d.State.Started)
+
+	require.Len(t, d.Actions, 1)
+	require.Equal(t, "test_action", d.Actions[0].Type)
+	require.Equal(t, "test_metric", d.Actions[0].MetricName)
+	require.Equal(t, map[string]any{"field": "message", "password": "<redacted>"}, d.Actions[0].Config)
+
+	require.Len(t, d.Outputs, 1)
+	require.Equal(t, "test", d.Outputs[0].Type)
+	require.Nil(t, d.Outputs[0].DeadQueue)
+}
+
 func TestInInvalidMessages(t *testing.T) {
 	cases := []struct {
 		name             string
@@ -68,7 +246,8 @@ func TestInInvalidMessages(t *testing.T) {
 
 	for _, tCase := range cases {
 		t.Run(tCase.name, func(t *testing.T) {
-			pipe := pipeline.New("test_pipeline", tCase.pipelineSettings, prometheus.NewRegistry(), zap.NewNop())
+			pipe, err := pipeline.New("test_pipeline", tCase.pipelineSettings, prometheus.NewRegistry(), zap.NewNop())
+			require.NoError(t, err)
 
 			pipe.SetInput(getFakeInputInfo())
 
@@ -78,6 +257,138 @@ func TestInInvalidMessages(t *testing.T) {
 	}
 }
 
+func TestInMetaOutOfBand(t *testing.T) {
+	for _, outOfBand := range []bool{false, true} {
+		t.Run(fmt.Sprintf("out_of_band_%t", outOfBand), func(t *testing.T) {
+			pipe, err := pipeline.New("test_pipeline", &pipeline.Settings{
+				Capacity:            5,
+				MaintenanceInterval: time.Second,
+				EventTimeout:        pipeline.DefaultEventTimeout,
+				Antispam: pipeline.AntispamSettings{
+					Threshold:           pipeline.DefaultAntispamThreshold,
+					MaintenanceInterval: time.Second,
+				},
+				AvgEventSize:  1024,
+				StreamField:   "stream",
+				Decoder:       "json",
+				MetaOutOfBand: outOfBand,
+				Metric: &pipeline.MetricSettings{
+					HoldDuration: pipeline.DefaultMetricHoldDuration,
+				},
+			}, prometheus.NewRegistry(), zap.NewNop())
+			require.NoError(t, err)
+			pipe.DisableParallelism()
+			pipe.SetInput(getFakeInputInfo())
+
+			plugin, config := devnull.Factory()
+			outputPlugin := plugin.(*devnull.Plugin)
+			pipe.SetOutput(&pipeline.OutputPluginInfo{
+				PluginStaticInfo: &pipeline.PluginStaticInfo{
+					Config: config,
+				},
+				PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{
+					Plugin: outputPlugin,
+				},
+			})
+
+			wg := sync.WaitGroup{}
+			wg.Add(1)
+			var json string
+			var meta metadata.MetaData
+			outputPlugin.SetOutFn(func(event *pipeline.Event) {
+				json = event.Root.EncodeToString()
+				meta = maps.Clone(event.Meta)
+				wg.Done()
+			})
+
+			require.NoError(t, pipe.Start())
+			pipe.In(1, "test", test.NewOffset(1), []byte(`{"message":"test"}`), false, metadata.MetaData{"tenant": "test"})
+			wg.Wait()
+			pipe.Stop()
+
+			require.Equal(t, metadata.MetaData{"tenant": "test"}, meta)
+			if outOfBand {
+				require.Equal(t, `{"message":"test"}`, json)
+			} else {
+				require.Equal(t, `{"message":"test","tenant":"test"}`, json)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	checker, err := doif.NewFromMap(map[string]any{
+		"op":     "equal",
+		"field":  "dq.output",
+		"values": []any{"kafka"},
+	})
+	require.NoError(t, err)
+
+	pipe, err := pipeline.New("test_pipeline", &pipeline.Settings{
+		Capacity:            5,
+		MaintenanceInterval: time.Second,
+		EventTimeout:        pipeline.DefaultEventTimeout,
+		Antispam: pipeline.AntispamSettings{
+			Threshold:           pipeline.DefaultAntispamThreshold,
+			MaintenanceInterval: time.Second,
+		},
+		AvgEventSize:  1024,
+		StreamField:   "stream",
+		Decoder:       "json",
+		MetaOutOfBand: true,
+		Metric: &pipeline.MetricSettings{
+			HoldDuration: pipeline.DefaultMetricHoldDuration,
+		},
+		Replay: &pipeline.ReplaySettings{
+			AnnotationField: []string{"dq"},
+			DoIf:            checker,
+			Rate:            1000,
+		},
+	}, prometheus.NewRegistry(), zap.NewNop())
+	require.NoError(t, err)
+	pipe.DisableParallelism()
+	pipe.SetInput(getFakeInputInfo())
+
+	plugin, config := devnull.Factory()
+	outputPlugin := plugin.(*devnull.Plugin)
+	pipe.SetOutput(&pipeline.OutputPluginInfo{
+		PluginStaticInfo: &pipeline.PluginStaticInfo{
+			Config: config,
+		},
+		PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{
+			Plugin: outputPlugin,
+		},
+	})
+
+	mu := sync.Mutex{}
+	events := make([]string, 0)
+	metas := make([]metadata.MetaData, 0)
+	outputPlugin.SetOutFn(func(event *pipeline.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event.Root.EncodeToString())
+		metas = append(metas, maps.Clone(event.Meta))
+	})
+
+	require.NoError(t, pipe.Start())
+	annotations := metadata.MetaData{"tenant": "test", "deadqueue_output": "kafka", "deadqueue_error": "timeout"}
+	pipe.In(1, "test", test.NewOffset(1), []byte(`{"message":"a","dq":{"output":"kafka","error":"timeout"}}`), false, maps.Clone(annotations))
+	pipe.In(1, "test", test.NewOffset(2), []byte(`{"message":"b","dq":{"output":"http","error":"timeout"}}`), false, maps.Clone(annotations))
+	pipe.In(1, "test", test.NewOffset(3), []byte(`{"message":"c","dq":{"output":"kafka","error":"timeout"}}`), false, maps.Clone(annotations))
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	pipe.Stop()
+
+	require.Equal(t, []string{`{"message":"a"}`, `{"message":"c"}`}, events)
+	for _, meta := range metas {
+		require.Equal(t, metadata.MetaData{"tenant": "test"}, meta)
+	}
+}
+
 func BenchmarkMetaTemplater(b *testing.B) {
 	pipelineSettings := &pipeline.Settings{
 		Capacity: b.N,
@@ -87,7 +398,8 @@ func BenchmarkMetaTemplater(b *testing.B) {
 		},
 	}
 
-	pipe := pipeline.New("test_pipeline", pipelineSettings, prometheus.NewRegistry(), zap.NewNop())
+	pipe, err := pipeline.New("test_pipeline", pipelineSettings, prometheus.NewRegistry(), zap.NewNop())
+	require.NoError(b, err)
 	pipe.SetInput(getFakeInputInfo())
 	plugin, config := devnull.Factory()
 	outputPlugin := plugin.(*devnull.Plugin)
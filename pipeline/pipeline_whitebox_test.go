@@ -31,7 +31,8 @@ func TestPipelineStreamEvent(t *testing.T) {
 			MaxLabelValueLength: DefaultMetricMaxLabelValueLength,
 		},
 	}
-	p := New("test", settings, prometheus.NewRegistry(), zap.NewNop())
+	p, err := New("test", settings, prometheus.NewRegistry(), zap.NewNop())
+	require.NoError(t, err)
 
 	streamID := StreamID(123123)
 	procs := int32(7)
@@ -157,7 +158,8 @@ func TestCheckInputBytes(t *testing.T) {
 
 	for _, tCase := range cases {
 		t.Run(tCase.name, func(t *testing.T) {
-			pipe := New("test_pipeline", tCase.pipelineSettings, prometheus.NewRegistry(), zap.NewNop())
+			pipe, err := New("test_pipeline", tCase.pipelineSettings, prometheus.NewRegistry(), zap.NewNop())
+			require.NoError(t, err)
 
 			data, cutoff, ok := pipe.checkInputBytes(tCase.input, "test", nil)
 
@@ -245,7 +247,8 @@ func TestCheckInputBytesMetric(t *testing.T) {
 
 	for _, tCase := range cases {
 		t.Run(tCase.name, func(t *testing.T) {
-			pipe := New("test_pipeline", tCase.pipelineSettings, prometheus.NewRegistry(), zap.NewNop())
+			pipe, err := New("test_pipeline", tCase.pipelineSettings, prometheus.NewRegistry(), zap.NewNop())
+			require.NoError(t, err)
 
 			pipe.checkInputBytes([]byte("some log"), tCase.sourceName, tCase.meta)
 
@@ -291,7 +294,8 @@ func TestSuggestDecoder(t *testing.T) {
 
 	for _, tCase := range tCases {
 		t.Run(tCase.name, func(t *testing.T) {
-			p := New("file_d", tCase.settings, prometheus.NewPedanticRegistry(), zap.NewNop())
+			p, err := New("file_d", tCase.settings, prometheus.NewPedanticRegistry(), zap.NewNop())
+			require.NoError(t, err)
 			p.SuggestDecoder(tCase.suggestType)
 			require.Equal(t, tCase.expectedType, p.decoderType)
 		})
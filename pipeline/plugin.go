@@ -25,12 +25,33 @@ type InputPlugin interface {
 	PassEvent(event *Event) bool
 }
 
+// DiscardAwareInputPlugin is the input plugin which is notified about the events
+// discarded by the pipeline, since such events are never committed.
+type DiscardAwareInputPlugin interface {
+	InputPlugin
+	Discard(*Event)
+}
+
+// DrainAwareInputPlugin is the input plugin which stops receiving the new events itself
+// when the pipeline is drained. The pipeline accepts the events from such an input until it's stopped.
+type DrainAwareInputPlugin interface {
+	InputPlugin
+	Drain()
+}
+
 type ActionPlugin interface {
 	Start(config AnyConfig, params *ActionPluginParams)
 	Stop()
 	Do(*Event) ActionResult
 }
 
+// FlushableActionPlugin is the action plugin which emits the events it has accumulated when the pipeline is stopped.
+// Flush is called before the processors are stopped, so the emitted events still reach the outputs.
+type FlushableActionPlugin interface {
+	ActionPlugin
+	Flush()
+}
+
 type OutputPlugin interface {
 	Start(config AnyConfig, params *OutputPluginParams)
 	Stop()
@@ -52,6 +73,7 @@ type PluginDefaultParams struct {
 type ActionPluginParams struct {
 	PluginDefaultParams
 	Controller ActionPluginController
+	Emitter    Emitter
 	Logger     *zap.SugaredLogger
 	Index      int
 }
@@ -80,6 +102,8 @@ type PluginStaticInfo struct {
 	AdditionalActions []string // used only for input plugins, defines actions that should be run right after input plugin with input config
 	// TODO: maybe to OutputPluginStaticInfo cause uses by output and action plugins?
 	DeadQueueInfo *PluginStaticInfo
+	// DeadQueueAnnotation is set only with DeadQueueInfo.
+	DeadQueueAnnotation *DeadQueueAnnotation
 }
 
 type PluginRuntimeInfo struct {
@@ -119,6 +143,19 @@ type AnyPlugin any
 
 type AnyConfig any
 
+// ValidatableConfig is the config with the values compiled on the plugin start, e.g. regexps or substitutions.
+// Validate checks them after the config is parsed, so the config errors are found without starting the plugin.
+// It mustn't open any files, sockets or connections.
+type ValidatableConfig interface {
+	Validate() error
+}
+
+// PipelineValidatableConfig is the config which is valid only in some pipelines,
+// e.g. the pipeline output can't pass the events to its own pipeline.
+type PipelineValidatableConfig interface {
+	ValidatePipeline(pipelineName string) error
+}
+
 type PluginFactory func() (AnyPlugin, AnyConfig)
 
 type MatchConditions []MatchCondition
@@ -2,6 +2,7 @@ package pipeline
 
 import (
 	"errors"
+	"maps"
 
 	"github.com/ozontech/file.d/logger"
 	"github.com/ozontech/file.d/pipeline/doif"
@@ -16,7 +17,8 @@ const (
 	// ActionPass pass event to the next action in a pipeline
 	ActionPass ActionResult = iota
 	// ActionCollapse skip further processing of event and request next event from the same stream and source as current
-	// plugin may receive event with EventKindTimeout if it takes to long to read next event from same stream
+	// plugin may receive event with EventKindTimeout if it takes to long to read next event from same stream.
+	// if the plugin holds an event, the collapsed event is committed with the held one, otherwise it's dropped.
 	ActionCollapse
 	// ActionDiscard skip further processing of event and request next event from any stream and source
 	ActionDiscard
@@ -58,15 +60,24 @@ type processor struct {
 	streamer *streamer
 	router   *Router
 	finalize finalizeFn
+	// discard finalizes the event which is dropped and won't be committed, the input is notified about it.
+	discard func(event *Event)
+	// spiller is set if the events are passed to the router through the disk queue.
+	spiller *spiller
+	// emit passes the events emitted by the actions, see Emitter.
+	emit func(action int, data []byte) bool
 
 	activeCounter *atomic.Int32
 
-	actions          []ActionPlugin
-	actionInfos      []*ActionPluginStaticInfo
-	actionMetrics    *actionMetrics
-	busyActions      []bool
+	actions       []ActionPlugin
+	actionInfos   []*ActionPluginStaticInfo
+	actionMetrics *actionMetrics
+	busyActions   []bool
+	// heldEvents are the events held by the busy actions, the events collapsed by the action are committed with them.
+	heldEvents       []*Event
 	busyActionsTotal int
 	actionWatcher    *actionWatcher
+	eventTap         *eventTap
 	recoverFromPanic func()
 
 	metricsValues []string
@@ -110,6 +121,7 @@ func (p *processor) start(params PluginDefaultParams, log *zap.SugaredLogger) {
 		action.Start(actionInfo.PluginStaticInfo.Config, &ActionPluginParams{
 			PluginDefaultParams: params,
 			Controller:          p,
+			Emitter:             &actionEmitter{emit: p.emit, action: i},
 			Logger:              log.Named("action").Named(actionInfo.Type),
 			Index:               i,
 		})
@@ -154,7 +166,12 @@ func (p *processor) processSequence(event *Event) bool {
 		}
 
 		event.stage = eventStageOutput
-		p.router.Out(event)
+		if p.spiller != nil {
+			p.spiller.out(event)
+		} else if !p.router.Out(event) {
+			// can't notify input here, because previous events may delay, and we'll get offset sequence corruption.
+			p.discard(event)
+		}
 	}
 
 	return true
@@ -209,28 +226,35 @@ func (p *processor) doActions(event *Event) (isPassed bool, lastAction int) {
 			p.countEvent(event, index, eventStatusPassed)
 			p.tryResetBusy(index)
 			p.actionWatcher.setEventAfter(index, event, eventStatusPassed)
+			p.eventTap.emit(p.id, index, event)
 		case ActionBreak:
 			p.countEvent(event, index, eventStatusBroke)
 			p.tryResetBusy(index)
 			p.actionWatcher.setEventAfter(index, event, eventStatusBroke)
+			p.eventTap.emit(p.id, index, event)
 			return true, index
 		case ActionDiscard:
 			p.countEvent(event, index, eventStatusDiscarded)
 			p.tryResetBusy(index)
 			// can't notify input here, because previous events may delay, and we'll get offset sequence corruption.
-			p.finalize(event, false, true)
+			p.discard(event)
 			p.actionWatcher.setEventAfter(index, event, eventStatusDiscarded)
 			return false, index
 		case ActionCollapse:
 			p.countEvent(event, index, eventStatusCollapse)
 			p.tryMarkBusy(index)
 			// can't notify input here, because previous events may delay, and we'll get offset sequence corruption.
-			p.finalize(event, false, true)
+			if p.collapse(index, event) {
+				p.finalize(event, false, true)
+			} else {
+				p.discard(event)
+			}
 			p.actionWatcher.setEventAfter(index, event, eventStatusCollapse)
 			return false, index
 		case ActionHold:
 			p.countEvent(event, index, eventStatusHold)
 			p.tryMarkBusy(index)
+			p.heldEvents[index] = event
 
 			p.finalize(event, false, false)
 			p.actionWatcher.setEventAfter(index, event, eventStatusHold)
@@ -254,7 +278,23 @@ func (p *processor) tryMarkBusy(index int) {
 	}
 }
 
+// collapse adds the offset of the collapsed event to the event held by the action,
+// so the collapsed event is committed with the held one. It returns false if the action doesn't hold an event,
+// the collapsed event is just dropped then.
+func (p *processor) collapse(index int, event *Event) bool {
+	held := p.heldEvents[index]
+	if held == nil {
+		return false
+	}
+	if event.IsRegularKind() && !event.emitted {
+		held.collapsedOffsets = append(held.collapsedOffsets, event.Offset)
+	}
+	return true
+}
+
 func (p *processor) tryResetBusy(index int) {
+	// the held event is propagated or dropped by the action
+	p.heldEvents[index] = nil
 	if !p.busyActions[index] {
 		return
 	}
@@ -332,7 +372,7 @@ func (p *processor) isMatch(index int, event *Event) bool {
 	info := p.actionInfos[index]
 
 	if info.DoIfChecker != nil {
-		return info.DoIfChecker.Check(doif.NewEventData(event.Root))
+		return info.DoIfChecker.Check(doif.NewEventDataWithMeta(event.Root, event.Meta))
 	}
 
 	conds := info.MatchConditions
@@ -409,10 +449,30 @@ func (p *processor) stop() {
 	}
 }
 
+// flush makes the flushable actions emit the events they have accumulated.
+func (p *processor) flush() {
+	for _, action := range p.actions {
+		if flushable, ok := action.(FlushableActionPlugin); ok {
+			flushable.Flush()
+		}
+	}
+}
+
 func (p *processor) AddActionPlugin(info *ActionPluginInfo) {
 	p.actions = append(p.actions, info.Plugin.(ActionPlugin))
 	p.actionInfos = append(p.actionInfos, info.ActionPluginStaticInfo)
 	p.busyActions = append(p.busyActions, false)
+	p.heldEvents = append(p.heldEvents, nil)
+}
+
+// actionEmitter emits the events of the action, they're processed by the following actions.
+type actionEmitter struct {
+	emit   func(action int, data []byte) bool
+	action int
+}
+
+func (e *actionEmitter) Emit(data []byte) bool {
+	return e.emit(e.action, data)
 }
 
 // Propagate flushes an event after ActionHold.
@@ -439,6 +499,8 @@ func (p *processor) Spawn(parent *Event, nodes []*insaneJSON.Node) {
 		child := &Event{
 			Root:       insaneJSON.Spawn(),
 			SourceName: parent.SourceName,
+			Meta:       maps.Clone(parent.Meta),
+			inTime:     parent.inTime,
 		}
 		parent.children = append(parent.children, child)
 		child.Root.MutateToNode(node)
@@ -448,7 +510,14 @@ func (p *processor) Spawn(parent *Event, nodes []*insaneJSON.Node) {
 		ok, _ := p.doActions(child)
 		if ok {
 			child.stage = eventStageOutput
-			p.router.Out(child)
+			if p.spiller != nil {
+				// the lost child is counted in the spill queue errors, the parent is committed anyway like in spiller.out
+				if !p.spiller.spill(child) {
+					p.discard(child)
+				}
+			} else {
+				p.router.Out(child)
+			}
 		}
 	}
 
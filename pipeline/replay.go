@@ -0,0 +1,91 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ozontech/file.d/pipeline/doif"
+	"golang.org/x/time/rate"
+)
+
+const replayActionType = "replay"
+
+// ReplaySettings turns the pipeline into the replay of the dead queue events:
+// the events are filtered, the annotations of the failure are removed
+// and the input is rate limited.
+type ReplaySettings struct {
+	// AnnotationField is the path of the annotations object field to remove, it's set by the dead queue "annotate.field".
+	AnnotationField []string
+	// DoIf selects the events to replay, it can use the annotations. All the events are replayed if it's nil.
+	DoIf *doif.Checker
+	// Rate is the max number of the input events per second, it's unlimited if it's zero.
+	Rate int
+}
+
+// replayAction is the first action of the replaying pipeline.
+// It drops the events not matching the do_if and removes the dead queue annotations from the rest.
+type replayAction struct {
+	settings *ReplaySettings
+}
+
+func newReplayActionInfo(settings *ReplaySettings) *ActionPluginStaticInfo {
+	return &ActionPluginStaticInfo{
+		PluginStaticInfo: &PluginStaticInfo{
+			Type: replayActionType,
+			Factory: func() (AnyPlugin, AnyConfig) {
+				return &replayAction{}, settings
+			},
+			Config: settings,
+		},
+		MetricName: replayActionType,
+	}
+}
+
+func (a *replayAction) Start(config AnyConfig, _ *ActionPluginParams) {
+	a.settings = config.(*ReplaySettings)
+}
+
+func (a *replayAction) Stop() {}
+
+func (a *replayAction) Do(event *Event) ActionResult {
+	// the annotations are removed after the check, so do_if can select the events by the failure
+	if a.settings.DoIf != nil && !a.settings.DoIf.Check(doif.NewEventDataWithMeta(event.Root, event.Meta)) {
+		return ActionDiscard
+	}
+
+	if len(a.settings.AnnotationField) > 0 {
+		event.Root.Dig(a.settings.AnnotationField...).Suicide()
+	}
+	for key := range event.Meta {
+		if strings.HasPrefix(key, DeadQueueMetaPrefix) {
+			delete(event.Meta, key)
+		}
+	}
+
+	return ActionPass
+}
+
+// replayLimiter limits the rate of the input events of the replaying pipeline.
+type replayLimiter struct {
+	limiter *rate.Limiter
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func newReplayLimiter(eventsPerSecond int) *replayLimiter {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &replayLimiter{
+		limiter: rate.NewLimiter(rate.Limit(eventsPerSecond), eventsPerSecond),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// wait blocks until the next event is allowed, it returns immediately after the stop.
+func (l *replayLimiter) wait() {
+	_ = l.limiter.Wait(l.ctx)
+}
+
+func (l *replayLimiter) stop() {
+	l.cancel()
+}
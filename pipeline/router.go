@@ -1,11 +1,52 @@
 package pipeline
 
+import (
+	"time"
+
+	"github.com/ozontech/file.d/logger"
+	"github.com/ozontech/file.d/pipeline/doif"
+)
+
+// MaxOutputRoutes is the max count of outputs the pipeline can route events to.
+const MaxOutputRoutes = 64
+
+// OutputRoute describes one of the outputs the pipeline routes events to.
+type OutputRoute struct {
+	Output *OutputPluginInfo
+	// DeadQueue is optional.
+	DeadQueue *OutputPluginInfo
+	// DeadQueueAnnotation is optional.
+	DeadQueueAnnotation *DeadQueueAnnotation
+	// DoIfChecker selects the events for the output. If it's nil, the output receives all the events.
+	DoIfChecker *doif.Checker
+	// IsDefault is true if the output receives only the events that don't match any do_if condition.
+	IsDefault bool
+}
+
 type Router struct {
 	output     OutputPlugin
 	outputInfo *OutputPluginInfo
 
 	deadQueue     OutputPlugin
 	deadQueueInfo *OutputPluginInfo
+	// deadQueueAnnotation adds the failure info to the dead queue events, it may be nil.
+	deadQueueAnnotation *DeadQueueAnnotation
+
+	// routes are used instead of the output if the pipeline fans events out to several outputs.
+	// Every route is a router with its own output and dead queue.
+	routes []*Router
+	// isRoute is true for the router which is a route of the fan-out router.
+	isRoute bool
+	// doIfChecker and isDefault select the events for the route, see OutputRoute.
+	doIfChecker *doif.Checker
+	isDefault   bool
+	// hasDefault is true if any of the routes is default.
+	hasDefault bool
+
+	// latency observes the events committed by the output, it may be nil.
+	latency *eventLatency
+	// index is the index of the route in the config.
+	index int
 }
 
 func NewRouter() *Router {
@@ -22,21 +63,154 @@ func (r *Router) SetDeadQueueOutput(info *OutputPluginInfo) {
 	r.deadQueue = info.Plugin.(OutputPlugin)
 }
 
-func (r *Router) Ack(event *Event) {
-	// TODO: send commit to input after receiving all acks from outputs
+func (r *Router) SetDeadQueueAnnotation(annotation *DeadQueueAnnotation) {
+	r.deadQueueAnnotation = annotation
+}
+
+// AddOutput adds one more output the events are routed to.
+func (r *Router) AddOutput(outputRoute *OutputRoute) {
+	if len(r.routes) == MaxOutputRoutes {
+		logger.Panicf("too many outputs, max count is %d", MaxOutputRoutes)
+	}
+
+	route := NewRouter()
+	route.isRoute = true
+	route.index = len(r.routes)
+	route.doIfChecker = outputRoute.DoIfChecker
+	route.isDefault = outputRoute.IsDefault
+	route.SetOutput(outputRoute.Output)
+	if outputRoute.DeadQueue != nil {
+		route.SetDeadQueueOutput(outputRoute.DeadQueue)
+	}
+	route.SetDeadQueueAnnotation(outputRoute.DeadQueueAnnotation)
+
+	r.hasDefault = r.hasDefault || route.isDefault
+	r.routes = append(r.routes, route)
+}
+
+// Ack is called on every commit of the event by an output.
+// It returns true if all the outputs have acknowledged the event,
+// so the event can be committed to the input.
+func (r *Router) Ack(event *Event) bool {
+	if !r.isFanOut() {
+		return true
+	}
+	if event.origin != nil {
+		event = event.origin
+	}
+
+	return event.pendingAcks.Dec() <= 0
 }
 
+// Fail passes the event the output has failed to send to the dead queue.
 func (r *Router) Fail(event *Event) {
-	if r.IsDeadQueueAvailable() {
+	r.FailBatch(&Failure{Events: []*Event{event}})
+}
+
+// FailBatch passes the events the output has failed to send to the dead queue,
+// the events are annotated with the failure info if it's configured.
+func (r *Router) FailBatch(failure *Failure) {
+	if !r.IsDeadQueueAvailable() {
+		return
+	}
+
+	// the output doesn't commit the failed events, the dead queue commits them instead
+	now := time.Now()
+	for _, event := range failure.Events {
+		if r.deadQueueAnnotation.isEnabled() {
+			if r.isRoute && event.origin == nil {
+				// the event can still be used by the other outputs
+				event = event.outputCopy()
+			}
+			r.deadQueueAnnotation.annotate(event, r.outputInfo.Type, failure, now)
+		}
 		r.deadQueue.Out(event)
 	}
 }
 
-func (r *Router) Out(event *Event) {
-	r.output.Out(event)
+// Out passes the event to the outputs.
+// It returns false if the event doesn't match any output,
+// in that case the event isn't committed and should be finalized by the caller.
+func (r *Router) Out(event *Event) bool {
+	if !r.isFanOut() {
+		r.output.Out(event)
+		return true
+	}
+
+	matched, count := r.match(event)
+	if count == 0 {
+		return false
+	}
+
+	// all acks must be expected before any output receives the event
+	event.pendingAcks.Store(count)
+
+	// the outputs may change the event in place, so every matched route except the first one
+	// receives its own copy, the copies are made before any output receives the event
+	var events [MaxOutputRoutes]*Event
+	isFirst := true
+	for i := range r.routes {
+		if matched&(1<<i) == 0 {
+			continue
+		}
+		if isFirst {
+			events[i] = event
+			isFirst = false
+			continue
+		}
+		events[i] = event.outputCopy()
+	}
+	for i, route := range r.routes {
+		if events[i] != nil {
+			route.Out(events[i])
+		}
+	}
+
+	return true
+}
+
+// match returns the bit mask of the routes matched by the event and their count.
+func (r *Router) match(event *Event) (uint64, int32) {
+	var (
+		matched      uint64
+		count        int32
+		isCondRouted bool
+	)
+	for i, route := range r.routes {
+		if route.isDefault {
+			continue
+		}
+		if route.doIfChecker != nil {
+			if !route.doIfChecker.Check(doif.NewEventDataWithMeta(event.Root, event.Meta)) {
+				continue
+			}
+			isCondRouted = true
+		}
+		matched |= 1 << i
+		count++
+	}
+
+	if isCondRouted || !r.hasDefault {
+		return matched, count
+	}
+
+	for i, route := range r.routes {
+		if route.isDefault {
+			matched |= 1 << i
+			count++
+		}
+	}
+	return matched, count
 }
 
 func (r *Router) Stop() {
+	for _, route := range r.routes {
+		route.Stop()
+	}
+	if r.output == nil {
+		return
+	}
+
 	r.output.Stop()
 	if r.IsDeadQueueAvailable() {
 		r.deadQueue.Stop()
@@ -48,9 +222,50 @@ func (r *Router) IsDeadQueueAvailable() bool {
 }
 
 func (r *Router) Start(params *OutputPluginParams) {
+	for _, route := range r.routes {
+		routeParams := *params
+		routeParams.Logger = params.Logger.Named(route.outputInfo.Type)
+		route.latency = r.latency
+		route.Start(&routeParams)
+	}
+	if r.output == nil {
+		return
+	}
+
 	params.Router = r
-	r.output.Start(r.outputInfo.Config, params)
+	outputParams := *params
+	if r.latency != nil {
+		outputParams.Controller = r.latency.controller(params.Controller, r.outputInfo.Type, r.index)
+	}
+	r.output.Start(r.outputInfo.Config, &outputParams)
+	// the dead queue doesn't deliver the events, so its commits aren't observed
 	if r.IsDeadQueueAvailable() {
 		r.deadQueue.Start(r.deadQueueInfo.Config, params)
 	}
 }
+
+func (r *Router) isFanOut() bool {
+	return len(r.routes) > 0
+}
+
+func (r *Router) hasOutput() bool {
+	return r.output != nil || r.isFanOut()
+}
+
+// outputInfos returns infos of all outputs in the order of the config.
+func (r *Router) outputInfos() []*OutputPluginInfo {
+	routers := r.outputRouters()
+	infos := make([]*OutputPluginInfo, 0, len(routers))
+	for _, router := range routers {
+		infos = append(infos, router.outputInfo)
+	}
+	return infos
+}
+
+// outputRouters returns the routers with the outputs in the order of the config.
+func (r *Router) outputRouters() []*Router {
+	if !r.isFanOut() {
+		return []*Router{r}
+	}
+	return r.routes
+}
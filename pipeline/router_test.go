@@ -1,15 +1,20 @@
 package pipeline_test
 
 import (
+	"encoding/json"
+	"errors"
+	"maps"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/pipeline/doif"
 	"github.com/ozontech/file.d/plugin/output/devnull"
 	"github.com/ozontech/file.d/test"
 	insaneJSON "github.com/ozontech/insane-json"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
 )
 
@@ -141,6 +146,314 @@ func TestRouterDeadQueueProcessing(t *testing.T) {
 	assert.Empty(t, controller.getErrors(), "should not produce errors")
 }
 
+// ackOutputPluginController commits the event only after the router acks it like the pipeline does.
+type ackOutputPluginController struct {
+	fakeOutputPluginController
+	router *pipeline.Router
+}
+
+func (c *ackOutputPluginController) Commit(event *pipeline.Event) {
+	if !c.router.Ack(event) {
+		return
+	}
+	c.fakeOutputPluginController.Commit(event)
+}
+
+func TestRouterFanOut(t *testing.T) {
+	t.Parallel()
+
+	r := pipeline.NewRouter()
+	controller := &ackOutputPluginController{router: r}
+
+	var firstCount atomic.Int32
+	var firstEvent, heldEvent *pipeline.Event
+	firstPlugin, firstConfig := createDevNullPlugin(func(event *pipeline.Event) {
+		firstCount.Add(1)
+		firstEvent = event
+	})
+	r.AddOutput(&pipeline.OutputRoute{
+		Output: &pipeline.OutputPluginInfo{
+			PluginStaticInfo:  &pipeline.PluginStaticInfo{Config: firstConfig, Type: "devnull"},
+			PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: firstPlugin},
+		},
+	})
+
+	// Second output has a dead queue that shouldn't be used
+	var secondCount atomic.Int32
+	secondPlugin, secondConfig := createDevNullPlugin(func(event *pipeline.Event) {
+		secondCount.Add(1)
+		heldEvent = event
+		// the output changes the event in place like gelf and loki do
+		event.Root.AddField("changed").MutateToBool(true)
+	})
+	var deadQueueCount atomic.Int32
+	deadQueuePlugin, deadQueueConfig := createDevNullPlugin(func(event *pipeline.Event) {
+		deadQueueCount.Add(1)
+	})
+	r.AddOutput(&pipeline.OutputRoute{
+		Output: &pipeline.OutputPluginInfo{
+			PluginStaticInfo:  &pipeline.PluginStaticInfo{Config: secondConfig, Type: "devnull"},
+			PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: secondPlugin},
+		},
+		DeadQueue: &pipeline.OutputPluginInfo{
+			PluginStaticInfo:  &pipeline.PluginStaticInfo{Config: deadQueueConfig, Type: "devnull"},
+			PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: deadQueuePlugin},
+		},
+	})
+
+	params := test.NewEmptyOutputPluginParams()
+	params.PipelineName = "test_pipeline"
+	params.Controller = controller
+	r.Start(params)
+	defer r.Stop()
+
+	event := newEvent(t)
+	assert.True(t, r.Out(event), "event should be routed")
+
+	assert.Equal(t, int32(1), firstCount.Load(), "first output should receive the event")
+	assert.Equal(t, int32(1), secondCount.Load(), "second output should receive the event")
+	assert.Same(t, event, firstEvent, "first output should receive the original event")
+	assert.NotSame(t, event, heldEvent, "second output should receive the copy of the event")
+	assert.Nil(t, event.Root.Dig("changed"), "the change of the copy shouldn't affect the original event")
+	assert.NotNil(t, heldEvent.Root.Dig("changed"))
+	assert.Len(t, controller.getCommits(), 1, "event should be committed once after all acks")
+
+	assert.Empty(t, controller.getErrors(), "should not produce errors")
+}
+
+// TestRouterFanOutDeadQueue checks that the event passed to the dead queue by one of the outputs
+// is committed to the input after the commits of the other output and the dead queue.
+func TestRouterFanOutDeadQueue(t *testing.T) {
+	p, input := newTestPipeline(t, "", nil)
+
+	okPlugin, okConfig := createDevNullPlugin(nil)
+	deadQueuePlugin, deadQueueConfig := createDevNullPlugin(nil)
+	p.AddOutput(&pipeline.OutputRoute{
+		Output: &pipeline.OutputPluginInfo{
+			PluginStaticInfo:  &pipeline.PluginStaticInfo{Config: okConfig, Type: "devnull"},
+			PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: okPlugin},
+		},
+	})
+	p.AddOutput(&pipeline.OutputRoute{
+		Output: &pipeline.OutputPluginInfo{
+			PluginStaticInfo:  &pipeline.PluginStaticInfo{Type: "fail"},
+			PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: &failOutput{}},
+		},
+		DeadQueue: &pipeline.OutputPluginInfo{
+			PluginStaticInfo:  &pipeline.PluginStaticInfo{Config: deadQueueConfig, Type: "devnull"},
+			PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: deadQueuePlugin},
+		},
+	})
+
+	commits := atomic.NewInt32(0)
+	input.SetCommitFn(func(_ *pipeline.Event) {
+		commits.Inc()
+	})
+
+	require.NoError(t, p.Start())
+	defer p.Stop()
+
+	const count = 10
+	for i := 0; i < count; i++ {
+		input.In(0, "test.log", test.NewOffset(int64(i)), []byte(`{"message":"test"}`))
+	}
+
+	require.Eventually(t, func() bool {
+		return commits.Load() == count
+	}, 5*time.Second, 10*time.Millisecond, "all events must be committed to the input")
+}
+
+func TestRouterDoIf(t *testing.T) {
+	t.Parallel()
+
+	r := pipeline.NewRouter()
+	controller := &ackOutputPluginController{router: r}
+
+	errorsChecker, err := doif.NewFromMap(map[string]any{
+		"op":     "equal",
+		"field":  "level",
+		"values": []any{"error"},
+	})
+	require.NoError(t, err)
+
+	addOutput := func(counter *atomic.Int32, checker *doif.Checker, isDefault bool) {
+		plugin, config := createDevNullPlugin(func(event *pipeline.Event) {
+			counter.Add(1)
+		})
+		r.AddOutput(&pipeline.OutputRoute{
+			Output: &pipeline.OutputPluginInfo{
+				PluginStaticInfo:  &pipeline.PluginStaticInfo{Config: config, Type: "devnull"},
+				PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: plugin},
+			},
+			DoIfChecker: checker,
+			IsDefault:   isDefault,
+		})
+	}
+
+	var errorsCount, allCount, defaultCount atomic.Int32
+	addOutput(&errorsCount, errorsChecker, false)
+	addOutput(&allCount, nil, false)
+	addOutput(&defaultCount, nil, true)
+
+	params := test.NewEmptyOutputPluginParams()
+	params.PipelineName = "test_pipeline"
+	params.Controller = controller
+	r.Start(params)
+	defer r.Stop()
+
+	errorEvent := newEvent(t)
+	errorEvent.Root.AddField("level").MutateToString("error")
+	assert.True(t, r.Out(errorEvent), "error event should be routed")
+
+	assert.Equal(t, int32(1), errorsCount.Load(), "error event should match do_if")
+	assert.Equal(t, int32(1), allCount.Load(), "output without do_if should receive all events")
+	assert.Equal(t, int32(0), defaultCount.Load(), "matched event shouldn't go to default output")
+
+	infoEvent := newEvent(t)
+	infoEvent.Root.AddField("level").MutateToString("info")
+	assert.True(t, r.Out(infoEvent), "info event should be routed")
+
+	assert.Equal(t, int32(1), errorsCount.Load(), "info event shouldn't match do_if")
+	assert.Equal(t, int32(2), allCount.Load(), "output without do_if should receive all events")
+	assert.Equal(t, int32(1), defaultCount.Load(), "not matched event should go to default output")
+	assert.Len(t, controller.getCommits(), 2, "events should be committed once after all acks")
+}
+
+func TestRouterNotMatched(t *testing.T) {
+	t.Parallel()
+
+	r := pipeline.NewRouter()
+
+	checker, err := doif.NewFromMap(map[string]any{
+		"op":     "equal",
+		"field":  "level",
+		"values": []any{"error"},
+	})
+	require.NoError(t, err)
+
+	plugin, config := createDevNullPlugin(nil)
+	r.AddOutput(&pipeline.OutputRoute{
+		Output: &pipeline.OutputPluginInfo{
+			PluginStaticInfo:  &pipeline.PluginStaticInfo{Config: config, Type: "devnull"},
+			PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: plugin},
+		},
+		DoIfChecker: checker,
+	})
+
+	params := test.NewEmptyOutputPluginParams()
+	params.Controller = &ackOutputPluginController{router: r}
+	r.Start(params)
+	defer r.Stop()
+
+	assert.False(t, r.Out(newEvent(t)), "event shouldn't be routed")
+}
+
+// failOutput passes all the events to the dead queue like the output which has failed to send the batch.
+type failOutput struct {
+	router *pipeline.Router
+}
+
+func (o *failOutput) Start(_ pipeline.AnyConfig, params *pipeline.OutputPluginParams) {
+	o.router = params.Router
+}
+
+func (o *failOutput) Stop() {}
+
+func (o *failOutput) Out(event *pipeline.Event) {
+	o.router.FailBatch(&pipeline.Failure{
+		Events:  []*pipeline.Event{event},
+		Err:     errors.New("connection refused"),
+		Retries: 3,
+		BatchID: 7,
+	})
+}
+
+func TestRouterDeadQueueAnnotation(t *testing.T) {
+	p, input := newTestPipeline(t, "", nil)
+
+	var (
+		mu            sync.Mutex
+		okEvent       string
+		deadQueueJSON string
+		deadQueueMeta map[string]string
+	)
+	okPlugin, okConfig := createDevNullPlugin(func(event *pipeline.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		okEvent = event.Root.EncodeToString()
+	})
+	deadQueuePlugin, deadQueueConfig := createDevNullPlugin(func(event *pipeline.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		deadQueueJSON = event.Root.EncodeToString()
+		deadQueueMeta = maps.Clone(event.Meta)
+	})
+
+	p.AddOutput(&pipeline.OutputRoute{
+		Output: &pipeline.OutputPluginInfo{
+			PluginStaticInfo:  &pipeline.PluginStaticInfo{Config: okConfig, Type: "devnull"},
+			PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: okPlugin},
+		},
+	})
+	p.AddOutput(&pipeline.OutputRoute{
+		Output: &pipeline.OutputPluginInfo{
+			PluginStaticInfo:  &pipeline.PluginStaticInfo{Type: "fail"},
+			PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: &failOutput{}},
+		},
+		DeadQueue: &pipeline.OutputPluginInfo{
+			PluginStaticInfo:  &pipeline.PluginStaticInfo{Config: deadQueueConfig, Type: "devnull"},
+			PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: deadQueuePlugin},
+		},
+		DeadQueueAnnotation: &pipeline.DeadQueueAnnotation{
+			Field: []string{"deadqueue"},
+			Meta:  true,
+		},
+	})
+
+	commits := atomic.NewInt32(0)
+	input.SetCommitFn(func(_ *pipeline.Event) {
+		commits.Inc()
+	})
+
+	require.NoError(t, p.Start())
+	defer p.Stop()
+	input.In(0, "test.log", test.NewOffset(0), []byte(`{"message":"test"}`))
+
+	// the event is committed after the commits of the output and the dead queue
+	require.Eventually(t, func() bool {
+		return commits.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, `{"message":"test"}`, okEvent, "the event of the other output must not be annotated")
+
+	var annotated struct {
+		Message   string `json:"message"`
+		DeadQueue struct {
+			Output    string `json:"output"`
+			Error     string `json:"error"`
+			Retries   int    `json:"retries"`
+			BatchID   int64  `json:"batch_id"`
+			Timestamp string `json:"timestamp"`
+		} `json:"deadqueue"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(deadQueueJSON), &annotated))
+	require.Equal(t, "test", annotated.Message)
+	require.Equal(t, "fail", annotated.DeadQueue.Output)
+	require.Equal(t, "connection refused", annotated.DeadQueue.Error)
+	require.Equal(t, 3, annotated.DeadQueue.Retries)
+	require.Equal(t, int64(7), annotated.DeadQueue.BatchID)
+	_, err := time.Parse(time.RFC3339Nano, annotated.DeadQueue.Timestamp)
+	require.NoError(t, err)
+
+	require.Equal(t, "fail", deadQueueMeta["deadqueue_output"])
+	require.Equal(t, "connection refused", deadQueueMeta["deadqueue_error"])
+	require.Equal(t, "3", deadQueueMeta["deadqueue_retries"])
+	require.Equal(t, "7", deadQueueMeta["deadqueue_batch_id"])
+	require.Equal(t, annotated.DeadQueue.Timestamp, deadQueueMeta["deadqueue_timestamp"])
+}
+
 func createDevNullPlugin(outFn func(event *pipeline.Event)) (*devnull.Plugin, pipeline.AnyConfig) {
 	plugin, config := devnull.Factory()
 	p := plugin.(*devnull.Plugin)
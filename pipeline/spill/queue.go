@@ -0,0 +1,584 @@
+// Package spill implements the disk queue the pipeline uses to spill processed events before the outputs.
+package spill
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	segmentExt    = ".seg"
+	committedFile = "committed"
+
+	// headerSize is the size of the record header: length and checksum of the data.
+	headerSize = 8
+
+	// segmentHeaderSize is the size of the segment header: magic, format version and record version.
+	segmentHeaderSize = 8
+	segmentMagic      = "FDSQ"
+	// formatVersion is the version of the segment layout, it's changed if the layout is changed incompatibly.
+	formatVersion = 1
+)
+
+var (
+	ErrClosed   = errors.New("queue is closed")
+	ErrTooLarge = errors.New("record is larger than max size of the queue")
+	// ErrCorrupted is returned by Read if the record is corrupted, e.g. the file.d has crashed while writing it.
+	// The rest of the segment is skipped, so the next Read returns the record from the next segment.
+	ErrCorrupted = errors.New("record is corrupted")
+	// ErrUnsupportedVersion is returned by Read if the segment is written in another format or with another record version,
+	// e.g. by the previous file.d version. The segment is skipped, so the next Read returns the record from the next segment.
+	ErrUnsupportedVersion = errors.New("segment version isn't supported")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// Position is the position in the queue right after the record.
+type Position struct {
+	Segment uint64
+	Offset  int64
+}
+
+type Options struct {
+	Dir string
+	// MaxSize is the max total size of the segments, Write blocks if it's reached.
+	MaxSize int64
+	// SegmentSize is the size after which a new segment is started.
+	SegmentSize int64
+	// RecordVersion is the version of the records layout, it's stored in the segment header.
+	// The segments with another version are skipped on read.
+	RecordVersion uint16
+}
+
+type segment struct {
+	id   uint64
+	size int64
+}
+
+// Queue is the append-only queue of records stored in the segment files.
+// Every segment starts with the header of the format and record versions,
+// so the segments written in the incompatible format aren't replayed.
+// Records are read in the order of writing, the committed records are removed on segment basis.
+// The records are synced to the disk by Write and the committed position is persisted by Sync,
+// so the queue replays the uncommitted records after restart.
+//
+// Queue supports concurrent writers and the single reader.
+type Queue struct {
+	dir           string
+	maxSize       int64
+	segmentSize   int64
+	segmentHeader []byte
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	segments []*segment
+	// lastID is the id of the last segment, ids are never reused even if all the segments are removed
+	lastID uint64
+	size   int64
+	closed bool
+
+	active     *os.File
+	activeSize int64
+	writeBuf   []byte
+
+	// written and synced are the numbers of the records written and synced to the disk,
+	// syncing is set while the active segment is synced by one of the writers.
+	written uint64
+	synced  uint64
+	syncing bool
+
+	readFile    *os.File
+	readSegment uint64
+	readOffset  int64
+	readBuf     []byte
+
+	committed       Position
+	syncedCommitted Position
+}
+
+func NewQueue(o *Options) (*Queue, error) {
+	if o.MaxSize <= 0 || o.SegmentSize <= 0 {
+		return nil, fmt.Errorf("max size and segment size must be positive")
+	}
+	if err := os.MkdirAll(o.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("can't create queue dir: %w", err)
+	}
+
+	q := &Queue{
+		dir:           o.Dir,
+		maxSize:       o.MaxSize,
+		segmentSize:   o.SegmentSize,
+		segmentHeader: newSegmentHeader(o.RecordVersion),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	if err := q.loadSegments(); err != nil {
+		return nil, err
+	}
+	if err := q.loadCommitted(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// CheckDir checks that the queue can be opened in the dir, i.e. the dir can be created, read and written.
+// It doesn't touch the segments, so it can be called while the queue is opened by another instance.
+func CheckDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("can't create queue dir: %w", err)
+	}
+	if _, err := os.ReadDir(dir); err != nil {
+		return fmt.Errorf("can't read queue dir: %w", err)
+	}
+
+	file, err := os.CreateTemp(dir, "check-*")
+	if err != nil {
+		return fmt.Errorf("can't write queue dir: %w", err)
+	}
+	_ = file.Close()
+	return os.Remove(file.Name())
+}
+
+func newSegmentHeader(recordVersion uint16) []byte {
+	header := make([]byte, 0, segmentHeaderSize)
+	header = append(header, segmentMagic...)
+	header = binary.LittleEndian.AppendUint16(header, formatVersion)
+	return binary.LittleEndian.AppendUint16(header, recordVersion)
+}
+
+func (q *Queue) loadSegments() error {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return fmt.Errorf("can't read queue dir: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("can't stat segment %q: %w", name, err)
+		}
+
+		q.segments = append(q.segments, &segment{id: id, size: info.Size()})
+		q.size += info.Size()
+		q.lastID = max(q.lastID, id)
+	}
+
+	sort.Slice(q.segments, func(i, j int) bool {
+		return q.segments[i].id < q.segments[j].id
+	})
+	return nil
+}
+
+func (q *Queue) loadCommitted() error {
+	data, err := os.ReadFile(filepath.Join(q.dir, committedFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return q.resetRead()
+	}
+	if err != nil {
+		return fmt.Errorf("can't read committed position: %w", err)
+	}
+	if len(data) != 20 || crc32.Checksum(data[:16], crcTable) != binary.LittleEndian.Uint32(data[16:]) {
+		// replay everything, duplicates are better than losses
+		return q.resetRead()
+	}
+
+	q.committed = Position{
+		Segment: binary.LittleEndian.Uint64(data),
+		Offset:  int64(binary.LittleEndian.Uint64(data[8:])),
+	}
+	q.syncedCommitted = q.committed
+	q.lastID = max(q.lastID, q.committed.Segment)
+
+	if err := q.removeCommitted(); err != nil {
+		return err
+	}
+	if len(q.segments) > 0 && q.segments[0].id == q.committed.Segment {
+		q.readSegment = q.committed.Segment
+		q.readOffset = q.committed.Offset
+		return nil
+	}
+	return q.resetRead()
+}
+
+func (q *Queue) resetRead() error {
+	q.readOffset = 0
+	if len(q.segments) > 0 {
+		q.readSegment = q.segments[0].id
+	}
+	return nil
+}
+
+// Write appends the record to the queue and returns after the record is synced to the disk.
+// The records of the concurrent writers are synced together.
+// It blocks while the queue has reached max size.
+func (q *Queue) Write(data []byte) error {
+	recordSize := int64(headerSize + len(data))
+	if segmentHeaderSize+recordSize > q.maxSize {
+		return ErrTooLarge
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for !q.closed && q.size+segmentHeaderSize+recordSize > q.maxSize {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return ErrClosed
+	}
+
+	if q.active == nil || q.activeSize > segmentHeaderSize && q.activeSize+recordSize > q.segmentSize {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+
+	q.writeBuf = binary.LittleEndian.AppendUint32(q.writeBuf[:0], uint32(len(data)))
+	q.writeBuf = binary.LittleEndian.AppendUint32(q.writeBuf, crc32.Checksum(data, crcTable))
+	q.writeBuf = append(q.writeBuf, data...)
+	if _, err := q.active.Write(q.writeBuf); err != nil {
+		return fmt.Errorf("can't write segment: %w", err)
+	}
+
+	q.activeSize += recordSize
+	q.size += recordSize
+	q.segments[len(q.segments)-1].size = q.activeSize
+	q.written++
+	q.cond.Broadcast()
+
+	return q.syncWritten(q.written)
+}
+
+// syncWritten waits until the record with the number is synced to the disk.
+// The first waiting writer syncs the records of all the writers at once,
+// the others wait for it. It should be called under the lock.
+func (q *Queue) syncWritten(record uint64) error {
+	for q.syncing && q.synced < record {
+		q.cond.Wait()
+	}
+	if q.synced >= record {
+		return nil
+	}
+
+	q.syncing = true
+	active := q.active
+	written := q.written
+	q.mu.Unlock()
+	// the segment may be rotated meanwhile, then it's synced on close as well
+	err := active.Sync()
+	q.mu.Lock()
+	q.syncing = false
+	if err == nil {
+		q.synced = max(q.synced, written)
+	}
+	q.cond.Broadcast()
+
+	if q.synced >= record {
+		return nil
+	}
+	return fmt.Errorf("can't sync segment: %w", err)
+}
+
+// rotate starts a new segment, it should be called under the lock.
+func (q *Queue) rotate() error {
+	if err := q.closeActive(); err != nil {
+		return err
+	}
+
+	id := q.lastID + 1
+	file, err := os.OpenFile(q.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("can't create segment: %w", err)
+	}
+
+	if _, err := file.Write(q.segmentHeader); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("can't write segment header: %w", err)
+	}
+
+	q.lastID = id
+	q.segments = append(q.segments, &segment{id: id, size: segmentHeaderSize})
+	q.active = file
+	q.activeSize = segmentHeaderSize
+	q.size += segmentHeaderSize
+	return nil
+}
+
+func (q *Queue) closeActive() error {
+	if q.active == nil {
+		return nil
+	}
+
+	active := q.active
+	q.active = nil
+	if err := active.Sync(); err != nil {
+		_ = active.Close()
+		return fmt.Errorf("can't sync segment: %w", err)
+	}
+	q.synced = q.written
+	return active.Close()
+}
+
+// Read returns the next record and the position right after it.
+// It blocks until there is a record to read or the queue is closed.
+// The returned data is valid until the next call.
+func (q *Queue) Read() ([]byte, Position, error) {
+	for {
+		q.mu.Lock()
+		for {
+			if q.closed {
+				q.mu.Unlock()
+				if q.readFile != nil {
+					_ = q.readFile.Close()
+					q.readFile = nil
+				}
+				return nil, Position{}, ErrClosed
+			}
+
+			seg := q.findReadSegment()
+			if seg != nil && q.readOffset < seg.size {
+				break
+			}
+			q.cond.Wait()
+		}
+		limit := q.findReadSegment().size
+		q.mu.Unlock()
+
+		data, err := q.readRecord(limit)
+		if err != nil {
+			// skip the rest of the segment
+			q.mu.Lock()
+			q.readOffset = limit
+			q.mu.Unlock()
+			return nil, Position{}, err
+		}
+		// the segment has only the header, e.g. the file.d has crashed right after its creation
+		if data == nil {
+			continue
+		}
+
+		return data, Position{Segment: q.readSegment, Offset: q.readOffset}, nil
+	}
+}
+
+// findReadSegment moves the read position to the next segment if the current one is read
+// and returns the segment to read from, it should be called under the lock.
+func (q *Queue) findReadSegment() *segment {
+	for i, seg := range q.segments {
+		if seg.id < q.readSegment {
+			continue
+		}
+		if seg.id > q.readSegment {
+			q.readSegment = seg.id
+			q.readOffset = 0
+		}
+
+		isLast := i == len(q.segments)-1
+		if q.readOffset >= seg.size && !isLast {
+			continue
+		}
+		return seg
+	}
+	return nil
+}
+
+func (q *Queue) readRecord(limit int64) ([]byte, error) {
+	if q.readFile == nil || q.readFile.Name() != q.segmentPath(q.readSegment) {
+		if q.readFile != nil {
+			_ = q.readFile.Close()
+		}
+		file, err := os.Open(q.segmentPath(q.readSegment))
+		if err != nil {
+			q.readFile = nil
+			return nil, fmt.Errorf("can't open segment: %w", err)
+		}
+		q.readFile = file
+
+		if err := q.checkSegmentHeader(limit); err != nil {
+			return nil, err
+		}
+		if q.readOffset == limit {
+			return nil, nil
+		}
+	}
+
+	if limit-q.readOffset < headerSize {
+		return nil, ErrCorrupted
+	}
+	var header [headerSize]byte
+	if _, err := q.readFile.ReadAt(header[:], q.readOffset); err != nil {
+		return nil, fmt.Errorf("can't read segment: %w", err)
+	}
+
+	length := int64(binary.LittleEndian.Uint32(header[:]))
+	if q.readOffset+headerSize+length > limit {
+		return nil, ErrCorrupted
+	}
+	if int64(cap(q.readBuf)) < length {
+		q.readBuf = make([]byte, length)
+	}
+	q.readBuf = q.readBuf[:length]
+	if _, err := q.readFile.ReadAt(q.readBuf, q.readOffset+headerSize); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("can't read segment: %w", err)
+	}
+	if crc32.Checksum(q.readBuf, crcTable) != binary.LittleEndian.Uint32(header[4:]) {
+		return nil, ErrCorrupted
+	}
+
+	q.mu.Lock()
+	q.readOffset += headerSize + length
+	q.mu.Unlock()
+
+	return q.readBuf, nil
+}
+
+// checkSegmentHeader checks the header of the opened read segment
+// and moves the read position after the header.
+func (q *Queue) checkSegmentHeader(limit int64) error {
+	if limit < segmentHeaderSize {
+		return ErrCorrupted
+	}
+	var header [segmentHeaderSize]byte
+	if _, err := q.readFile.ReadAt(header[:], 0); err != nil {
+		return fmt.Errorf("can't read segment header: %w", err)
+	}
+	if string(header[:]) != string(q.segmentHeader) {
+		return ErrUnsupportedVersion
+	}
+
+	q.mu.Lock()
+	q.readOffset = max(q.readOffset, segmentHeaderSize)
+	q.mu.Unlock()
+	return nil
+}
+
+// Commit marks all the records before the position as processed and removes the committed segments.
+// Positions must be committed in the order of reading.
+func (q *Queue) Commit(pos Position) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.committed = pos
+	return q.removeCommitted()
+}
+
+// removeCommitted removes the segments which are committed entirely, it should be called under the lock.
+func (q *Queue) removeCommitted() error {
+	removed := 0
+	for _, seg := range q.segments {
+		isActive := removed == len(q.segments)-1 && q.active != nil
+		isCommitted := seg.id < q.committed.Segment || seg.id == q.committed.Segment && seg.size <= q.committed.Offset
+		if !isCommitted {
+			break
+		}
+
+		if isActive {
+			if err := q.closeActive(); err != nil {
+				return err
+			}
+		}
+		if err := os.Remove(q.segmentPath(seg.id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("can't remove segment: %w", err)
+		}
+		q.size -= seg.size
+		removed++
+	}
+
+	if removed > 0 {
+		q.segments = append(q.segments[:0], q.segments[removed:]...)
+		q.cond.Broadcast()
+	}
+	return nil
+}
+
+// Sync persists the committed position.
+func (q *Queue) Sync() error {
+	q.mu.Lock()
+	committed := q.committed
+	q.mu.Unlock()
+
+	if committed == q.syncedCommitted {
+		return nil
+	}
+
+	data := make([]byte, 0, 20)
+	data = binary.LittleEndian.AppendUint64(data, committed.Segment)
+	data = binary.LittleEndian.AppendUint64(data, uint64(committed.Offset))
+	data = binary.LittleEndian.AppendUint32(data, crc32.Checksum(data, crcTable))
+
+	tmp := filepath.Join(q.dir, committedFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("can't write committed position: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(q.dir, committedFile)); err != nil {
+		return fmt.Errorf("can't write committed position: %w", err)
+	}
+
+	q.syncedCommitted = committed
+	return nil
+}
+
+// Unread returns the size of the records which aren't read yet.
+func (q *Queue) Unread() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	unread := int64(0)
+	for _, seg := range q.segments {
+		if seg.id < q.readSegment {
+			continue
+		}
+		start := int64(segmentHeaderSize)
+		if seg.id == q.readSegment {
+			start = max(start, q.readOffset)
+		}
+		unread += max(seg.size-start, 0)
+	}
+	return unread
+}
+
+// Size returns the total size of the segments.
+func (q *Queue) Size() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.size
+}
+
+// Close wakes up the blocked reader and writers and closes the active segment.
+// Commit and Sync can be called after Close to persist the progress.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	q.cond.Broadcast()
+
+	return q.closeActive()
+}
+
+func (q *Queue) segmentPath(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
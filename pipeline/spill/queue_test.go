@@ -0,0 +1,204 @@
+package spill
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestQueue(t *testing.T, dir string, maxSize, segmentSize int64) *Queue {
+	return newTestQueueVersion(t, dir, maxSize, segmentSize, 1)
+}
+
+func newTestQueueVersion(t *testing.T, dir string, maxSize, segmentSize int64, recordVersion uint16) *Queue {
+	q, err := NewQueue(&Options{
+		Dir:           dir,
+		MaxSize:       maxSize,
+		SegmentSize:   segmentSize,
+		RecordVersion: recordVersion,
+	})
+	require.NoError(t, err)
+	return q
+}
+
+func readRecords(t *testing.T, q *Queue, count int) ([]string, Position) {
+	records := make([]string, 0, count)
+	var pos Position
+	for i := 0; i < count; i++ {
+		data, p, err := q.Read()
+		require.NoError(t, err)
+		records = append(records, string(data))
+		pos = p
+	}
+	return records, pos
+}
+
+func TestQueueReplay(t *testing.T) {
+	dir := t.TempDir()
+	q := newTestQueue(t, dir, 1024*1024, 64)
+
+	expected := make([]string, 0)
+	for i := 0; i < 20; i++ {
+		record := "record_" + strconv.Itoa(i)
+		expected = append(expected, record)
+		require.NoError(t, q.Write([]byte(record)))
+	}
+
+	records, _ := readRecords(t, q, 5)
+	require.Equal(t, expected[:5], records)
+	_, pos := readRecords(t, q, 5)
+	require.NoError(t, q.Commit(pos))
+	require.NoError(t, q.Sync())
+	require.NoError(t, q.Close())
+
+	// the records after the committed position are replayed after restart
+	q = newTestQueue(t, dir, 1024*1024, 64)
+	records, pos = readRecords(t, q, 10)
+	require.Equal(t, expected[10:], records)
+
+	require.NoError(t, q.Write([]byte("new")))
+	records, _ = readRecords(t, q, 1)
+	require.Equal(t, []string{"new"}, records)
+
+	require.NoError(t, q.Commit(pos))
+	require.Less(t, q.Size(), int64(64), "committed segments should be removed")
+	require.NoError(t, q.Close())
+}
+
+func TestQueueUnread(t *testing.T) {
+	q := newTestQueue(t, t.TempDir(), 1024*1024, 64)
+	defer func() {
+		require.NoError(t, q.Close())
+	}()
+	require.Zero(t, q.Unread())
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, q.Write([]byte("record_"+strconv.Itoa(i))))
+	}
+	require.Equal(t, int64(10*(headerSize+len("record_0"))), q.Unread())
+
+	readRecords(t, q, 5)
+	require.Equal(t, int64(5*(headerSize+len("record_0"))), q.Unread())
+	readRecords(t, q, 5)
+	require.Zero(t, q.Unread())
+}
+
+func TestQueueCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	q := newTestQueue(t, dir, 1024*1024, 1024)
+	require.NoError(t, q.Write([]byte("first")))
+	require.NoError(t, q.Write([]byte("second")))
+	require.NoError(t, q.Close())
+
+	// corrupt the data of the second record
+	path := q.segmentPath(1)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] = 'X'
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	q = newTestQueue(t, dir, 1024*1024, 1024)
+	records, _ := readRecords(t, q, 1)
+	require.Equal(t, []string{"first"}, records)
+	_, _, err = q.Read()
+	require.ErrorIs(t, err, ErrCorrupted)
+
+	require.NoError(t, q.Write([]byte("third")))
+	records, _ = readRecords(t, q, 1)
+	require.Equal(t, []string{"third"}, records)
+	require.NoError(t, q.Close())
+
+	_, err = os.Stat(filepath.Join(dir, "00000000000000000002.seg"))
+	require.NoError(t, err, "new records should be written to the new segment")
+}
+
+func TestQueueMaxSize(t *testing.T) {
+	// every record takes 18 bytes with the header and is written to its own segment with 8 bytes header
+	q := newTestQueue(t, t.TempDir(), 56, 16)
+	require.ErrorIs(t, q.Write(make([]byte, 41)), ErrTooLarge)
+
+	require.NoError(t, q.Write([]byte("0123456789")))
+	require.NoError(t, q.Write([]byte("0123456789")))
+
+	written := make(chan error)
+	go func() {
+		written <- q.Write([]byte("0123456789"))
+	}()
+
+	select {
+	case <-written:
+		require.Fail(t, "write should block until the queue is committed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_, pos := readRecords(t, q, 1)
+	require.NoError(t, q.Commit(pos))
+	require.NoError(t, <-written)
+
+	require.NoError(t, q.Close())
+	_, _, err := q.Read()
+	require.ErrorIs(t, err, ErrClosed)
+}
+
+func TestQueueVersion(t *testing.T) {
+	dir := t.TempDir()
+	q := newTestQueueVersion(t, dir, 1024*1024, 1024, 1)
+	require.NoError(t, q.Write([]byte("first")))
+	require.NoError(t, q.Close())
+
+	// the segment of another record version is skipped
+	q = newTestQueueVersion(t, dir, 1024*1024, 1024, 2)
+	require.NoError(t, q.Write([]byte("second")))
+	_, _, err := q.Read()
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+	records, _ := readRecords(t, q, 1)
+	require.Equal(t, []string{"second"}, records)
+	require.NoError(t, q.Close())
+
+	// the segment without the header, e.g. written before the versioning
+	require.NoError(t, os.WriteFile(q.segmentPath(3), []byte("\x05\x00\x00\x00\x00\x00\x00\x00third"), 0o644))
+	// the segment with the header only, e.g. file.d has crashed after its creation
+	require.NoError(t, os.WriteFile(q.segmentPath(4), newSegmentHeader(2), 0o644))
+	q = newTestQueueVersion(t, dir, 1024*1024, 1024, 2)
+	require.NoError(t, q.Write([]byte("fourth")))
+	_, _, err = q.Read()
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+	records, _ = readRecords(t, q, 1)
+	require.Equal(t, []string{"second"}, records)
+	_, _, err = q.Read()
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+	records, _ = readRecords(t, q, 1)
+	require.Equal(t, []string{"fourth"}, records)
+	require.NoError(t, q.Close())
+}
+
+func TestQueueWriteSync(t *testing.T) {
+	// the segments are rotated while the records are synced
+	q := newTestQueue(t, t.TempDir(), 1<<20, 64)
+
+	const writers, records = 8, 100
+	wg := sync.WaitGroup{}
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < records; j++ {
+				require.NoError(t, q.Write([]byte("0123456789")))
+			}
+		}()
+	}
+	wg.Wait()
+
+	q.mu.Lock()
+	require.Equal(t, uint64(writers*records), q.written)
+	require.Equal(t, q.written, q.synced, "all the written records must be synced")
+	q.mu.Unlock()
+
+	readRecords(t, q, writers*records)
+	require.NoError(t, q.Close())
+}
@@ -0,0 +1,326 @@
+package pipeline
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline/spill"
+	"go.uber.org/zap"
+)
+
+// spilledRecordVersion is the version of the spilled event layout, see decodeSpilled.
+// It must be increased if the layout is changed, so the events of the previous layout aren't replayed.
+const spilledRecordVersion = 1
+
+// spiller passes the processed events to the router through the disk queue.
+// The event is committed to the input right after it's written and synced to the queue,
+// so slow outputs don't block the input and the events survive the restart.
+// The events are read from the queue in the order of writing, the queue is committed
+// up to the first event which isn't committed by the outputs yet.
+type spiller struct {
+	queue    *spill.Queue
+	router   *Router
+	finalize finalizeFn
+	// discard finalizes the events lost because of the spill queue errors.
+	discard func(event *Event)
+	logger  *zap.Logger
+
+	// free events to read the queue into, they aren't from the event pool.
+	free chan *Event
+	// inFlight is the ring of the events passed to the router, event.SeqID is the index in the ring.
+	inFlight []spilledRecord
+	head     uint64
+	mu       sync.Mutex
+
+	bufs sync.Pool
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+
+	sizeMetric     *metric.Gauge
+	spilledMetric  *metric.Counter
+	replayedMetric *metric.Counter
+	errorsMetric   *metric.Counter
+}
+
+type spilledRecord struct {
+	event *Event
+	pos   spill.Position
+	done  bool
+}
+
+// spillQueueDir returns the dir of the pipeline spill queue, the pipelines share the configured dir.
+func spillQueueDir(pipelineName string, settings *Settings) string {
+	return filepath.Join(settings.SpillQueue.Dir, pipelineName)
+}
+
+func newSpiller(pipelineName string, settings *Settings, router *Router, finalize finalizeFn, discard func(event *Event), metricCtl *metric.Ctl, lg *zap.Logger) (*spiller, error) {
+	maxSize := settings.SpillQueue.MaxSize
+	if maxSize == 0 {
+		maxSize = DefaultSpillQueueMaxSize
+	}
+	segmentSize := settings.SpillQueue.SegmentSize
+	if segmentSize == 0 {
+		segmentSize = DefaultSpillQueueSegmentSize
+	}
+
+	queue, err := spill.NewQueue(&spill.Options{
+		Dir:           spillQueueDir(pipelineName, settings),
+		MaxSize:       maxSize,
+		SegmentSize:   segmentSize,
+		RecordVersion: spilledRecordVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &spiller{
+		queue:    queue,
+		router:   router,
+		finalize: finalize,
+		discard:  discard,
+		logger:   lg,
+		free:     make(chan *Event, settings.Capacity),
+		inFlight: make([]spilledRecord, settings.Capacity),
+		bufs: sync.Pool{
+			New: func() any {
+				return &[]byte{}
+			},
+		},
+		stopCh: make(chan struct{}),
+
+		sizeMetric:     metricCtl.RegisterGauge("spill_queue_size_bytes", "Size of the spill queue segments"),
+		spilledMetric:  metricCtl.RegisterCounter("spill_queue_spilled_events_total", "Events written to the spill queue"),
+		replayedMetric: metricCtl.RegisterCounter("spill_queue_replayed_events_total", "Events read from the spill queue and passed to the outputs"),
+		errorsMetric:   metricCtl.RegisterCounter("spill_queue_errors_total", "Events lost because of the spill queue errors"),
+	}
+	for i := 0; i < settings.Capacity; i++ {
+		event := newEvent()
+		event.kind = eventKindSpilled
+		s.free <- event
+	}
+	s.sizeMetric.Set(float64(queue.Size()))
+
+	lg.Info("spill queue is opened", zap.Int64("size", queue.Size()), zap.Int64("max_size", maxSize))
+	return s, nil
+}
+
+func (s *spiller) start() {
+	s.wg.Add(1)
+	go s.replay()
+}
+
+// stop stops reading the queue, the events passed to the router still can be committed.
+func (s *spiller) stop() {
+	close(s.stopCh)
+	if err := s.queue.Close(); err != nil {
+		s.logger.Error("can't close spill queue", zap.Error(err))
+	}
+	s.wg.Wait()
+}
+
+// inFlightEvents returns the number of the events read from the queue which aren't committed by the outputs yet.
+func (s *spiller) inFlightEvents() int64 {
+	return int64(len(s.inFlight) - len(s.free))
+}
+
+// out spills the processed event and commits it to the input.
+func (s *spiller) out(event *Event) {
+	// children of the parent are spilled on spawn, so the parent is just committed
+	if !event.IsChildParentKind() && !s.spill(event) {
+		// can't notify input here, because previous events may delay, and we'll get offset sequence corruption.
+		s.discard(event)
+		return
+	}
+
+	s.finalize(event, true, true)
+}
+
+// spill writes the event to the queue, it returns false if the event is lost.
+// It blocks while the queue is full.
+func (s *spiller) spill(event *Event) bool {
+	buf := s.bufs.Get().(*[]byte)
+	defer s.bufs.Put(buf)
+
+	data := binary.LittleEndian.AppendUint64((*buf)[:0], uint64(event.SourceID))
+	inTime := int64(0)
+	if !event.inTime.IsZero() {
+		inTime = event.inTime.UnixNano()
+	}
+	data = binary.LittleEndian.AppendUint64(data, uint64(inTime))
+	data = appendSpilledString(data, event.SourceName)
+	metaCount := min(len(event.Meta), math.MaxUint16)
+	data = binary.LittleEndian.AppendUint16(data, uint16(metaCount))
+	for k, v := range event.Meta {
+		if metaCount == 0 {
+			break
+		}
+		data = appendSpilledString(data, k)
+		data = appendSpilledString(data, v)
+		metaCount--
+	}
+	data = event.Root.Encode(data)
+	*buf = data
+
+	if err := s.queue.Write(data); err != nil {
+		s.errorsMetric.Inc()
+		s.logger.Error("can't write event to spill queue, event is lost", zap.Error(err))
+		return false
+	}
+
+	s.spilledMetric.Inc()
+	return true
+}
+
+func (s *spiller) replay() {
+	defer s.wg.Done()
+
+	seq := uint64(0)
+	for {
+		var event *Event
+		select {
+		case event = <-s.free:
+		case <-s.stopCh:
+			return
+		}
+
+		data, pos, err := s.queue.Read()
+		if errors.Is(err, spill.ErrClosed) {
+			return
+		}
+		if err != nil {
+			s.free <- event
+			s.errorsMetric.Inc()
+			s.logger.Error("can't read spill queue, the rest of the segment is skipped", zap.Error(err))
+			continue
+		}
+
+		event.SeqID = seq
+		s.mu.Lock()
+		s.inFlight[seq%uint64(len(s.inFlight))] = spilledRecord{event: event, pos: pos}
+		s.mu.Unlock()
+		seq++
+
+		if err := decodeSpilled(event, data); err != nil {
+			s.errorsMetric.Inc()
+			s.logger.Error("can't decode event from spill queue, event is lost", zap.Error(err))
+			s.commit(event)
+			continue
+		}
+
+		s.replayedMetric.Inc()
+		if !s.router.Out(event) {
+			s.commit(event)
+		}
+	}
+}
+
+func appendSpilledString(data []byte, s string) []byte {
+	if len(s) > math.MaxUint16 {
+		s = s[:math.MaxUint16]
+	}
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(s)))
+	return append(data, s...)
+}
+
+func readSpilledString(data []byte) (string, []byte, error) {
+	if len(data) < 2 {
+		return "", nil, errSpilledTooShort
+	}
+	l := int(binary.LittleEndian.Uint16(data))
+	if len(data) < 2+l {
+		return "", nil, errSpilledTooShort
+	}
+	return string(data[2 : 2+l]), data[2+l:], nil
+}
+
+var errSpilledTooShort = errors.New("record is too short")
+
+// decodeSpilled decodes the record of the format:
+// source id | input time | source name | meta count | meta keys and values | event JSON.
+// The strings are prefixed by the uint16 length.
+func decodeSpilled(event *Event, data []byte) error {
+	if len(data) < 16 {
+		return errSpilledTooShort
+	}
+	event.SourceID = SourceID(binary.LittleEndian.Uint64(data))
+	event.inTime = time.Time{}
+	if inTime := int64(binary.LittleEndian.Uint64(data[8:])); inTime != 0 {
+		event.inTime = time.Unix(0, inTime)
+	}
+
+	var err error
+	event.SourceName, data, err = readSpilledString(data[16:])
+	if err != nil {
+		return err
+	}
+
+	if len(data) < 2 {
+		return errSpilledTooShort
+	}
+	metaCount := int(binary.LittleEndian.Uint16(data))
+	data = data[2:]
+	clear(event.Meta)
+	for i := 0; i < metaCount; i++ {
+		var k, v string
+		if k, data, err = readSpilledString(data); err != nil {
+			return err
+		}
+		if v, data, err = readSpilledString(data); err != nil {
+			return err
+		}
+		event.SetMeta(k, v)
+	}
+
+	event.Size = len(data)
+	event.Buf = event.Buf[:0]
+	return event.Root.DecodeBytes(data)
+}
+
+// commit is called when the outputs have committed the spilled event.
+func (s *spiller) commit(event *Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ringSize := uint64(len(s.inFlight))
+	s.inFlight[event.SeqID%ringSize].done = true
+
+	committed := false
+	var pos spill.Position
+	for {
+		record := &s.inFlight[s.head%ringSize]
+		if record.event == nil || !record.done {
+			break
+		}
+
+		pos = record.pos
+		committed = true
+		s.free <- record.event
+		*record = spilledRecord{}
+		s.head++
+	}
+
+	if !committed {
+		return
+	}
+	if err := s.queue.Commit(pos); err != nil {
+		s.logger.Error("can't commit spill queue", zap.Error(err))
+	}
+}
+
+// sync persists the committed position of the queue.
+func (s *spiller) sync() {
+	if err := s.queue.Sync(); err != nil {
+		s.logger.Error("can't sync spill queue", zap.Error(err))
+	}
+}
+
+func (s *spiller) maintenance() {
+	s.sync()
+	s.sizeMetric.Set(float64(s.queue.Size()))
+}
@@ -0,0 +1,87 @@
+package pipeline_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/pipeline/metadata"
+	"github.com/ozontech/file.d/plugin/output/devnull"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func TestSpillQueueReplay(t *testing.T) {
+	const eventsCount = 100
+	dir := t.TempDir()
+
+	// the output is stuck, but the input events are committed, since they are spilled
+	stuckOutput := &noCommitOutput{}
+	p, input := newTestPipeline(t, dir, stuckOutput)
+
+	inputCommits := atomic.NewInt32(eventsCount)
+	input.SetCommitFn(func(_ *pipeline.Event) {
+		inputCommits.Dec()
+	})
+	require.NoError(t, p.Start())
+	for i := 0; i < eventsCount; i++ {
+		meta := metadata.MetaData{"id": strconv.Itoa(i)}
+		p.In(0, "test.log", test.NewOffset(int64(i)), []byte(`{"id":`+strconv.Itoa(i)+`}`), false, meta)
+	}
+	test.WaitForEvents(inputCommits)
+	require.Eventually(t, func() bool {
+		return stuckOutput.received.Load() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	p.Stop()
+
+	// all the events are replayed in order after restart
+	anyPlugin, _ := devnull.Factory()
+	output := anyPlugin.(*devnull.Plugin)
+	p, _ = newTestPipeline(t, dir, output)
+
+	var mu sync.Mutex
+	ids := make([]string, 0, eventsCount)
+	metaIDs := make([]string, 0, eventsCount)
+	outputs := atomic.NewInt32(eventsCount)
+	output.SetOutFn(func(event *pipeline.Event) {
+		mu.Lock()
+		ids = append(ids, strings.Clone(event.Root.Dig("id").AsString()))
+		metaIDs = append(metaIDs, event.Meta["id"])
+		mu.Unlock()
+		outputs.Dec()
+	})
+	require.NoError(t, p.Start())
+	test.WaitForEvents(outputs)
+	p.Stop()
+
+	require.Len(t, ids, eventsCount)
+	for i, id := range ids {
+		require.Equal(t, strconv.Itoa(i), id)
+	}
+	// the metadata is spilled along with the event
+	require.Equal(t, ids, metaIDs)
+}
+
+func TestSpillQueueDrain(t *testing.T) {
+	// the input events are committed on spilling, but the drain waits for the outputs
+	stuckOutput := &noCommitOutput{}
+	p, input := newTestPipeline(t, t.TempDir(), stuckOutput)
+
+	inputCommits := atomic.NewInt32(1)
+	input.SetCommitFn(func(_ *pipeline.Event) {
+		inputCommits.Dec()
+	})
+	require.NoError(t, p.Start())
+	defer p.Stop()
+	p.In(0, "test.log", test.NewOffset(0), []byte(`{"id":0}`), false, nil)
+	test.WaitForEvents(inputCommits)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, p.Drain(ctx), context.DeadlineExceeded)
+}
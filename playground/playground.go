@@ -92,10 +92,9 @@ func (h *playground) Play(ctx context.Context, req PlayRequest) (PlayResponse, e
 		},
 	}
 	metricsRegistry := prometheus.NewRegistry()
-	p := pipeline.New(pipelineName, settings, metricsRegistry, stdout)
-	// Check logger.Fatal() calls.
-	if fatalErr != nil {
-		return PlayResponse{}, fatalErr
+	p, err := pipeline.New(pipelineName, settings, metricsRegistry, stdout)
+	if err != nil {
+		return PlayResponse{}, err
 	}
 
 	// Callback to collect output events.
@@ -111,7 +110,9 @@ func (h *playground) Play(ctx context.Context, req PlayRequest) (PlayResponse, e
 		return PlayResponse{}, fatalErr
 	}
 
-	p.Start()
+	if err := p.Start(); err != nil {
+		return PlayResponse{}, err
+	}
 	if fatalErr != nil {
 		return PlayResponse{}, fatalErr
 	}
@@ -0,0 +1,240 @@
+package aggregate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	insaneJSON "github.com/ozontech/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It groups the events by the `key` fields over the tumbling windows and passes one summary event per group when the window is closed.
+So the high-volume logs, e.g. the access logs, can be shipped as the per-minute statistics.
+
+The windows are aligned to the `window` duration, e.g. the `1m` windows start at the beginning of the minute.
+The window is closed by the first event after its end or by the pipeline maintenance tick if there are no events.
+The groups are shared by the processors of the pipeline, their number within the window is limited by `max_groups`,
+the events of the new groups over the limit are passed as is.
+
+The summary event has the `key` fields, the window start in `window_start_field`, the number of the events in `count_field`
+and the results of the `fields` operations in the `<field>_<op>` fields, where `<field>` is the field path joined with `_`:
+* `sum`, `min`, `max` – of the numeric values, the non-numeric values are skipped;
+* `first`, `last` – the first and the last values of the field.
+
+The results are omitted if there are no values to calculate them from.
+
+The summaries of the closed windows are passed on the pipeline maintenance tick to the actions following the plugin,
+so they are passed even if there are no more events. They have no metadata and aren't committed to the input.
+The original events are discarded unless `keep_originals` is set.
+
+On the pipeline stop, e.g. on shutdown or reload, the summaries of the open window are passed before the outputs are stopped,
+the events received after that are passed as is.
+
+> ⚠ The aggregated events are committed to the input right away, so the summaries are lost if file.d crashes or the stop times out.
+
+Config:
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: aggregate
+      key: [service, status]
+      window: 1m
+      fields:
+        - field: duration_ms
+          ops: [sum, min, max]
+        - field: request_id
+          ops: [last]
+    ...
+```
+
+The input:
+```json
+{"service":"api","status":200,"duration_ms":10,"request_id":"a"}
+{"service":"api","status":200,"duration_ms":30,"request_id":"b"}
+```
+
+The summary:
+```json
+{"service":"api","status":200,"window_start":"2024-01-01T10:00:00Z","count":2,"duration_ms_sum":40,"duration_ms_min":10,"duration_ms_max":30,"request_id_last":"b"}
+```
+
+The events passed as is because of `max_groups` are counted in the `action_aggregate_overflow_events_total` metric.
+}*/
+
+const (
+	opSum   = "sum"
+	opMin   = "min"
+	opMax   = "max"
+	opFirst = "first"
+	opLast  = "last"
+)
+
+type Plugin struct {
+	config *Config
+	logger *zap.Logger
+
+	windowName string
+	window     *window
+	keys       [][]string
+
+	keyBuf      []byte
+	keyNodesBuf []*insaneJSON.Node
+
+	// plugin metrics
+	overflowMetric *metric.Counter
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The fields to group the events by. All the events are in the same group if it's empty.
+	Key []cfg.FieldSelector `json:"key" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The duration of the window.
+	Window  cfg.Duration `json:"window" default:"1m" parse:"duration"` // *
+	Window_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > The fields to aggregate:
+	// > * `field` – the path of the field
+	// > * `ops` – the list of `sum`, `min`, `max`, `first` and `last`
+	Fields []Field `json:"fields" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The field of the summary to put the number of the events in.
+	CountField  cfg.FieldSelector `json:"count_field" default:"count" parse:"selector"` // *
+	CountField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The field of the summary to put the window start in, it's formatted as RFC3339 with nanoseconds.
+	WindowStartField  cfg.FieldSelector `json:"window_start_field" default:"window_start" parse:"selector"` // *
+	WindowStartField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > If set, the original events are passed along with the summaries.
+	KeepOriginals bool `json:"keep_originals"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Max number of the groups within the window.
+	MaxGroups int `json:"max_groups" default:"100000"` // *
+}
+
+type Field struct {
+	Field cfg.FieldSelector `json:"field" required:"true"`
+	Ops   []string          `json:"ops" slice:"true"`
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "aggregate",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger.Desugar()
+
+	if p.config.Window_ <= 0 {
+		p.logger.Fatal("window must be positive")
+	}
+	if p.config.MaxGroups <= 0 {
+		p.logger.Fatal("max_groups must be positive")
+	}
+
+	for _, key := range p.config.Key {
+		p.keys = append(p.keys, cfg.ParseFieldSelector(string(key)))
+	}
+
+	fields := make([][]string, 0, len(p.config.Fields))
+	for _, field := range p.config.Fields {
+		for _, op := range field.Ops {
+			switch op {
+			case opSum, opMin, opMax, opFirst, opLast:
+			default:
+				p.logger.Fatal("wrong op", zap.String("field", string(field.Field)), zap.String("op", op))
+			}
+		}
+		fields = append(fields, cfg.ParseFieldSelector(string(field.Field)))
+	}
+
+	p.overflowMetric = params.MetricCtl.RegisterCounter("action_aggregate_overflow_events_total", "Total events passed as is because of the groups limit")
+
+	tick := params.PipelineSettings.MaintenanceInterval
+	if tick <= 0 {
+		tick = pipeline.DefaultMaintenanceInterval
+	}
+
+	// the processors of the pipeline share the groups
+	p.windowName = fmt.Sprintf("%s_%d", params.PipelineName, params.Index)
+	p.window = acquireWindow(p.windowName, func() *window {
+		return newWindow(p.config, p.keys, fields, params.Emitter, tick)
+	})
+}
+
+// Flush emits the summaries of the open window on the pipeline stop, so they aren't lost.
+func (p *Plugin) Flush() {
+	p.window.flush()
+}
+
+func (p *Plugin) Stop() {
+	releaseWindow(p.windowName)
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	if p.aggregate(event) && !p.config.KeepOriginals {
+		return pipeline.ActionDiscard
+	}
+	return pipeline.ActionPass
+}
+
+// aggregate adds the event to its group, it returns false if the event isn't aggregated
+// because of the groups limit or since the window is flushed on the pipeline stop.
+func (p *Plugin) aggregate(event *pipeline.Event) bool {
+	p.keyBuf = p.keyBuf[:0]
+	p.keyNodesBuf = p.keyNodesBuf[:0]
+	for _, key := range p.keys {
+		node := event.Root.Dig(key...)
+		if node != nil {
+			p.keyBuf = node.Encode(p.keyBuf)
+		}
+		// the separator makes the values of the different fields distinct
+		p.keyBuf = append(p.keyBuf, 0)
+		p.keyNodesBuf = append(p.keyNodesBuf, node)
+	}
+
+	switch p.window.add(p.keyBuf, event, p.keyNodesBuf) {
+	case addResultOverflow:
+		p.overflowMetric.Inc()
+		return false
+	case addResultFlushed:
+		return false
+	default:
+		return true
+	}
+}
+
+func fieldName(field []string) string {
+	return strings.Join(field, "_")
+}
@@ -0,0 +1,156 @@
+package aggregate
+
+import (
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/require"
+)
+
+var windowStartRe = regexp.MustCompile(`"window_start":"[^"]+"`)
+
+type aggregateTest struct {
+	p         *pipeline.Pipeline
+	in        func(events ...string)
+	mu        sync.Mutex
+	out       []string
+	committed int
+	count     int
+}
+
+func newAggregateTest(config *Config) *aggregateTest {
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, test.NewConfig(config, nil), pipeline.MatchModeAnd, nil, false), "short_maintenance_interval")
+
+	at := &aggregateTest{p: p, out: make([]string, 0)}
+	input.SetCommitFn(func(_ *pipeline.Event) {
+		at.mu.Lock()
+		at.committed++
+		at.mu.Unlock()
+	})
+	at.in = func(events ...string) {
+		for _, event := range events {
+			input.In(0, "test.log", test.NewOffset(int64(at.count)), []byte(event))
+			at.count++
+		}
+	}
+	output.SetOutFn(func(e *pipeline.Event) {
+		if e.IsChildParentKind() {
+			return
+		}
+		// the window start depends on the current time
+		out := windowStartRe.ReplaceAllString(e.Root.EncodeToString(), `"window_start":"-"`)
+		at.mu.Lock()
+		at.out = append(at.out, out)
+		at.mu.Unlock()
+	})
+
+	return at
+}
+
+func (at *aggregateTest) waitOut(t *testing.T, count int) []string {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		at.mu.Lock()
+		defer at.mu.Unlock()
+		return len(at.out) >= count
+	}, 10*time.Second, 10*time.Millisecond)
+
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	return at.out
+}
+
+// waitWindowStart waits for the next window, so the events sent right after it are in the same window.
+func waitWindowStart(window time.Duration) {
+	now := time.Now()
+	time.Sleep(now.Truncate(window).Add(window).Sub(now))
+}
+
+func TestAggregate(t *testing.T) {
+	at := newAggregateTest(&Config{
+		Key:    []cfg.FieldSelector{"service", "status"},
+		Window: "200ms",
+		Fields: []Field{
+			{Field: "duration_ms", Ops: []string{opSum, opMin, opMax}},
+			{Field: "request.id", Ops: []string{opFirst, opLast}},
+		},
+	})
+	defer at.p.Stop()
+
+	waitWindowStart(200 * time.Millisecond)
+	at.in(
+		`{"service":"api","status":200,"duration_ms":10,"request":{"id":"a"}}`,
+		`{"service":"api","status":500,"duration_ms":"5","request":{"id":"b"}}`,
+		`{"service":"api","status":200,"duration_ms":30,"request":{"id":"c"}}`,
+		`{"service":"api","status":200,"duration_ms":"slow","request":{"id":"d"}}`,
+		`{"status":200}`,
+	)
+
+	// the summaries are passed on the maintenance tick without the next events
+	require.ElementsMatch(t, []string{
+		`{"service":"api","status":200,"window_start":"-","count":3,"duration_ms_sum":40,"duration_ms_min":10,"duration_ms_max":30,"request_id_first":"a","request_id_last":"d"}`,
+		`{"service":"api","status":500,"window_start":"-","count":1,"duration_ms_sum":5,"duration_ms_min":5,"duration_ms_max":5,"request_id_first":"b","request_id_last":"b"}`,
+		`{"status":200,"window_start":"-","count":1}`,
+	}, at.waitOut(t, 3))
+}
+
+func TestAggregateKeepOriginals(t *testing.T) {
+	at := newAggregateTest(&Config{
+		Window:        "200ms",
+		KeepOriginals: true,
+	})
+	defer at.p.Stop()
+
+	waitWindowStart(200 * time.Millisecond)
+	at.in(`{"id":1}`, `{"id":2}`)
+
+	require.Equal(t, []string{
+		`{"id":1}`,
+		`{"id":2}`,
+		`{"window_start":"-","count":2}`,
+	}, at.waitOut(t, 3))
+
+	// the summary isn't committed to the input
+	time.Sleep(100 * time.Millisecond)
+	at.mu.Lock()
+	require.Equal(t, 2, at.committed)
+	at.mu.Unlock()
+}
+
+func TestAggregateMaxGroups(t *testing.T) {
+	at := newAggregateTest(&Config{
+		Key:       []cfg.FieldSelector{"id"},
+		Window:    "1m",
+		MaxGroups: 1,
+	})
+	defer at.p.Stop()
+
+	// the events of the new groups over the limit are passed as is
+	at.in(`{"id":1}`, `{"id":2}`, `{"id":1}`, `{"id":3}`)
+
+	require.Equal(t, []string{`{"id":2}`, `{"id":3}`}, at.waitOut(t, 2))
+}
+
+func TestAggregateFlushOnStop(t *testing.T) {
+	at := newAggregateTest(&Config{
+		Window:        "1m",
+		KeepOriginals: true,
+	})
+
+	at.in(`{"id":1}`, `{"id":2}`)
+	at.waitOut(t, 2)
+
+	// the summary of the open window is passed before the pipeline is stopped
+	at.p.Stop()
+	require.Equal(t, []string{
+		`{"id":1}`,
+		`{"id":2}`,
+		`{"window_start":"-","count":2}`,
+	}, at.out)
+}
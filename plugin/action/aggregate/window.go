@@ -0,0 +1,283 @@
+package aggregate
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ozontech/file.d/pipeline"
+	insaneJSON "github.com/ozontech/insane-json"
+)
+
+var (
+	// windows are shared by the processors of the pipeline, the key is <pipeline name>_<action index>
+	windows   = map[string]*window{}
+	windowsMu = &sync.Mutex{}
+)
+
+// group is the aggregation of the events with the same key values within the window.
+type group struct {
+	// keys are the encoded values of the key fields, nil if the field is missing
+	keys   [][]byte
+	count  int
+	fields []fieldAggregation
+}
+
+type fieldAggregation struct {
+	numbers  int
+	sum      float64
+	min, max float64
+	// first and last are the encoded values of the field
+	first, last []byte
+}
+
+func (a *fieldAggregation) add(node *insaneJSON.Node) {
+	if node == nil {
+		return
+	}
+
+	value := node.Encode(nil)
+	if a.first == nil {
+		a.first = value
+	}
+	a.last = value
+
+	number, err := strconv.ParseFloat(node.AsString(), 64)
+	if err != nil {
+		return
+	}
+	if a.numbers == 0 || number < a.min {
+		a.min = number
+	}
+	if a.numbers == 0 || number > a.max {
+		a.max = number
+	}
+	a.sum += number
+	a.numbers++
+}
+
+// window is the current tumbling window with its groups and the summaries of the closed windows.
+type window struct {
+	config  *Config
+	keys    [][]string
+	fields  [][]string
+	emitter pipeline.Emitter
+
+	// emitMu serializes the emitting on the tick and on the flush, so the flush returns after all summaries are emitted
+	emitMu sync.Mutex
+	mu     sync.Mutex
+	start  time.Time
+	groups map[string]*group
+	// closed are the summaries of the closed windows to emit on the next tick
+	closed [][]byte
+	// flushed is set after the window is flushed on the pipeline stop, the events aren't aggregated anymore
+	flushed bool
+
+	refs int
+	stop chan struct{}
+}
+
+func newWindow(config *Config, keys, fields [][]string, emitter pipeline.Emitter, tick time.Duration) *window {
+	w := &window{
+		config:  config,
+		keys:    keys,
+		fields:  fields,
+		emitter: emitter,
+		start:   time.Now().Truncate(config.Window_),
+		groups:  make(map[string]*group),
+		stop:    make(chan struct{}),
+	}
+	go w.maintenance(tick)
+	return w
+}
+
+// acquireWindow returns the window shared by the processors, it's created by the first processor.
+func acquireWindow(name string, create func() *window) *window {
+	windowsMu.Lock()
+	defer windowsMu.Unlock()
+
+	w, has := windows[name]
+	if !has {
+		w = create()
+		windows[name] = w
+	}
+	w.refs++
+	return w
+}
+
+// releaseWindow stops the window after it's released by the last processor.
+func releaseWindow(name string) {
+	windowsMu.Lock()
+	defer windowsMu.Unlock()
+
+	w, has := windows[name]
+	if !has {
+		return
+	}
+	w.refs--
+	if w.refs == 0 {
+		close(w.stop)
+		delete(windows, name)
+	}
+}
+
+// maintenance closes the window on the pipeline maintenance tick, so it isn't kept open if there are no events,
+// and emits the summaries of the closed windows.
+func (w *window) maintenance(tick time.Duration) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case now := <-ticker.C:
+			w.emit(func() {
+				w.rotate(now)
+			})
+		}
+	}
+}
+
+// flush emits the summaries of the closed windows and of the open one, it's called on the pipeline stop.
+func (w *window) flush() {
+	w.emit(func() {
+		for _, g := range w.groups {
+			w.closed = append(w.closed, w.summary(g))
+		}
+		w.groups = make(map[string]*group)
+		w.flushed = true
+	})
+}
+
+// emit emits the summaries of the closed windows after the update of the window.
+func (w *window) emit(update func()) {
+	w.emitMu.Lock()
+	defer w.emitMu.Unlock()
+
+	w.mu.Lock()
+	update()
+	closed := w.closed
+	w.closed = nil
+	w.mu.Unlock()
+
+	// the summaries are emitted without the lock, so the events are aggregated meanwhile,
+	// the summaries which aren't emitted since the pipeline is stopped are lost
+	for _, summary := range closed {
+		w.emitter.Emit(summary)
+	}
+}
+
+type addResult int
+
+const (
+	addResultAdded addResult = iota
+	// addResultOverflow is returned if the new group can't be created because of the groups limit
+	addResultOverflow
+	// addResultFlushed is returned if the window is already flushed on the pipeline stop
+	addResultFlushed
+)
+
+// add aggregates the event.
+func (w *window) add(key []byte, event *pipeline.Event, keyNodes []*insaneJSON.Node) addResult {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.flushed {
+		return addResultFlushed
+	}
+
+	w.rotate(time.Now())
+
+	g, has := w.groups[string(key)]
+	if !has {
+		if len(w.groups) >= w.config.MaxGroups {
+			return addResultOverflow
+		}
+		g = &group{
+			keys:   make([][]byte, len(keyNodes)),
+			fields: make([]fieldAggregation, len(w.fields)),
+		}
+		for i, node := range keyNodes {
+			if node != nil {
+				g.keys[i] = node.Encode(nil)
+			}
+		}
+		w.groups[string(key)] = g
+	}
+
+	g.count++
+	for i, field := range w.fields {
+		g.fields[i].add(event.Root.Dig(field...))
+	}
+	return addResultAdded
+}
+
+// rotate closes the window if it's over, the summaries of its groups are emitted on the next tick.
+func (w *window) rotate(now time.Time) {
+	if now.Sub(w.start) < w.config.Window_ {
+		return
+	}
+
+	for _, g := range w.groups {
+		w.closed = append(w.closed, w.summary(g))
+	}
+
+	w.start = now.Truncate(w.config.Window_)
+	w.groups = make(map[string]*group)
+}
+
+// summary encodes the summary event of the group.
+func (w *window) summary(g *group) []byte {
+	root := insaneJSON.Spawn()
+	defer insaneJSON.Release(root)
+
+	for i, key := range g.keys {
+		if key != nil {
+			setRaw(root, w.keys[i], key)
+		}
+	}
+	pipeline.CreateNestedField(root, w.config.WindowStartField_).MutateToString(w.start.Format(time.RFC3339Nano))
+	pipeline.CreateNestedField(root, w.config.CountField_).MutateToInt(g.count)
+
+	for i, field := range w.config.Fields {
+		a := &g.fields[i]
+		prefix := fieldName(w.fields[i])
+		for _, op := range field.Ops {
+			resultField := []string{prefix + "_" + op}
+			switch op {
+			case opSum:
+				if a.numbers > 0 {
+					pipeline.CreateNestedField(root, resultField).MutateToFloat(a.sum)
+				}
+			case opMin:
+				if a.numbers > 0 {
+					pipeline.CreateNestedField(root, resultField).MutateToFloat(a.min)
+				}
+			case opMax:
+				if a.numbers > 0 {
+					pipeline.CreateNestedField(root, resultField).MutateToFloat(a.max)
+				}
+			case opFirst:
+				if a.first != nil {
+					setRaw(root, resultField, a.first)
+				}
+			case opLast:
+				if a.last != nil {
+					setRaw(root, resultField, a.last)
+				}
+			}
+		}
+	}
+
+	return root.Encode(nil)
+}
+
+func setRaw(root *insaneJSON.Root, path []string, raw []byte) {
+	node, err := root.DecodeBytesAdditional(raw)
+	if err != nil {
+		// the value is the encoded node, so it's unreachable
+		return
+	}
+	pipeline.CreateNestedField(root, path).MutateToNode(node)
+}
@@ -0,0 +1,246 @@
+package dedup
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin/action/hash"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It discards the duplicates of the events seen within the `window`.
+The key of the event is the hash of the `fields` values or of the whole event if the `fields` aren't set,
+it's calculated the same way as in the [hash](/plugin/action/hash/README.md) plugin.
+So the near-exact duplicates, e.g. with the different timestamps, can be discarded by selecting the fields which identify the event.
+
+The window of the key is opened by the first occurrence and is extended by every duplicate,
+so the key is forgotten when no duplicates are seen for the `window`, the next occurrence after that opens a new window.
+The keys are kept in the LRU limited by `max_keys`, the least recently seen key is evicted when the limit is reached.
+The keys are shared by the processors of the pipeline, if `per_stream` is set the duplicates are looked up only in the same stream.
+
+If `duplicates_count_field` is set, the first occurrence is held while its duplicates follow it in the stream
+and then it's passed with the count of the discarded duplicates in the field, the duplicates from the other streams are counted as well.
+The held event is passed when the next event of the stream isn't its duplicate,
+the `window` has passed since it's held or the stream has no events for the pipeline `event_timeout`,
+so the continuous duplicates are counted at least once per `window`.
+The next occurrence after that is held again, so the duplicates are counted exactly once.
+Like in the [join](/plugin/action/join/README.md) plugin, the held event isn't committed to the input until it's passed,
+so it's read again after the restart if the input supports that.
+The child events, e.g. spawned by the [split](/plugin/action/split/README.md) plugin, can't be held, so they're passed right away without the count.
+
+Config:
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: dedup
+      fields:
+        - request_id
+        - message
+      window: 1m
+      duplicates_count_field: duplicates_count
+    ...
+```
+
+The discarded duplicates are counted in the `action_dedup_duplicates_total` metric,
+the keys evicted before their windows are closed are counted in the `action_dedup_evicted_keys_total` metric.
+}*/
+
+type Plugin struct {
+	config     *Config
+	logger     *zap.Logger
+	controller pipeline.ActionPluginController
+
+	stateName string
+	state     *state
+	fields    [][]string
+
+	// held is the first occurrence held while its duplicates follow it in the stream
+	held      *pipeline.Event
+	heldKey   uint64
+	heldEntry *entry
+	heldSince time.Time
+
+	buf []byte
+
+	// plugin metrics
+	duplicatesMetric *metric.Counter
+	evictedMetric    *metric.Counter
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The fields to calculate the key of the event. The whole event is the key if it's empty.
+	Fields []cfg.FieldSelector `json:"fields" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The window to discard the duplicates of the first occurrence in.
+	Window  cfg.Duration `json:"window" default:"1m" parse:"duration"` // *
+	Window_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Max number of the keys kept.
+	MaxKeys int `json:"max_keys" default:"100000"` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the duplicates are looked up only in the same stream, i.e. the same source and stream name.
+	PerStream bool `json:"per_stream"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The field to put the count of the discarded duplicates in.
+	// > If set, the first occurrence is held while its duplicates follow it in the stream.
+	DuplicatesCountField  cfg.FieldSelector `json:"duplicates_count_field" parse:"selector"` // *
+	DuplicatesCountField_ []string
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "dedup",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger.Desugar()
+	p.controller = params.Controller
+
+	if p.config.Window_ <= 0 {
+		p.logger.Fatal("window must be positive")
+	}
+	if p.config.MaxKeys <= 0 {
+		p.logger.Fatal("max_keys must be positive")
+	}
+
+	for _, field := range p.config.Fields {
+		p.fields = append(p.fields, cfg.ParseFieldSelector(string(field)))
+	}
+
+	p.duplicatesMetric = params.MetricCtl.RegisterCounter("action_dedup_duplicates_total", "Total duplicates discarded")
+	p.evictedMetric = params.MetricCtl.RegisterCounter("action_dedup_evicted_keys_total", "Total keys evicted before their windows are closed")
+
+	// the processors of the pipeline share the keys
+	p.stateName = fmt.Sprintf("%s_%d", params.PipelineName, params.Index)
+	p.state = acquireState(p.stateName, func() *state {
+		return newState(p.config.Window_, p.config.MaxKeys)
+	})
+}
+
+func (p *Plugin) Stop() {
+	releaseState(p.stateName)
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	// the stream of the held event has no events for the event timeout
+	if event.IsTimeoutKind() {
+		if p.held != nil {
+			p.flush()
+		}
+		return pipeline.ActionDiscard
+	}
+
+	now := time.Now()
+	key := p.key(event)
+	if !p.holdsEvents() || event.IsChildKind() {
+		_, isDuplicate := p.dedup(key, now)
+		if isDuplicate {
+			return pipeline.ActionDiscard
+		}
+		return pipeline.ActionPass
+	}
+
+	// the continuous duplicates don't hold the event for longer than the window,
+	// the key is forgotten on the flush, so the event opens a new window
+	if p.held != nil && now.Sub(p.heldSince) >= p.config.Window_ {
+		p.flush()
+	}
+
+	e, isDuplicate := p.dedup(key, now)
+	if isDuplicate {
+		// the collapsed event keeps the stream held
+		if p.held != nil {
+			return pipeline.ActionCollapse
+		}
+		return pipeline.ActionDiscard
+	}
+
+	// the held event is passed before the next one to keep the order of the input commits
+	if p.held != nil {
+		p.flush()
+	}
+	p.held = event
+	p.heldKey = key
+	p.heldEntry = e
+	p.heldSince = now
+	return pipeline.ActionHold
+}
+
+// dedup checks if the key is the duplicate, the entry is the window of the key.
+func (p *Plugin) dedup(key uint64, now time.Time) (*entry, bool) {
+	e, isDuplicate, evicted := p.state.see(key, now)
+	if evicted {
+		p.evictedMetric.Inc()
+	}
+	if isDuplicate {
+		p.duplicatesMetric.Inc()
+	}
+	return e, isDuplicate
+}
+
+// key calculates the hash of the fields values or the whole event.
+func (p *Plugin) key(event *pipeline.Event) uint64 {
+	p.buf = p.buf[:0]
+	if p.config.PerStream {
+		p.buf = fmt.Appendf(p.buf, "%d", event.SourceID)
+		p.buf = append(p.buf, 0)
+		p.buf = append(p.buf, event.StreamNameBytes()...)
+		p.buf = append(p.buf, 0)
+	}
+
+	if len(p.fields) == 0 {
+		p.buf = event.Root.Encode(p.buf)
+		return hash.CalcHash(p.buf)
+	}
+
+	for _, field := range p.fields {
+		if node := event.Root.Dig(field...); node != nil {
+			p.buf = node.Encode(p.buf)
+		}
+		// the separator makes the values of the different fields distinct
+		p.buf = append(p.buf, 0)
+	}
+	return hash.CalcHash(p.buf)
+}
+
+// flush passes the held event with the count of its duplicates and forgets its key,
+// so the next occurrence is held again.
+func (p *Plugin) flush() {
+	event := p.held
+	p.held = nil
+
+	duplicates := p.state.forget(p.heldKey, p.heldEntry)
+	p.heldEntry = nil
+	pipeline.CreateNestedField(event.Root, p.config.DuplicatesCountField_).MutateToInt(duplicates)
+	p.controller.Propagate(event)
+}
+
+func (p *Plugin) holdsEvents() bool {
+	return len(p.config.DuplicatesCountField_) > 0
+}
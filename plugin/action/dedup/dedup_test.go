@@ -0,0 +1,202 @@
+package dedup
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/require"
+)
+
+type dedupTest struct {
+	p         *pipeline.Pipeline
+	in        func(events ...string)
+	mu        sync.Mutex
+	out       []string
+	committed []int64
+	count     int
+}
+
+func newDedupTest(config *Config, pipelineOpts ...string) *dedupTest {
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, test.NewConfig(config, nil), pipeline.MatchModeAnd, nil, false), pipelineOpts...)
+
+	dt := &dedupTest{p: p, out: make([]string, 0)}
+	input.SetCommitFn(func(e *pipeline.Event) {
+		dt.mu.Lock()
+		dt.committed = append(dt.committed, e.Offset)
+		dt.mu.Unlock()
+	})
+	dt.in = func(events ...string) {
+		for _, event := range events {
+			input.In(0, "test.log", test.NewOffset(int64(dt.count)), []byte(event))
+			dt.count++
+		}
+	}
+	output.SetOutFn(func(e *pipeline.Event) {
+		if e.IsChildParentKind() {
+			return
+		}
+		dt.mu.Lock()
+		dt.out = append(dt.out, strings.Clone(e.Root.EncodeToString()))
+		dt.mu.Unlock()
+	})
+
+	return dt
+}
+
+func (dt *dedupTest) waitOut(t *testing.T, count int) []string {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		dt.mu.Lock()
+		defer dt.mu.Unlock()
+		return len(dt.out) >= count
+	}, 10*time.Second, 10*time.Millisecond)
+
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	return dt.out
+}
+
+func TestDedup(t *testing.T) {
+	cases := []struct {
+		name   string
+		fields []cfg.FieldSelector
+		in     []string
+		out    []string
+	}{
+		{
+			name:   "fields",
+			fields: []cfg.FieldSelector{"id", "message"},
+			in: []string{
+				`{"id":1,"message":"a","ts":1}`,
+				`{"id":2,"message":"a","ts":2}`,
+				`{"id":1,"message":"a","ts":3}`,
+				`{"id":1,"message":"b","ts":4}`,
+				`{"id":2,"message":"a","ts":5}`,
+				`{"message":"a","ts":6}`,
+			},
+			out: []string{
+				`{"id":1,"message":"a","ts":1}`,
+				`{"id":2,"message":"a","ts":2}`,
+				`{"id":1,"message":"b","ts":4}`,
+				`{"message":"a","ts":6}`,
+			},
+		},
+		{
+			name: "whole_event",
+			in: []string{
+				`{"id":1,"ts":1}`,
+				`{"id":1,"ts":1}`,
+				`{"id":1,"ts":2}`,
+			},
+			out: []string{
+				`{"id":1,"ts":1}`,
+				`{"id":1,"ts":2}`,
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			dt := newDedupTest(&Config{Fields: tt.fields})
+			// the last event isn't a duplicate, so all the events are processed when it's passed
+			dt.in(tt.in...)
+			out := dt.waitOut(t, len(tt.out))
+			dt.p.Stop()
+
+			require.Equal(t, tt.out, out)
+		})
+	}
+}
+
+func TestDedupWindow(t *testing.T) {
+	dt := newDedupTest(&Config{Fields: []cfg.FieldSelector{"id"}, Window: "200ms"})
+	defer dt.p.Stop()
+
+	dt.in(`{"id":1,"ts":1}`, `{"id":1,"ts":2}`)
+	dt.waitOut(t, 1)
+	time.Sleep(300 * time.Millisecond)
+	dt.in(`{"id":1,"ts":3}`, `{"id":1,"ts":4}`)
+
+	require.Equal(t, []string{`{"id":1,"ts":1}`, `{"id":1,"ts":3}`}, dt.waitOut(t, 2))
+}
+
+func TestDedupCount(t *testing.T) {
+	dt := newDedupTest(&Config{
+		Fields:               []cfg.FieldSelector{"id"},
+		Window:               "1m",
+		DuplicatesCountField: "dedup.count",
+	}, "short_event_timeout")
+	defer dt.p.Stop()
+
+	// the held event is passed with the next event of the stream which isn't its duplicate
+	dt.in(`{"id":1}`, `{"id":1}`, `{"id":1}`, `{"id":2}`)
+	require.Equal(t, []string{`{"id":1,"dedup":{"count":2}}`}, dt.waitOut(t, 1))
+
+	// the last held event is passed after the event timeout and the next occurrence is held again
+	require.Equal(t, []string{
+		`{"id":1,"dedup":{"count":2}}`,
+		`{"id":2,"dedup":{"count":0}}`,
+	}, dt.waitOut(t, 2))
+	dt.in(`{"id":2}`, `{"id":2}`)
+
+	require.Equal(t, []string{
+		`{"id":1,"dedup":{"count":2}}`,
+		`{"id":2,"dedup":{"count":0}}`,
+		`{"id":2,"dedup":{"count":1}}`,
+	}, dt.waitOut(t, 3))
+
+	// the held events are committed after they're passed, the duplicates aren't committed
+	require.Eventually(t, func() bool {
+		dt.mu.Lock()
+		defer dt.mu.Unlock()
+		return len(dt.committed) == 3
+	}, 10*time.Second, 10*time.Millisecond)
+	dt.mu.Lock()
+	require.Equal(t, []int64{0, 3, 4}, dt.committed)
+	dt.mu.Unlock()
+}
+
+func TestDedupSlidingWindow(t *testing.T) {
+	dt := newDedupTest(&Config{Fields: []cfg.FieldSelector{"id"}, Window: "300ms"})
+	defer dt.p.Stop()
+
+	// every duplicate extends the window
+	dt.in(`{"id":1,"ts":1}`)
+	for i := 2; i <= 4; i++ {
+		time.Sleep(150 * time.Millisecond)
+		dt.in(`{"id":1,"ts":` + strconv.Itoa(i) + `}`)
+	}
+	time.Sleep(400 * time.Millisecond)
+	dt.in(`{"id":1,"ts":5}`)
+
+	require.Equal(t, []string{`{"id":1,"ts":1}`, `{"id":1,"ts":5}`}, dt.waitOut(t, 2))
+}
+
+func TestDedupCountContinuous(t *testing.T) {
+	dt := newDedupTest(&Config{
+		Fields:               []cfg.FieldSelector{"id"},
+		Window:               "300ms",
+		DuplicatesCountField: "dedup.count",
+	})
+	defer dt.p.Stop()
+
+	// the continuous duplicates don't hold the event for longer than the window
+	dt.in(`{"id":1}`)
+	require.Eventually(t, func() bool {
+		dt.in(`{"id":1}`)
+		dt.mu.Lock()
+		defer dt.mu.Unlock()
+		return len(dt.out) > 0
+	}, 10*time.Second, 50*time.Millisecond)
+
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	require.Regexp(t, `^\{"id":1,"dedup":\{"count":[1-9][0-9]*\}\}$`, dt.out[0])
+}
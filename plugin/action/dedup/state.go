@@ -0,0 +1,113 @@
+package dedup
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+)
+
+const shardsCount = 16
+
+var (
+	// states are shared by the processors of the pipeline, the key is <pipeline name>_<action index>
+	states   = map[string]*state{}
+	statesMu = &sync.Mutex{}
+)
+
+// entry is the key seen within the window.
+type entry struct {
+	lastSeen   time.Time
+	duplicates int
+}
+
+type shard struct {
+	mu  sync.Mutex
+	lru *simplelru.LRU[uint64, *entry]
+}
+
+// state is the set of the keys seen within the window, split into the shards to reduce the lock contention.
+type state struct {
+	window time.Duration
+	shards []*shard
+
+	refs int
+}
+
+func newState(window time.Duration, maxKeys int) *state {
+	s := &state{
+		window: window,
+		shards: make([]*shard, shardsCount),
+	}
+
+	shardSize := max(maxKeys/shardsCount, 1)
+	for i := range s.shards {
+		lru, _ := simplelru.NewLRU[uint64, *entry](shardSize, nil)
+		s.shards[i] = &shard{lru: lru}
+	}
+	return s
+}
+
+// acquireState returns the state shared by the processors, it's created by the first processor.
+func acquireState(name string, create func() *state) *state {
+	statesMu.Lock()
+	defer statesMu.Unlock()
+
+	s, has := states[name]
+	if !has {
+		s = create()
+		states[name] = s
+	}
+	s.refs++
+	return s
+}
+
+// releaseState forgets the state after it's released by the last processor.
+func releaseState(name string) {
+	statesMu.Lock()
+	defer statesMu.Unlock()
+
+	s, has := states[name]
+	if !has {
+		return
+	}
+	s.refs--
+	if s.refs == 0 {
+		delete(states, name)
+	}
+}
+
+// see checks the key: it returns true if the key has been seen within the window, counts the duplicate and extends the window.
+// Otherwise, the key opens a new window, the entry of the window is returned.
+// The last result is true if the key evicted another one because of the size limit.
+func (s *state) see(key uint64, now time.Time) (e *entry, isDuplicate, evicted bool) {
+	sh := s.shards[key%shardsCount]
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if e, has := sh.lru.Get(key); has {
+		if now.Sub(e.lastSeen) < s.window {
+			e.duplicates++
+			e.lastSeen = now
+			return e, true, false
+		}
+		sh.lru.Remove(key)
+	}
+
+	e = &entry{lastSeen: now}
+	evicted = sh.lru.Add(key, e)
+	return e, false, evicted
+}
+
+// forget closes the window of the key and returns the count of its duplicates.
+// The key isn't removed if it has opened a new window already.
+func (s *state) forget(key uint64, e *entry) int {
+	sh := s.shards[key%shardsCount]
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if current, has := sh.lru.Peek(key); has && current == e {
+		sh.lru.Remove(key)
+	}
+	return e.duplicates
+}
@@ -0,0 +1,252 @@
+package exec
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	insaneJSON "github.com/ozontech/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It passes the events through a long-lived external process, so the enrichment logic can be written in any language.
+The plugin writes every event to stdin of the process as a JSON line and reads one JSON line per event from stdout:
+* an object replaces the event;
+* an array of objects replaces the event with several events, an empty array drops the event;
+* `null` drops the event.
+
+Every pipeline processor starts its own process, so the events are processed in parallel
+and the process may handle the events one by one without any synchronization.
+The stderr of the process is written to the file.d log.
+
+If the process doesn't respond in `timeout` it's killed, if the process crashes it's restarted
+not more often than once per `restart_delay`. The events which can't be processed are handled according to `on_error`.
+
+Example of the process in Python:
+```python
+import json, sys
+
+for line in sys.stdin:
+    event = json.loads(line)
+    event["enriched"] = True
+    print(json.dumps(event), flush=True)
+```
+
+Config:
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: exec
+      command: python3
+      args: [/opt/enrich.py]
+      timeout: 500ms
+    ...
+```
+}*/
+
+const (
+	onErrorDiscard = "discard"
+
+	stopTimeout = 5 * time.Second
+)
+
+type Plugin struct {
+	config     *Config
+	logger     *zap.Logger
+	controller pipeline.ActionPluginController
+
+	proc      *process
+	lastStart time.Time
+	buf       []byte
+
+	// plugin metrics
+	errorsMetric   *metric.CounterVec
+	restartsMetric *metric.Counter
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The path to the executable of the process.
+	Command string `json:"command" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The arguments of the process.
+	Args []string `json:"args"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The environment variables added to the environment of file.d for the process.
+	Env map[string]string `json:"env"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Max time to wait for the response to an event. The process is killed and restarted if it doesn't respond in time.
+	Timeout  cfg.Duration `json:"timeout" default:"1s" parse:"duration"` // *
+	Timeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Min interval between the starts of the process after it has crashed or has been killed.
+	// > The events received before the process is restarted are handled according to `on_error`.
+	RestartDelay  cfg.Duration `json:"restart_delay" default:"1s" parse:"duration"` // *
+	RestartDelay_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > What to do with the event if it can't be processed by the process:
+	// > * `pass` – pass the event unchanged
+	// > * `discard` – drop the event
+	OnError string `json:"on_error" default:"pass" options:"pass|discard"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "exec",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger.Desugar()
+	p.controller = params.Controller
+	p.registerMetrics(params.MetricCtl)
+
+	proc, err := startProcess(p.config, p.logger)
+	if err != nil {
+		p.logger.Fatal("can't start process", zap.String("command", p.config.Command), zap.Error(err))
+	}
+	p.proc = proc
+	p.lastStart = time.Now()
+}
+
+func (p *Plugin) registerMetrics(ctl *metric.Ctl) {
+	p.errorsMetric = ctl.RegisterCounterVec("action_exec_errors_total", "Total events which can't be processed by the process", "reason")
+	p.restartsMetric = ctl.RegisterCounter("action_exec_restarts_total", "Total restarts of the process")
+}
+
+func (p *Plugin) Stop() {
+	if p.proc != nil {
+		p.proc.stop(stopTimeout)
+		p.proc = nil
+	}
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	proc := p.process()
+	if proc == nil {
+		return p.onError("process_unavailable")
+	}
+
+	p.buf, _ = event.Encode(p.buf[:0])
+	p.buf = append(p.buf, '\n')
+
+	response, err := proc.roundTrip(p.buf, p.config.Timeout_)
+	if err != nil {
+		p.logger.Error("can't process event, killing process", zap.Error(err))
+		proc.kill()
+		p.proc = nil
+
+		reason := "crash"
+		if errors.Is(err, errTimeout) {
+			reason = "timeout"
+		}
+		return p.onError(reason)
+	}
+
+	node, err := event.Root.DecodeBytesAdditional(response)
+	if err != nil {
+		p.logger.Error("wrong process response", zap.Error(err), zap.ByteString("response", response))
+		return p.onError("wrong_response")
+	}
+
+	switch {
+	case node.IsObject():
+		event.Root.MutateToNode(node)
+		return pipeline.ActionPass
+	case node.IsNull():
+		return pipeline.ActionDiscard
+	case node.IsArray():
+		return p.spawn(event, node.AsArray())
+	default:
+		p.logger.Error("wrong process response: expected object, array or null", zap.ByteString("response", response))
+		return p.onError("wrong_response")
+	}
+}
+
+func (p *Plugin) spawn(event *pipeline.Event, nodes []*insaneJSON.Node) pipeline.ActionResult {
+	if len(nodes) == 0 {
+		return pipeline.ActionDiscard
+	}
+	for _, node := range nodes {
+		if !node.IsObject() {
+			p.logger.Error("wrong process response: array elements must be objects", zap.String("type", node.TypeStr()))
+			return p.onError("wrong_response")
+		}
+	}
+
+	if len(nodes) == 1 {
+		event.Root.MutateToNode(nodes[0])
+		return pipeline.ActionPass
+	}
+	// the child event can't be split again since its children can't be tracked
+	if event.IsChildKind() {
+		p.logger.Error("wrong process response: child event can't be replaced with several events")
+		return p.onError("wrong_response")
+	}
+
+	p.controller.Spawn(event, nodes)
+	return pipeline.ActionBreak
+}
+
+// process returns the running process, it restarts the exited process if the restart delay has passed.
+func (p *Plugin) process() *process {
+	if p.proc != nil {
+		exited, err := p.proc.hasExited()
+		if !exited {
+			return p.proc
+		}
+
+		p.logger.Error("process has exited", zap.Error(err))
+		p.proc.kill()
+		p.proc = nil
+	}
+
+	if time.Since(p.lastStart) < p.config.RestartDelay_ {
+		return nil
+	}
+	p.lastStart = time.Now()
+
+	proc, err := startProcess(p.config, p.logger)
+	if err != nil {
+		p.logger.Error("can't restart process", zap.String("command", p.config.Command), zap.Error(err))
+		return nil
+	}
+	p.logger.Info("process is restarted")
+	p.restartsMetric.Inc()
+	p.proc = proc
+
+	return proc
+}
+
+func (p *Plugin) onError(reason string) pipeline.ActionResult {
+	p.errorsMetric.WithLabelValues(reason).Inc()
+	if p.config.OnError == onErrorDiscard {
+		return pipeline.ActionDiscard
+	}
+	return pipeline.ActionPass
+}
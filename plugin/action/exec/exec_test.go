@@ -0,0 +1,154 @@
+package exec
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/require"
+)
+
+const helperEnv = "EXEC_TEST_HELPER"
+
+// TestMain runs the test binary as the process of the plugin if the helper env is set.
+func TestMain(m *testing.M) {
+	if os.Getenv(helperEnv) != "" {
+		runHelper()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runHelper responds to the events according to their "op" field.
+func runHelper() {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		event := map[string]any{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		switch event["op"] {
+		case "enrich":
+			event["enriched"] = true
+			out, _ := json.Marshal(event)
+			fmt.Println(string(out))
+		case "split":
+			fmt.Println(`[{"message":"a"},{"message":"b"}]`)
+		case "drop":
+			fmt.Println("null")
+		case "wrong":
+			fmt.Println(`"string"`)
+		case "sleep":
+			time.Sleep(time.Minute)
+		case "crash":
+			os.Exit(1)
+		}
+	}
+}
+
+func newConfig(onError string) *Config {
+	config := test.NewConfig(&Config{
+		Command:      os.Args[0],
+		Env:          map[string]string{helperEnv: "1"},
+		Timeout:      "200ms",
+		RestartDelay: "0s",
+		OnError:      onError,
+	}, nil)
+	return config.(*Config)
+}
+
+func TestPlugin(t *testing.T) {
+	cases := []struct {
+		name    string
+		onError string
+		in      []string
+		out     []string
+	}{
+		{
+			name: "transform",
+			in: []string{
+				`{"op":"enrich","id":1}`,
+				`{"op":"split"}`,
+				`{"op":"drop"}`,
+				`{"op":"enrich","id":2}`,
+			},
+			out: []string{
+				`{"op":"enrich","id":1,"enriched":true}`,
+				`{"message":"a"}`,
+				`{"message":"b"}`,
+				`{"op":"enrich","id":2,"enriched":true}`,
+			},
+		},
+		{
+			name: "errors_pass",
+			in: []string{
+				`{"op":"wrong"}`,
+				`{"op":"sleep"}`,
+				`{"op":"enrich","id":1}`,
+				`{"op":"crash"}`,
+				`{"op":"enrich","id":2}`,
+			},
+			out: []string{
+				`{"op":"wrong"}`,
+				`{"op":"sleep"}`,
+				`{"op":"enrich","id":1,"enriched":true}`,
+				`{"op":"crash"}`,
+				`{"op":"enrich","id":2,"enriched":true}`,
+			},
+		},
+		{
+			name:    "errors_discard",
+			onError: onErrorDiscard,
+			in: []string{
+				`{"op":"sleep"}`,
+				`{"op":"crash"}`,
+				`{"op":"enrich","id":1}`,
+			},
+			out: []string{
+				`{"op":"enrich","id":1,"enriched":true}`,
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, newConfig(tt.onError), pipeline.MatchModeAnd, nil, false))
+
+			mu := sync.Mutex{}
+			outEvents := make([]string, 0)
+			output.SetOutFn(func(e *pipeline.Event) {
+				if e.IsChildParentKind() {
+					return
+				}
+				mu.Lock()
+				outEvents = append(outEvents, strings.Clone(e.Root.EncodeToString()))
+				mu.Unlock()
+			})
+
+			for i, event := range tt.in {
+				input.In(0, "test.log", test.NewOffset(int64(i)), []byte(event))
+			}
+
+			require.Eventually(t, func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(outEvents) == len(tt.out)
+			}, 10*time.Second, 10*time.Millisecond)
+			p.Stop()
+
+			require.Len(t, outEvents, len(tt.out))
+			for i := range tt.out {
+				require.JSONEq(t, tt.out[i], outEvents[i])
+			}
+		})
+	}
+}
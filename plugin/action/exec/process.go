@@ -0,0 +1,174 @@
+package exec
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	errTimeout = errors.New("process hasn't responded in time")
+	errExited  = errors.New("process has exited")
+)
+
+// process is the child process which receives the events on stdin and responds on stdout, one line per event.
+type process struct {
+	cmd   *exec.Cmd
+	stdin *os.File
+
+	lines    chan []byte   // it's closed when stdout is closed
+	exited   chan struct{} // it's closed when the process has exited
+	killed   chan struct{} // it's closed when the process is killed by the plugin
+	killOnce sync.Once
+	waitErr  error
+}
+
+func startProcess(config *Config, logger *zap.Logger) (*process, error) {
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range config.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("can't create stdin pipe: %w", err)
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		closeFiles(stdinR, stdinW)
+		return nil, fmt.Errorf("can't create stdout pipe: %w", err)
+	}
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		closeFiles(stdinR, stdinW, stdoutR, stdoutW)
+		return nil, fmt.Errorf("can't create stderr pipe: %w", err)
+	}
+
+	cmd.Stdin = stdinR
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+	err = cmd.Start()
+	// the child ends of the pipes are owned by the process now
+	closeFiles(stdinR, stdoutW, stderrW)
+	if err != nil {
+		closeFiles(stdinW, stdoutR, stderrR)
+		return nil, err
+	}
+
+	p := &process{
+		cmd:    cmd,
+		stdin:  stdinW,
+		lines:  make(chan []byte),
+		exited: make(chan struct{}),
+		killed: make(chan struct{}),
+	}
+	go p.readStdout(stdoutR)
+	go p.readStderr(stderrR, logger)
+	go func() {
+		p.waitErr = cmd.Wait()
+		close(p.exited)
+	}()
+
+	return p, nil
+}
+
+func (p *process) readStdout(stdout *os.File) {
+	defer close(p.lines)
+	defer closeFiles(stdout)
+
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			select {
+			case p.lines <- line:
+			case <-p.killed:
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (p *process) readStderr(stderr *os.File, logger *zap.Logger) {
+	defer closeFiles(stderr)
+
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		logger.Warn("process stderr", zap.String("line", scanner.Text()))
+	}
+}
+
+// roundTrip writes the event line to the process and waits for the response line.
+func (p *process) roundTrip(line []byte, timeout time.Duration) ([]byte, error) {
+	deadline := time.Now().Add(timeout)
+	_ = p.stdin.SetWriteDeadline(deadline)
+	if _, err := p.stdin.Write(line); err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, errTimeout
+		}
+		return nil, fmt.Errorf("can't write event: %w", err)
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case response, ok := <-p.lines:
+		if !ok {
+			return nil, errExited
+		}
+		return response, nil
+	case <-timer.C:
+		return nil, errTimeout
+	}
+}
+
+// hasExited returns true and the exit error if the process has exited.
+func (p *process) hasExited() (bool, error) {
+	select {
+	case <-p.exited:
+		return true, p.waitErr
+	default:
+		return false, nil
+	}
+}
+
+// stop closes stdin of the process, so it can exit itself, and kills it after the timeout.
+func (p *process) stop(timeout time.Duration) {
+	closeFiles(p.stdin)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-p.exited:
+	case <-timer.C:
+	}
+	p.kill()
+}
+
+func (p *process) kill() {
+	p.killOnce.Do(func() {
+		close(p.killed)
+		closeFiles(p.stdin)
+		_ = p.cmd.Process.Kill()
+		<-p.exited
+	})
+}
+
+func closeFiles(files ...*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
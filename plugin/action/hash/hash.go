@@ -447,15 +447,16 @@ func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 	var hash uint64
 	switch field.Format_ {
 	case ffNo:
-		hash = calcHash(fieldData[:hashSize])
+		hash = CalcHash(fieldData[:hashSize])
 	case ffNormalize:
-		hash = calcHash(p.normalizer.Normalize(p.buf, fieldData[:hashSize]))
+		hash = CalcHash(p.normalizer.Normalize(p.buf, fieldData[:hashSize]))
 	}
 
 	pipeline.CreateNestedField(event.Root, p.config.ResultField_).MutateToUint64(hash)
 	return pipeline.ActionPass
 }
 
-func calcHash(data []byte) uint64 {
+// CalcHash calculates the hash of the data the same way the plugin does, so other plugins can get the same hashes.
+func CalcHash(data []byte) uint64 {
 	return xxhash.Sum64(data)
 }
@@ -0,0 +1,210 @@
+package logs_to_metrics
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/pipeline/doif"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It derives the Prometheus metrics from the events, the events are passed unchanged.
+So the errors can be counted per service without shipping all the logs to the storage.
+
+Every metric has the labels with the values of the event fields and is updated by the events matching its `do_if`:
+* `counter` is increased by the `value` field or by one if the `value` isn't set;
+* `gauge` is set to the `value` field;
+* `histogram` observes the `value` field.
+
+The events without the `value` field or with a non-numeric value are skipped, as well as the negative values of `counter`.
+
+The metrics are exported as `file_d_pipeline_<pipeline name>_logs_to_metrics_<metric name>`.
+The metric names must be unique within the pipeline.
+The label values which aren't updated for the pipeline `metrics.hold_duration` are deleted.
+The number of the label values combinations of the metric is limited by `cardinality_limit`,
+the events with the new combinations over the limit update the series with all the label values set to `overflow`.
+
+Config:
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: logs_to_metrics
+      metrics:
+        - name: log_errors_total
+          type: counter
+          labels: [service, level]
+          do_if:
+            op: equal
+            field: level
+            values: [error, fatal]
+        - name: request_duration_ms
+          type: histogram
+          value: duration_ms
+          buckets: [10, 50, 100, 500, 1000]
+          labels: [service]
+    ...
+```
+}*/
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+var validName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+type Plugin struct {
+	config *Config
+	logger *zap.Logger
+
+	metricsName string
+	metrics     []*eventMetric
+
+	labelsBuf []string
+	keyBuf    []byte
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The list of the metrics:
+	// > * `name` – the name of the metric
+	// > * `type` – `counter`, `gauge` or `histogram`
+	// > * `help` – the description of the metric
+	// > * `labels` – the fields with the label values, the label names are the field paths with the dots replaced with `_`
+	// > * `value` – the field with the numeric value, it's required for `gauge` and `histogram`
+	// > * `buckets` – the buckets of `histogram`, the Prometheus default buckets are used if empty
+	// > * `cardinality_limit` – max number of the label values combinations, `0` is unlimited
+	// > * `do_if` – [do-if](/pipeline/doif/README.md) condition selecting the events to update the metric
+	Metrics []Metric `json:"metrics" slice:"true" required:"true"` // *
+}
+
+type Metric struct {
+	Name             string              `json:"name" required:"true"`
+	Kind             string              `json:"type" default:"counter" options:"counter|gauge|histogram"`
+	Help             string              `json:"help"`
+	Labels           []cfg.FieldSelector `json:"labels" slice:"true"`
+	Value            cfg.FieldSelector   `json:"value"`
+	Buckets          []float64           `json:"buckets"`
+	CardinalityLimit int                 `json:"cardinality_limit" default:"10000"`
+	DoIf             map[string]any      `json:"do_if"`
+}
+
+// Validate checks the metrics the same way as on start and that their names are unique, the metrics aren't registered.
+func (c *Config) Validate() error {
+	names := make(map[string]struct{}, len(c.Metrics))
+	for i := range c.Metrics {
+		if _, _, err := compileEventMetric(&c.Metrics[i]); err != nil {
+			return err
+		}
+
+		name := c.Metrics[i].Name
+		if _, has := names[name]; has {
+			return fmt.Errorf("metric %q: duplicate name", name)
+		}
+		names[name] = struct{}{}
+	}
+	return nil
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "logs_to_metrics",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger.Desugar()
+
+	// the labels of the held metrics are deleted after the hold duration, so the limiter forgets them too
+	var labelsTTL time.Duration
+	if params.PipelineSettings.Metric != nil {
+		labelsTTL = params.PipelineSettings.Metric.HoldDuration
+	}
+
+	p.metricsName = params.PipelineName + "_" + strconv.Itoa(params.Index)
+	metrics, err := acquireMetrics(p.metricsName, params.MetricCtl, p.config.Metrics, labelsTTL)
+	if err != nil {
+		p.logger.Fatal("can't init metrics", zap.Error(err))
+	}
+	p.metrics = metrics
+}
+
+func (p *Plugin) Stop() {
+	releaseMetrics(p.metricsName)
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	for _, m := range p.metrics {
+		p.update(m, event)
+	}
+	return pipeline.ActionPass
+}
+
+func (p *Plugin) update(m *eventMetric, event *pipeline.Event) {
+	if m.doIf != nil && !m.doIf.Check(doif.NewEventDataWithMeta(event.Root, event.Meta)) {
+		return
+	}
+
+	value := 1.0
+	if m.value != nil {
+		node := event.Root.Dig(m.value...)
+		if node == nil {
+			return
+		}
+		var err error
+		value, err = strconv.ParseFloat(node.AsString(), 64)
+		// the counter can't be decreased
+		if err != nil || (m.kind == kindCounter && value < 0) {
+			return
+		}
+	}
+
+	p.labelsBuf = p.labelsBuf[:0]
+	p.keyBuf = p.keyBuf[:0]
+	for _, field := range m.labels {
+		labelValue := pipeline.DefaultFieldValue
+		if node := event.Root.Dig(field...); node != nil {
+			labelValue = node.AsString()
+		}
+		p.labelsBuf = append(p.labelsBuf, labelValue)
+		p.keyBuf = append(p.keyBuf, labelValue...)
+		p.keyBuf = append(p.keyBuf, 0)
+	}
+	if !m.limiter.allow(p.keyBuf) {
+		for i := range p.labelsBuf {
+			p.labelsBuf[i] = overflowLabelValue
+		}
+	}
+
+	switch m.kind {
+	case kindCounter:
+		m.counter.WithLabelValues(p.labelsBuf...).Add(value)
+	case kindGauge:
+		m.gauge.WithLabelValues(p.labelsBuf...).Set(value)
+	case kindHistogram:
+		m.histogram.WithLabelValues(p.labelsBuf...).Observe(value)
+	}
+}
+
+func labelName(field []string) string {
+	return strings.Join(field, "_")
+}
@@ -0,0 +1,173 @@
+package logs_to_metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	insaneJSON "github.com/ozontech/insane-json"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlugin(t *testing.T) {
+	config := test.NewConfig(&Config{Metrics: []Metric{
+		{
+			Name:   "errors_total",
+			Labels: []cfg.FieldSelector{"service", "k8s.namespace"},
+			DoIf:   map[string]any{"op": "equal", "field": "level", "values": []any{"error"}},
+		},
+		{
+			Name:    "duration_ms",
+			Kind:    kindHistogram,
+			Value:   "duration_ms",
+			Buckets: []float64{10, 100},
+		},
+		{
+			Name:             "queue_size",
+			Kind:             kindGauge,
+			Value:            "queue",
+			Labels:           []cfg.FieldSelector{"service"},
+			CardinalityLimit: 1,
+		},
+	}}, nil)
+
+	registry := prometheus.NewRegistry()
+	params := test.NewEmptyActionPluginParams()
+	params.MetricCtl = metric.NewCtl("test", registry, time.Minute, 0)
+
+	p := &Plugin{}
+	p.Start(config, params)
+	defer p.Stop()
+
+	for _, event := range []string{
+		`{"service":"a","k8s":{"namespace":"prod"},"level":"error","duration_ms":5,"queue":1}`,
+		`{"service":"a","k8s":{"namespace":"prod"},"level":"error","duration_ms":"50","queue":2}`,
+		`{"service":"b","level":"error","duration_ms":500,"queue":3}`,
+		`{"service":"b","level":"info","duration_ms":"wrong"}`,
+	} {
+		root, err := insaneJSON.DecodeString(event)
+		require.NoError(t, err)
+		require.Equal(t, pipeline.ActionPass, p.Do(&pipeline.Event{Root: root}))
+		insaneJSON.Release(root)
+	}
+
+	expected := `
+# HELP file_d_test_logs_to_metrics_duration_ms The histogram derived from the events
+# TYPE file_d_test_logs_to_metrics_duration_ms histogram
+file_d_test_logs_to_metrics_duration_ms_bucket{le="10"} 1
+file_d_test_logs_to_metrics_duration_ms_bucket{le="100"} 2
+file_d_test_logs_to_metrics_duration_ms_bucket{le="+Inf"} 3
+file_d_test_logs_to_metrics_duration_ms_sum 555
+file_d_test_logs_to_metrics_duration_ms_count 3
+# HELP file_d_test_logs_to_metrics_errors_total The counter derived from the events
+# TYPE file_d_test_logs_to_metrics_errors_total counter
+file_d_test_logs_to_metrics_errors_total{k8s_namespace="not_set",service="b"} 1
+file_d_test_logs_to_metrics_errors_total{k8s_namespace="prod",service="a"} 2
+# HELP file_d_test_logs_to_metrics_queue_size The gauge derived from the events
+# TYPE file_d_test_logs_to_metrics_queue_size gauge
+file_d_test_logs_to_metrics_queue_size{service="a"} 2
+file_d_test_logs_to_metrics_queue_size{service="overflow"} 3
+`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected)))
+}
+
+func TestReload(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	start := func(labels ...cfg.FieldSelector) *Plugin {
+		config := test.NewConfig(&Config{Metrics: []Metric{{Name: "input_events_count", Labels: labels}}}, nil)
+		params := test.NewEmptyActionPluginParams()
+		params.PipelineName = "reload"
+		params.MetricCtl = metric.NewCtl("test", registry, time.Minute, 0)
+
+		p := &Plugin{}
+		p.Start(config, params)
+		return p
+	}
+
+	// the built-in metric with the same name doesn't clash with the derived one
+	metric.NewCtl("test", registry, time.Minute, 0).RegisterCounter("input_events_count", "")
+
+	p := start("service")
+	p.Stop()
+
+	// the reloaded pipeline registers the metric with the other labels
+	p = start("service", "level")
+	defer p.Stop()
+
+	root, err := insaneJSON.DecodeString(`{"service":"a","level":"error"}`)
+	require.NoError(t, err)
+	defer insaneJSON.Release(root)
+	p.Do(&pipeline.Event{Root: root})
+
+	expected := `
+# HELP file_d_test_logs_to_metrics_input_events_count The counter derived from the events
+# TYPE file_d_test_logs_to_metrics_input_events_count counter
+file_d_test_logs_to_metrics_input_events_count{level="error",service="a"} 1
+`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "file_d_test_logs_to_metrics_input_events_count"))
+}
+
+func TestDuplicateNames(t *testing.T) {
+	config := &Config{Metrics: []Metric{{Name: "errors_total", Kind: kindCounter}, {Name: "errors_total", Kind: kindCounter}}}
+	require.ErrorContains(t, config.Validate(), "duplicate name")
+
+	ctl := metric.NewCtl("test", prometheus.NewRegistry(), time.Minute, 0)
+	_, err := acquireMetrics("first", ctl, []Metric{{Name: "errors_total", Kind: kindCounter}}, 0)
+	require.NoError(t, err)
+	defer releaseMetrics("first")
+
+	// another action of the pipeline can't register the metric with the same name
+	_, err = acquireMetrics("second", ctl, []Metric{{Name: "errors_total", Kind: kindGauge, Value: "value"}}, 0)
+	require.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		metric Metric
+		valid  bool
+	}{
+		{
+			name:   "counter",
+			metric: Metric{Name: "errors_total", Kind: kindCounter, Labels: []cfg.FieldSelector{"level"}},
+			valid:  true,
+		},
+		{
+			name:   "wrong_name",
+			metric: Metric{Name: "errors-total", Kind: kindCounter},
+		},
+		{
+			name:   "gauge_without_value",
+			metric: Metric{Name: "size", Kind: kindGauge},
+		},
+		{
+			name:   "histogram_without_value",
+			metric: Metric{Name: "duration", Kind: kindHistogram},
+		},
+		{
+			name:   "wrong_label",
+			metric: Metric{Name: "errors_total", Kind: kindCounter, Labels: []cfg.FieldSelector{"log-level"}},
+		},
+		{
+			name:   "wrong_do_if",
+			metric: Metric{Name: "errors_total", Kind: kindCounter, DoIf: map[string]any{"op": "unknown"}},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Config{Metrics: []Metric{tt.metric}}).Validate()
+			if tt.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
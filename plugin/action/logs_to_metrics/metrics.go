@@ -0,0 +1,224 @@
+package logs_to_metrics
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline/doif"
+	"github.com/ozontech/file.d/xtime"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	overflowLabelValue = "overflow"
+
+	// metricPrefix separates the derived metrics from the metrics of file.d itself
+	metricPrefix = "logs_to_metrics_"
+)
+
+var (
+	// the metrics are shared by the processors of the pipeline, the key is <pipeline name>_<action index>
+	sharedMetrics   = map[string]*sharedMetricsRef{}
+	sharedMetricsMu = &sync.Mutex{}
+)
+
+type sharedMetricsRef struct {
+	metrics []*eventMetric
+	ctl     *metric.Ctl
+	refs    int
+}
+
+// eventMetric is the metric derived from the events.
+type eventMetric struct {
+	name   string
+	kind   string
+	labels [][]string
+	value  []string
+	doIf   *doif.Checker
+
+	counter   *metric.CounterVec
+	gauge     *metric.GaugeVec
+	histogram *metric.HistogramVec
+
+	limiter *labelsLimiter
+}
+
+func newEventMetric(m *Metric, ctl *metric.Ctl, labelsTTL time.Duration) (*eventMetric, error) {
+	em, labelNames, err := compileEventMetric(m)
+	if err != nil {
+		return nil, err
+	}
+	em.limiter = newLabelsLimiter(m.CardinalityLimit, labelsTTL)
+
+	help := m.Help
+	if help == "" {
+		help = fmt.Sprintf("The %s derived from the events", m.Kind)
+	}
+
+	// the metric with the same name is registered by another action of the pipeline
+	if ctl.IsRegistered(em.name) {
+		return nil, fmt.Errorf("metric %q: already registered", m.Name)
+	}
+
+	switch m.Kind {
+	case kindCounter:
+		em.counter = ctl.RegisterReloadableCounterVec(em.name, help, labelNames...)
+		ctl.AddToHolder(em.counter)
+	case kindGauge:
+		em.gauge = ctl.RegisterReloadableGaugeVec(em.name, help, labelNames...)
+		ctl.AddToHolder(em.gauge)
+	case kindHistogram:
+		buckets := m.Buckets
+		if len(buckets) == 0 {
+			buckets = prometheus.DefBuckets
+		}
+		em.histogram = ctl.RegisterReloadableHistogramVec(em.name, help, buckets, labelNames...)
+		ctl.AddToHolder(em.histogram)
+	}
+
+	return em, nil
+}
+
+// compileEventMetric checks the config of the metric and parses its fields, the metric isn't registered.
+func compileEventMetric(m *Metric) (*eventMetric, []string, error) {
+	if !validName.MatchString(m.Name) {
+		return nil, nil, fmt.Errorf("metric %q: wrong name", m.Name)
+	}
+	if m.Kind != kindCounter && m.Value == "" {
+		return nil, nil, fmt.Errorf("metric %q: value must be set for %s", m.Name, m.Kind)
+	}
+
+	em := &eventMetric{
+		name: metricPrefix + m.Name,
+		kind: m.Kind,
+	}
+	if m.Value != "" {
+		em.value = cfg.ParseFieldSelector(string(m.Value))
+	}
+
+	labelNames := make([]string, 0, len(m.Labels))
+	for _, label := range m.Labels {
+		field := cfg.ParseFieldSelector(string(label))
+		name := labelName(field)
+		if !validName.MatchString(name) {
+			return nil, nil, fmt.Errorf("metric %q: wrong label name %q of field %q", m.Name, name, label)
+		}
+		em.labels = append(em.labels, field)
+		labelNames = append(labelNames, name)
+	}
+
+	if m.DoIf != nil {
+		checker, err := doif.NewFromMap(m.DoIf)
+		if err != nil {
+			return nil, nil, fmt.Errorf("metric %q: can't init do_if: %w", m.Name, err)
+		}
+		em.doIf = checker
+	}
+
+	return em, labelNames, nil
+}
+
+// acquireMetrics returns the metrics shared by the processors, they're registered by the first processor.
+func acquireMetrics(name string, ctl *metric.Ctl, configs []Metric, labelsTTL time.Duration) ([]*eventMetric, error) {
+	sharedMetricsMu.Lock()
+	defer sharedMetricsMu.Unlock()
+
+	ref, has := sharedMetrics[name]
+	if !has {
+		metrics := make([]*eventMetric, 0, len(configs))
+		for i := range configs {
+			m, err := newEventMetric(&configs[i], ctl, labelsTTL)
+			if err != nil {
+				unregisterMetrics(ctl, metrics)
+				return nil, err
+			}
+			metrics = append(metrics, m)
+		}
+		ref = &sharedMetricsRef{metrics: metrics, ctl: ctl}
+		sharedMetrics[name] = ref
+	}
+	ref.refs++
+	return ref.metrics, nil
+}
+
+// releaseMetrics unregisters the metrics after the last processor is stopped,
+// so the pipeline can be reloaded with the other labels or help of the metrics.
+func releaseMetrics(name string) {
+	sharedMetricsMu.Lock()
+	defer sharedMetricsMu.Unlock()
+
+	ref, has := sharedMetrics[name]
+	if !has {
+		return
+	}
+	ref.refs--
+	if ref.refs == 0 {
+		unregisterMetrics(ref.ctl, ref.metrics)
+		delete(sharedMetrics, name)
+	}
+}
+
+func unregisterMetrics(ctl *metric.Ctl, metrics []*eventMetric) {
+	for _, m := range metrics {
+		ctl.Unregister(m.name)
+	}
+}
+
+// labelsLimiter limits the number of the label values combinations of the metric.
+type labelsLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	ttl       int64
+	seen      map[string]int64 // label values -> last usage unixnano
+	lastSweep int64
+}
+
+func newLabelsLimiter(limit int, ttl time.Duration) *labelsLimiter {
+	return &labelsLimiter{
+		limit: limit,
+		ttl:   ttl.Nanoseconds(),
+		seen:  make(map[string]int64),
+	}
+}
+
+// allow returns false if the label values are new and the limit is reached.
+func (l *labelsLimiter) allow(key []byte) bool {
+	if l.limit <= 0 {
+		return true
+	}
+	now := xtime.GetInaccurateUnixNano()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, has := l.seen[string(key)]; has {
+		l.seen[string(key)] = now
+		return true
+	}
+	if len(l.seen) >= l.limit {
+		l.sweep(now)
+		if len(l.seen) >= l.limit {
+			return false
+		}
+	}
+	l.seen[string(key)] = now
+	return true
+}
+
+// sweep forgets the label values which aren't used for the ttl, so they're deleted by the metric holder too.
+func (l *labelsLimiter) sweep(now int64) {
+	// the sweep is expensive, so it's done not more often than once per 1/10 of the ttl
+	if l.ttl <= 0 || now-l.lastSweep < l.ttl/10 {
+		return
+	}
+	l.lastSweep = now
+
+	for key, lastUsage := range l.seen {
+		if now-lastUsage > l.ttl {
+			delete(l.seen, key)
+		}
+	}
+}
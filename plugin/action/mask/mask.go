@@ -1,6 +1,7 @@
 package mask
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 
@@ -184,6 +185,17 @@ type Config struct {
 	AppliedMetricLabels []string `json:"applied_metric_labels"` // *
 }
 
+// Validate compiles the copies of the masks the same way as on start.
+func (c *Config) Validate() error {
+	for i := range c.Masks {
+		mask := c.Masks[i]
+		if err := compileMask(&mask, zap.NewNop()); err != nil {
+			return fmt.Errorf("mask #%d: %w", i, err)
+		}
+	}
+	return nil
+}
+
 type mode int
 
 const (
@@ -269,7 +281,7 @@ func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 	if p.hasMaskSpecificDoIf {
 		for i := range p.config.Masks {
 			if p.config.Masks[i].DoIfChecker != nil {
-				p.config.Masks[i].use = p.config.Masks[i].DoIfChecker.Check(doif.NewEventData(event.Root))
+				p.config.Masks[i].use = p.config.Masks[i].DoIfChecker.Check(doif.NewEventDataWithMeta(event.Root, event.Meta))
 			}
 		}
 	}
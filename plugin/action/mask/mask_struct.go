@@ -1,6 +1,8 @@
 package mask
 
 import (
+	"errors"
+	"fmt"
 	"regexp"
 	"unicode/utf8"
 
@@ -97,29 +99,32 @@ type Mask struct {
 
 func compileMasks(masks []Mask, logger *zap.Logger) []Mask {
 	for i := range masks {
-		mask := &masks[i]
-		if mask.MaxCount > 0 && mask.ReplaceWord != "" {
-			logger.Fatal("invalid mask configuration")
+		if err := compileMask(&masks[i], logger); err != nil {
+			logger.Fatal("can't compile mask", zap.Int("mask", i), zap.Error(err))
+		}
+		for j := range masks[i].MatchRules {
+			masks[i].MatchRules[j].Prepare()
 		}
-	}
-
-	for i := range masks {
-		compileMask(&masks[i], logger)
 	}
 
 	return masks
 }
 
-func compileMask(m *Mask, logger *zap.Logger) {
+// compileMask checks the mask and compiles its regexp and do_if.
+// The shared match rules aren't changed, so it's also used to validate the config.
+func compileMask(m *Mask, logger *zap.Logger) error {
+	if m.MaxCount > 0 && m.ReplaceWord != "" {
+		return errors.New("invalid mask configuration")
+	}
 	if m.Re == "" && len(m.MatchRules) == 0 {
-		logger.Fatal("mask must have either nonempty regex or ruleset, or both")
+		return errors.New("mask must have either nonempty regex or ruleset, or both")
 	}
 
 	if m.DoIfCheckerMap != nil {
 		var err error
 		m.DoIfChecker, err = doif.NewFromMap(m.DoIfCheckerMap)
 		if err != nil {
-			logger.Fatal("can't init do_if for mask", zap.Error(err))
+			return fmt.Errorf("can't init do_if for mask: %w", err)
 		}
 	} else {
 		m.use = true
@@ -128,7 +133,7 @@ func compileMask(m *Mask, logger *zap.Logger) {
 	setModeReplace := m.ReplaceWord != ""
 	setModeCut := m.CutValues
 	if setModeReplace && setModeCut {
-		logger.Fatal("replace mode and cut mode are incompatible")
+		return errors.New("replace mode and cut mode are incompatible")
 	}
 
 	switch {
@@ -144,22 +149,25 @@ func compileMask(m *Mask, logger *zap.Logger) {
 		logger.Info("compiling", zap.String("re", m.Re), zap.Ints("groups", m.Groups))
 		re, err := regexp.Compile(m.Re)
 		if err != nil {
-			logger.Fatal("error on compiling regexp", zap.String("re", m.Re))
+			return fmt.Errorf("error on compiling regexp: %w", err)
 		}
 		m.Re_ = re
-		m.Groups = cfg.VerifyGroupNumbers(m.Groups, re.NumSubexp(), logger)
+		m.Groups, err = cfg.CheckGroupNumbers(m.Groups, re.NumSubexp())
+		if err != nil {
+			return err
+		}
 	}
-	for i, matchRule := range m.MatchRules {
+	for _, matchRule := range m.MatchRules {
 		if len(matchRule.Rules) == 0 {
-			logger.Fatal("ruleset must contain at least one rule")
+			return errors.New("ruleset must contain at least one rule")
 		}
 		for _, rule := range matchRule.Rules {
 			if len(rule.Values) == 0 {
-				logger.Fatal("rule in ruleset must have at least one value")
+				return errors.New("rule in ruleset must have at least one value")
 			}
 		}
-		m.MatchRules[i].Prepare()
 	}
+	return nil
 }
 
 func (m *Mask) checkMatchRules(value []byte) bool {
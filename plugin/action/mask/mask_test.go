@@ -14,7 +14,6 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 )
 
 const (
@@ -397,15 +396,7 @@ func TestGroupNumbers(t *testing.T) {
 	for _, s := range suits {
 		t.Run(s.name, func(t *testing.T) {
 			if s.isFatal {
-				assert.PanicsWithValue(t,
-					s.fatalMsg,
-					func() {
-						compileMask(
-							s.input,
-							zap.NewNop().WithOptions(zap.WithFatalHook(zapcore.WriteThenPanic)),
-						)
-					},
-					s.comment)
+				assert.ErrorContains(t, compileMask(s.input, zap.NewNop()), s.fatalMsg, s.comment)
 			} else {
 				res := &Mask{
 					Re:     s.input.Re,
@@ -414,7 +405,7 @@ func TestGroupNumbers(t *testing.T) {
 					CutValues:   s.input.CutValues,
 					ReplaceWord: s.input.ReplaceWord,
 				}
-				compileMask(res, zap.NewNop())
+				assert.NoError(t, compileMask(res, zap.NewNop()), s.comment)
 				assert.NotNil(t, res.Re_, s.comment)
 				assert.Equal(t, res.Re, s.expect.Re, s.comment)
 				assert.Equal(t, res.Groups, s.expect.Groups, s.comment)
@@ -1748,3 +1739,14 @@ func BenchmarkDoProcessFields(b *testing.B) {
 		})
 	}
 }
+
+func TestValidate(t *testing.T) {
+	config := &Config{Masks: []Mask{{Re: kDefaultCardRegExp, Groups: []int{0, 1}}}}
+	require.NoError(t, config.Validate())
+	require.Nil(t, config.Masks[0].Re_, "config shouldn't be compiled")
+	require.Equal(t, []int{0, 1}, config.Masks[0].Groups)
+
+	// the group numbers are checked the same way as on start
+	config = &Config{Masks: []Mask{{Re: kDefaultCardRegExp, Groups: []int{6}}}}
+	require.ErrorContains(t, config.Validate(), "wrong group number")
+}
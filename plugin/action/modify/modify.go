@@ -1,6 +1,8 @@
 package modify
 
 import (
+	"fmt"
+
 	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/cfg/substitution"
 	"github.com/ozontech/file.d/fd"
@@ -155,6 +157,19 @@ type Plugin struct {
 
 type Config map[string]string
 
+// Validate checks the substitutions without starting the plugin.
+func (c *Config) Validate() error {
+	for key, value := range *c {
+		if key == skipEmptyKey {
+			continue
+		}
+		if _, err := substitution.ParseSubstitution(value, nil, zap.NewNop()); err != nil {
+			return fmt.Errorf("can't parse substitution of %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
 func init() {
 	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
 		Type:    "modify",
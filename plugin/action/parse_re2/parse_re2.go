@@ -42,6 +42,12 @@ type Config struct {
 	Prefix string `json:"prefix" default:""` // *
 }
 
+// Validate checks the re2 expression without starting the plugin.
+func (c *Config) Validate() error {
+	_, err := regexp.Compile(c.Re2)
+	return err
+}
+
 func init() {
 	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
 		Type:    "parse_re2",
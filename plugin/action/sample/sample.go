@@ -0,0 +1,248 @@
+package sample
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/pipeline/doif"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It keeps only the fraction of the events set by `ratio` and discards the rest.
+
+In `random` mode every event is kept with the probability of `ratio`.
+In `hash` mode the decision is made by the hash of the `fields` values, so the events with the same values,
+e.g. all the lines of one trace, are kept or discarded together. The events without any of the `fields` are sampled randomly.
+
+The ratio can be set for the events matching the `rules`, the first matched rule is applied,
+`ratio` is applied to the events not matching any rule. The ratios are from `0` to `1`,
+`0` discards all the events and `1` keeps all of them.
+The config with all the ratios set to `0` is rejected since it discards all the events, use the [discard](/plugin/action/discard/README.md) plugin for that.
+
+Config:
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: sample
+      mode: hash
+      fields:
+        - trace_id
+        - request_id
+      ratio: 0.01
+      rules:
+        - name: errors
+          ratio: 1
+          do_if:
+            op: equal
+            field: level
+            values: [error]
+    ...
+```
+
+The discarded events are counted in the `action_sample_discarded_events_total` metric with the `rule` label,
+it's the name of the rule or `default` for the events not matching any rule.
+}*/
+
+const (
+	modeRandom = "random"
+	modeHash   = "hash"
+
+	defaultRule = "default"
+)
+
+type Plugin struct {
+	config *Config
+	rules  []rule
+	fields [][]string
+
+	hasher *xxhash.Digest
+
+	// plugin metrics
+	discardedMetric *metric.CounterVec
+}
+
+type rule struct {
+	name    string
+	ratio   float64
+	checker *doif.Checker
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The sampling mode:
+	// > * `random` – every event is kept with the probability of the ratio
+	// > * `hash` – the event is kept if the hash of the `fields` values falls into the ratio, so the events with the same values are kept or discarded together
+	Mode string `json:"mode" default:"random" options:"random|hash"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The fields to calculate the hash of in `hash` mode, e.g. `trace_id`.
+	Fields []cfg.FieldSelector `json:"fields" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The fraction of the events not matching any rule to keep, from `0` to `1`.
+	// > It's required if there are no `rules` with the non-zero ratio.
+	// > If it isn't set, such events are discarded, so only the events matching the `rules` are sampled.
+	Ratio float64 `json:"ratio"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The list of the rules with their own ratio for the events matching the rule `do_if`:
+	// > * `name` – the name of the rule used in the metric, the index of the rule by default
+	// > * `ratio` – the fraction of the matching events to keep, from `0` to `1`
+	// > * `do_if` – [do-if](/pipeline/doif/README.md) condition selecting the events
+	Rules []Rule `json:"rules" slice:"true"` // *
+}
+
+type Rule struct {
+	Name  string         `json:"name"`
+	Ratio float64        `json:"ratio"`
+	DoIf  map[string]any `json:"do_if" required:"true"`
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "sample",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	logger := params.Logger.Desugar()
+
+	rules, err := compileRules(p.config)
+	if err != nil {
+		logger.Fatal("can't init sample", zap.Error(err))
+	}
+	p.rules = rules
+
+	for _, field := range p.config.Fields {
+		p.fields = append(p.fields, cfg.ParseFieldSelector(string(field)))
+	}
+	p.hasher = xxhash.New()
+
+	p.discardedMetric = params.MetricCtl.RegisterCounterVec(
+		"action_sample_discarded_events_total",
+		"Total events discarded by the sampling",
+		"rule",
+	)
+}
+
+// Validate checks the ratios and the rules without starting the plugin.
+func (c *Config) Validate() error {
+	_, err := compileRules(c)
+	return err
+}
+
+func compileRules(config *Config) ([]rule, error) {
+	if err := checkRatio(config.Ratio); err != nil {
+		return nil, err
+	}
+	if discardsAll(config) {
+		return nil, errors.New("ratio must be set if there are no rules with the non-zero ratio, otherwise all the events are discarded")
+	}
+	if config.Mode == modeHash && len(config.Fields) == 0 {
+		return nil, fmt.Errorf("fields must be set in %q mode", modeHash)
+	}
+
+	rules := make([]rule, 0, len(config.Rules))
+	for i, r := range config.Rules {
+		if err := checkRatio(r.Ratio); err != nil {
+			return nil, fmt.Errorf("rule #%d: %w", i, err)
+		}
+		checker, err := doif.NewFromMap(r.DoIf)
+		if err != nil {
+			return nil, fmt.Errorf("rule #%d: can't init do_if: %w", i, err)
+		}
+
+		name := r.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		rules = append(rules, rule{name: name, ratio: r.Ratio, checker: checker})
+	}
+
+	return rules, nil
+}
+
+// discardsAll returns true if all the ratios are 0.
+func discardsAll(config *Config) bool {
+	if config.Ratio > 0 {
+		return false
+	}
+	for _, r := range config.Rules {
+		if r.Ratio > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func checkRatio(ratio float64) error {
+	if ratio < 0 || ratio > 1 {
+		return fmt.Errorf("ratio must be from 0 to 1, got %v", ratio)
+	}
+	return nil
+}
+
+func (p *Plugin) Stop() {}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	name, ratio := defaultRule, p.config.Ratio
+	for i := range p.rules {
+		if p.rules[i].checker.Check(doif.NewEventDataWithMeta(event.Root, event.Meta)) {
+			name, ratio = p.rules[i].name, p.rules[i].ratio
+			break
+		}
+	}
+
+	if p.sample(event) < ratio {
+		return pipeline.ActionPass
+	}
+	p.discardedMetric.WithLabelValues(name).Inc()
+	return pipeline.ActionDiscard
+}
+
+// sample returns the number from 0 to 1, the event is kept if it's less than the ratio.
+func (p *Plugin) sample(event *pipeline.Event) float64 {
+	if p.config.Mode != modeHash {
+		return rand.Float64()
+	}
+
+	p.hasher.Reset()
+	found := false
+	for _, field := range p.fields {
+		node := event.Root.Dig(field...)
+		if node != nil {
+			found = true
+			_, _ = p.hasher.Write(node.AsBytes())
+		}
+		// the separator makes the values of the different fields distinct
+		_, _ = p.hasher.Write([]byte{0})
+	}
+	if !found {
+		return rand.Float64()
+	}
+
+	// the 53 bits of the hash are the float64 from 0 to 1 like the one of rand.Float64
+	return float64(p.hasher.Sum64()>>11) / (1 << 53)
+}
@@ -0,0 +1,176 @@
+package sample
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	insaneJSON "github.com/ozontech/insane-json"
+	"github.com/stretchr/testify/require"
+)
+
+func runSample(t *testing.T, config *Config, in []string) []string {
+	t.Helper()
+
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, test.NewConfig(config, nil), pipeline.MatchModeAnd, nil, false))
+
+	mu := sync.Mutex{}
+	out := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		mu.Lock()
+		out = append(out, strings.Clone(e.Root.EncodeToString()))
+		mu.Unlock()
+	})
+
+	// the discarded events don't reach the output, so the last event is always kept to know that all the events are processed
+	in = append(in, `{"last":"yes"}`)
+	for i, event := range in {
+		input.In(0, "test.log", test.NewOffset(int64(i)), []byte(event))
+	}
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(out) > 0 && out[len(out)-1] == `{"last":"yes"}`
+	}, 10*time.Second, 10*time.Millisecond)
+	p.Stop()
+
+	return out[:len(out)-1]
+}
+
+func TestRandom(t *testing.T) {
+	const count = 2000
+
+	in := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		in = append(in, fmt.Sprintf(`{"id":%d}`, i))
+	}
+
+	out := runSample(t, &Config{
+		Ratio: 0.5,
+		Rules: []Rule{{
+			Ratio: 1,
+			DoIf:  map[string]any{"op": "equal", "field": "last", "values": []any{"yes"}},
+		}},
+	}, in)
+
+	require.InDelta(t, count/2, len(out), count/10)
+}
+
+func TestHash(t *testing.T) {
+	const traces = 200
+
+	in := make([]string, 0, traces*3)
+	for line := 0; line < 3; line++ {
+		for trace := 0; trace < traces; trace++ {
+			in = append(in, fmt.Sprintf(`{"trace_id":"%d","line":%d}`, trace, line))
+		}
+	}
+
+	out := runSample(t, &Config{
+		Mode:   modeHash,
+		Fields: []cfg.FieldSelector{"trace_id"},
+		Ratio:  0.5,
+		Rules: []Rule{{
+			Ratio: 1,
+			DoIf:  map[string]any{"op": "equal", "field": "last", "values": []any{"yes"}},
+		}},
+	}, in)
+
+	lines := map[string]int{}
+	for _, event := range out {
+		root, err := insaneJSON.DecodeString(event)
+		require.NoError(t, err)
+		lines[strings.Clone(root.Dig("trace_id").AsString())]++
+		insaneJSON.Release(root)
+	}
+
+	require.InDelta(t, traces/2, len(lines), traces/5)
+	for trace, count := range lines {
+		require.Equal(t, 3, count, "all lines of trace %s must be kept", trace)
+	}
+}
+
+func TestRules(t *testing.T) {
+	in := []string{
+		`{"level":"error","id":1}`,
+		`{"level":"debug","id":2}`,
+		`{"level":"info","id":3}`,
+		`{"level":"debug","id":4}`,
+		`{"level":"error","id":5}`,
+	}
+
+	out := runSample(t, &Config{
+		Ratio: 1,
+		Rules: []Rule{
+			{
+				Name:  "errors",
+				Ratio: 1,
+				DoIf:  map[string]any{"op": "equal", "field": "level", "values": []any{"error"}},
+			},
+			{
+				Name:  "debug",
+				Ratio: 0,
+				DoIf:  map[string]any{"op": "equal", "field": "level", "values": []any{"debug", "error"}},
+			},
+		},
+	}, in)
+
+	require.Equal(t, []string{
+		`{"level":"error","id":1}`,
+		`{"level":"info","id":3}`,
+		`{"level":"error","id":5}`,
+	}, out)
+}
+
+func TestValidate(t *testing.T) {
+	doIf := map[string]any{"op": "equal", "field": "level", "values": []any{"error"}}
+
+	cases := []struct {
+		name   string
+		config *Config
+		valid  bool
+	}{
+		{
+			name:   "zero_ratio",
+			config: &Config{Mode: modeRandom, Rules: []Rule{{Ratio: 1, DoIf: doIf}}},
+			valid:  true,
+		},
+		{
+			name:   "discards_all",
+			config: &Config{Mode: modeRandom},
+		},
+		{
+			name:   "discards_all_with_rules",
+			config: &Config{Mode: modeRandom, Rules: []Rule{{Ratio: 0, DoIf: doIf}}},
+		},
+		{
+			name:   "negative_ratio",
+			config: &Config{Mode: modeRandom, Ratio: -0.1},
+		},
+		{
+			name:   "rule_ratio_above_one",
+			config: &Config{Mode: modeRandom, Ratio: 1, Rules: []Rule{{Ratio: 1.5, DoIf: doIf}}},
+		},
+		{
+			name:   "hash_without_fields",
+			config: &Config{Mode: modeHash, Ratio: 0.5},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package throttle
 
 import (
 	"context"
+	"fmt"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -348,6 +349,22 @@ type LimitDistributionConfig struct {
 	MetricLabels []string          `json:"metric_labels" slice:"true"`
 }
 
+// Validate checks the limit distributions and the redis backend without starting the plugin.
+func (c *Config) Validate() error {
+	if _, err := parseLimitDistribution(c.LimitDistribution.toInternal(), c.DefaultLimit); err != nil {
+		return fmt.Errorf("can't parse limit_distribution: %w", err)
+	}
+	for i, r := range c.Rules {
+		if _, err := parseLimitDistribution(r.LimitDistribution.toInternal(), r.Limit); err != nil {
+			return fmt.Errorf("can't parse limit_distribution of rule #%d: %w", i, err)
+		}
+	}
+	if c.LimiterBackend == redisBackend && c.RedisBackendCfg.WorkerCount < 1 {
+		return fmt.Errorf("worker_count must be > 0, passed: %d", c.RedisBackendCfg.WorkerCount)
+	}
+	return nil
+}
+
 func (c LimitDistributionConfig) toInternal() limitDistributionCfg {
 	internal := limitDistributionCfg{
 		Field:   string(c.Field),
@@ -1083,7 +1083,7 @@ func TestTruncationSeq(t *testing.T) {
 	defer cleanUp()
 	p, _, _ := test.NewPipelineMock(nil, "passive")
 	p.SetInput(getInputInfo())
-	p.Start()
+	require.NoError(t, p.Start())
 
 	data := getContentBytes("../../../testdata/json/streams.json")
 	data = append(data, data...)
@@ -1241,7 +1241,7 @@ func BenchmarkLightJsonReadPar(b *testing.B) {
 			wg.Done()
 		})
 
-		p.Start()
+		require.NoError(b, p.Start())
 
 		b.StartTimer()
 		wg.Wait()
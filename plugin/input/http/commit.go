@@ -0,0 +1,132 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/pipeline/metadata"
+)
+
+var errCommitTimeout = errors.New("commit timeout")
+
+// pendingRequest tracks the events of the request which aren't committed yet.
+type pendingRequest struct {
+	sourceID pipeline.SourceID
+	pending  int
+	// passed is set when all events of the request are passed into the pipeline
+	passed bool
+	done   chan struct{}
+}
+
+// startRequest returns the source id for the events of the request,
+// the request is tracked until its events are committed if wait_commit is set.
+func (p *Plugin) startRequest() (pipeline.SourceID, *pendingRequest) {
+	sourceID := p.getSourceID()
+	if !p.config.WaitCommit {
+		return sourceID, nil
+	}
+	// the source id is released after all events of the request are committed
+	return sourceID, p.addPendingRequest(sourceID)
+}
+
+// passedRequest is called after all events of the request are passed into the pipeline.
+func (p *Plugin) passedRequest(sourceID pipeline.SourceID, req *pendingRequest) {
+	if req == nil {
+		p.putSourceID(sourceID)
+		return
+	}
+	p.passedAll(req)
+}
+
+// addPendingRequest starts tracking the events passed with the source id.
+func (p *Plugin) addPendingRequest(sourceID pipeline.SourceID) *pendingRequest {
+	req := &pendingRequest{
+		sourceID: sourceID,
+		done:     make(chan struct{}),
+	}
+
+	p.mu.Lock()
+	p.pendingRequests[sourceID] = req
+	p.mu.Unlock()
+
+	return req
+}
+
+// in passes the event into the pipeline and counts it in the pending request of the source if there is one.
+func (p *Plugin) in(sourceID pipeline.SourceID, offset int64, bytes []byte, meta metadata.MetaData) {
+	if !p.config.WaitCommit {
+		_ = p.controller.In(sourceID, "http", pipeline.NewOffsets(offset, nil), bytes, true, meta)
+		return
+	}
+
+	// the event is counted before passing since it may be committed before In returns
+	p.mu.Lock()
+	req := p.pendingRequests[sourceID]
+	if req != nil {
+		req.pending++
+	}
+	p.mu.Unlock()
+
+	seqID := p.controller.In(sourceID, "http", pipeline.NewOffsets(offset, nil), bytes, true, meta)
+	// the event isn't accepted by the pipeline, so it won't be committed
+	if seqID == pipeline.EventSeqIDError && req != nil {
+		p.committed(sourceID, 1)
+	}
+}
+
+// committed marks the count of events of the source as committed.
+func (p *Plugin) committed(sourceID pipeline.SourceID, count int) {
+	if !p.config.WaitCommit {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	req := p.pendingRequests[sourceID]
+	if req == nil {
+		return
+	}
+	req.pending -= count
+	p.completeRequest(req)
+}
+
+// passedAll marks that no more events of the request will be passed.
+func (p *Plugin) passedAll(req *pendingRequest) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	req.passed = true
+	p.completeRequest(req)
+}
+
+// completeRequest notifies the waiter if all events of the request are committed.
+// The source id is released only here, even if the waiter has given up,
+// so the late commits of the request can't be confused with the events of the next one.
+// Must be called under the lock.
+func (p *Plugin) completeRequest(req *pendingRequest) {
+	if !req.passed || req.pending > 0 {
+		return
+	}
+
+	delete(p.pendingRequests, req.sourceID)
+	p.sourceIDs = append(p.sourceIDs, req.sourceID)
+	close(req.done)
+}
+
+// waitCommit waits for the commit of all events of the request.
+func (p *Plugin) waitCommit(ctx context.Context, req *pendingRequest) error {
+	timer := time.NewTimer(p.config.WaitCommitTimeout_)
+	defer timer.Stop()
+
+	select {
+	case <-req.done:
+		return nil
+	case <-timer.C:
+		return errCommitTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
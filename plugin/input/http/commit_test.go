@@ -0,0 +1,205 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin/action/join"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeBulkWaitCommit(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		timeout string
+		code    int
+	}{
+		{
+			name:    "committed",
+			timeout: "1m",
+			code:    http.StatusOK,
+		},
+		{
+			name:    "timeout",
+			timeout: "100ms",
+			code:    http.StatusGatewayTimeout,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, _, output := test.NewPipelineMock(nil, "passive")
+			inputInfo := getInputInfo(&Config{Address: "off", WaitCommit: true, WaitCommitTimeout: cfg.Duration(tt.timeout)})
+			p.SetInput(inputInfo)
+			plugin := p.GetInput().(*Plugin)
+
+			// the events are committed by the output after the release
+			release := make(chan struct{})
+			output.SetOutFn(func(_ *pipeline.Event) {
+				<-release
+			})
+			require.NoError(t, p.Start())
+			defer p.Stop()
+
+			replied := make(chan *httptest.ResponseRecorder)
+			go func() {
+				resp := httptest.NewRecorder()
+				plugin.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"a":"1"}`+"\n"+`{"b":"2"}`+"\n")))
+				replied <- resp
+			}()
+
+			var resp *httptest.ResponseRecorder
+			if tt.code == http.StatusOK {
+				select {
+				case <-replied:
+					require.Fail(t, "the request is replied before the commit")
+				case <-time.After(200 * time.Millisecond):
+				}
+				close(release)
+				resp = <-replied
+			} else {
+				resp = <-replied
+				close(release)
+			}
+			require.Equal(t, tt.code, resp.Code)
+
+			// the source id is released after the late commits as well
+			require.Eventually(t, func() bool {
+				plugin.mu.Lock()
+				defer plugin.mu.Unlock()
+				return len(plugin.pendingRequests) == 0 && len(plugin.sourceIDs) == 1
+			}, 5*time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func TestServeBulkWaitCommitJoin(t *testing.T) {
+	t.Parallel()
+
+	joinInfo, err := fd.DefaultPluginRegistry.GetActionByType("join")
+	require.NoError(t, err)
+	config := test.NewConfig(&join.Config{
+		Field:    "message",
+		Start:    "/^start/",
+		Continue: "/^ /",
+	}, nil)
+	p, _, output := test.NewPipelineMock(
+		test.NewActionPluginStaticInfo(joinInfo.Factory, config, pipeline.MatchModeAnd, nil, false),
+		"passive", "short_event_timeout",
+	)
+	inputInfo := getInputInfo(&Config{Address: "off", WaitCommit: true, WaitCommitTimeout: "1m"})
+	p.SetInput(inputInfo)
+	plugin := p.GetInput().(*Plugin)
+
+	release := make(chan struct{})
+	outEvents := make(chan string, 1)
+	output.SetOutFn(func(event *pipeline.Event) {
+		<-release
+		outEvents <- event.Root.Dig("message").AsString()
+	})
+	require.NoError(t, p.Start())
+	defer p.Stop()
+
+	replied := make(chan *httptest.ResponseRecorder)
+	go func() {
+		resp := httptest.NewRecorder()
+		body := `{"message":"start"}` + "\n" + `{"message":" first"}` + "\n" + `{"message":" second"}` + "\n"
+		plugin.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		replied <- resp
+	}()
+
+	// the collapsed events are committed with the joined one
+	select {
+	case <-replied:
+		require.Fail(t, "the request is replied before the commit of the joined event")
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(release)
+	resp := <-replied
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "start first second", <-outEvents)
+}
+
+func TestServeEmulatedWaitCommit(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		mode string
+		path string
+		body string
+		code int
+	}{
+		{
+			mode: "otlp",
+			path: otlpLogsPath,
+			body: otlpLogsRequestJSON,
+			code: http.StatusOK,
+		},
+		{
+			mode: "loki",
+			path: lokiPushPath,
+			body: `{"streams": [{"stream": {"app": "api"}, "values": [["1704103200000000001", "hello"]]}]}`,
+			code: http.StatusNoContent,
+		},
+		{
+			mode: "splunk",
+			path: "/services/collector/event",
+			body: `{"event": "hello"}{"event": "world"}`,
+			code: http.StatusOK,
+		},
+		{
+			mode: "splunk",
+			path: "/services/collector/raw",
+			body: "hello\nworld\n",
+			code: http.StatusOK,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.path, func(t *testing.T) {
+			t.Parallel()
+
+			p, _, output := test.NewPipelineMock(nil, "passive")
+			inputInfo := getInputInfo(&Config{Address: "off", EmulateMode: tt.mode, WaitCommit: true, WaitCommitTimeout: "1m"})
+			inputInfo.Config.(*Config).Meta = nil
+			p.SetInput(inputInfo)
+			plugin := p.GetInput().(*Plugin)
+
+			release := make(chan struct{})
+			output.SetOutFn(func(_ *pipeline.Event) {
+				<-release
+			})
+			require.NoError(t, p.Start())
+			defer p.Stop()
+
+			replied := make(chan *httptest.ResponseRecorder)
+			go func() {
+				resp := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+				req.Header.Set("Content-Type", "application/json")
+				plugin.ServeHTTP(resp, req)
+				replied <- resp
+			}()
+
+			select {
+			case <-replied:
+				require.Fail(t, "the request is replied before the commit")
+			case <-time.After(200 * time.Millisecond):
+			}
+			close(release)
+			resp := <-replied
+			require.Equal(t, tt.code, resp.Code, resp.Body.String())
+		})
+	}
+}
@@ -3,6 +3,7 @@ package http
 import (
 	"context"
 	"crypto/sha1"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -10,6 +11,7 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,6 +23,7 @@ import (
 	"github.com/ozontech/file.d/pipeline/metadata"
 	"github.com/ozontech/file.d/xtls"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 /*{ introduction
@@ -30,9 +33,9 @@ Also, it emulates some protocols to allow receiving events from a wide range of
 E.g. `file.d` may pretend to be Elasticsearch allows clients to send events using Elasticsearch protocol.
 So you can use Elasticsearch filebeat output plugin to send data to `file.d`.
 
-> ⚠ Currently event commitment mechanism isn't implemented for this plugin.
-> Plugin answers with HTTP code `OK 200` right after it has read all the request body.
-> It doesn't wait until events are committed.
+> ⚠ By default, the plugin answers with HTTP code `OK 200` right after it has read all the request body.
+> It doesn't wait until events are committed, so the accepted events are lost if file.d crashes.
+> Set `wait_commit` to answer only after all the events of the request are committed.
 
 **Example:**
 Emulating elastic through http:
@@ -80,6 +83,77 @@ curl "localhost:9200/_bulk" -H 'Content-Type: application/json' -d \
 {"message": "hello", "kind": "normal"}
 '
 ```
+
+**Example:**
+Receiving logs from OpenTelemetry SDKs and collectors via OTLP/HTTP:
+```yaml
+pipelines:
+  example_otlp_pipeline:
+    input:
+      type: http
+      emulate_mode: "otlp"
+      address: ":4318"
+    ...
+```
+
+Every log record of the `/v1/logs` request is passed as a separate event with the resource and scope attributes:
+```json
+{
+  "time": "2024-01-01T10:00:00.000000001Z",
+  "severity_number": 9,
+  "severity_text": "INFO",
+  "body": "hello",
+  "attributes": {"http.method": "GET"},
+  "trace_id": "5b8efff798038103d269b633813fc60c",
+  "span_id": "eee19b7ec3c1b174",
+  "resource": {"service.name": "api"},
+  "scope": {"name": "logger", "version": "1.0.0"}
+}
+```
+
+**Example:**
+Receiving logs from Promtail and Grafana Agent via the Loki push API:
+```yaml
+pipelines:
+  example_loki_pipeline:
+    input:
+      type: http
+      emulate_mode: "loki"
+      address: ":3100"
+    ...
+```
+
+Every stream entry is passed as a separate event with the timestamp in unix nanoseconds and the structured metadata as the fields:
+```json
+{"timestamp": "1704103200000000001", "message": "hello", "trace_id": "5b8efff798038103d269b633813fc60c"}
+```
+The stream labels are added to the event meta, so they are also the event fields unless the pipeline `meta_out_of_band` is set.
+The labels of all streams are checked before passing the events, so the request with the wrong labels is rejected as a whole.
+The events can be sent to Loki by the [loki](/plugin/output/loki/README.md) output with `message_field: message`, `timestamp_field: timestamp` and the labels in `meta_labels`.
+
+**Example:**
+Receiving events from the agents sending to Splunk HTTP Event Collector:
+```yaml
+pipelines:
+  example_splunk_pipeline:
+    input:
+      type: http
+      emulate_mode: "splunk"
+      address: ":8088"
+      auth:
+        strategy: bearer
+        secrets:
+          legacy_agents: "00000000-0000-0000-0000-000000000000"
+    ...
+```
+
+The HEC tokens are configured as the `bearer` secrets and sent by the agents as `Authorization: Splunk <token>`.
+Every object of the `/services/collector/event` batch is passed as a separate event as is:
+```json
+{"time": 1704103200.001, "host": "api-1", "sourcetype": "access", "event": {"message": "hello"}, "fields": {"env": "prod"}}
+```
+Every line of the `/services/collector/raw` request is passed as `{"event": "<line>"}` with the `host`, `source`, `sourcetype` and `index` query params as the fields.
+The invalid batch is rejected as a whole with the HEC error response, e.g. `{"text":"Event field is required","code":12,"invalid-event-number":3}`.
 }*/
 
 const (
@@ -99,12 +173,16 @@ type Plugin struct {
 
 	sourceIDs []pipeline.SourceID
 	sourceSeq pipeline.SourceID
+	// pendingRequests are the requests waiting for the commit of their events by the source id
+	pendingRequests map[pipeline.SourceID]*pendingRequest
 
 	gzipReaderPool sync.Pool
 	readBuffs      sync.Pool
 	eventBuffs     sync.Pool
 
 	stopChan chan struct{}
+	// draining is set when the pipeline is drained, the new requests are rejected.
+	draining atomic.Bool
 
 	// plugin metrics
 
@@ -114,8 +192,12 @@ type Plugin struct {
 	bulkRequestsDoneTotal *metric.Counter
 	requestsInProgress    *metric.Gauge
 	processBulkSeconds    *metric.Histogram
+	commitTimeoutsTotal   *metric.Counter
 
 	metaTemplater *metadata.MetaTemplater
+
+	otlpLogsRequest protoreflect.MessageDescriptor
+	lokiPushRequest protoreflect.MessageDescriptor
 }
 
 type EmulateMode byte
@@ -123,6 +205,9 @@ type EmulateMode byte
 const (
 	EmulateModeNo EmulateMode = iota
 	EmulateModeElasticSearch
+	EmulateModeOTLP
+	EmulateModeLoki
+	EmulateModeSplunk
 )
 
 // ! config-params
@@ -135,7 +220,11 @@ type Config struct {
 	// > @3@4@5@6
 	// >
 	// > Which protocol to emulate.
-	EmulateMode  string `json:"emulate_mode" default:"no" options:"no|elasticsearch"` // *
+	// > * `elasticsearch` – the `/_bulk` API
+	// > * `otlp` – the OpenTelemetry OTLP/HTTP logs `/v1/logs` in the protobuf and JSON encodings
+	// > * `loki` – the Loki push API `/loki/api/v1/push` in the JSON and snappy-compressed protobuf encodings
+	// > * `splunk` – the Splunk HTTP Event Collector `/services/collector/event` and `/services/collector/raw` APIs
+	EmulateMode  string `json:"emulate_mode" default:"no" options:"no|elasticsearch|otlp|loki|splunk"` // *
 	EmulateMode_ EmulateMode
 	// > @3@4@5@6
 	// >
@@ -172,6 +261,28 @@ type Config struct {
 	// > Allowed origins support only one wildcard symbol. `http://*.example.com` - valid, `http://*.example.*.com` - invalid.
 	// > See CORSConfig for details.
 	CORS CORSConfig `json:"cors" child:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the request is replied only after all its events are committed by the pipeline outputs.
+	// > The request is replied with `504 Gateway Timeout` if the events aren't committed within `wait_commit_timeout`,
+	// > so the client can retry it without losing the events if file.d crashes.
+	// > The retried events may be duplicated.
+	WaitCommit bool `json:"wait_commit" default:"false"` // *
+
+	// > @3@4@5@6
+	// >
+	// > How long to wait for the commit of the request events if `wait_commit` is set.
+	WaitCommitTimeout  cfg.Duration `json:"wait_commit_timeout" default:"30s" parse:"duration"` // *
+	WaitCommitTimeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > The max size of the decompressed request body in bytes for the `otlp`, `loki` and `splunk` modes,
+	// > which read the whole body into memory. The larger requests are replied with `413 Request Entity Too Large`.
+	// > The bulk request of the `no` and `elasticsearch` modes is read in chunks, so it isn't limited.
+	MaxBodySize  cfg.Expression `json:"max_body_size" default:"104857600" parse:"expression"` // *
+	MaxBodySize_ int64
 }
 
 type AuthStrategy byte
@@ -200,6 +311,7 @@ type AuthConfig struct {
 	// > AuthStrategy.Secrets describes secrets in key-value format.
 	// > If the `strategy` is basic, then the key is the login, the value is the password.
 	// > If the `strategy` is bearer, then the key is the name, the value is the Bearer token.
+	// > If the `emulate_mode` is splunk, the bearer token is the HEC token sent as `Authorization: Splunk <token>`.
 	// > Key uses in the http_input_total metric.
 	Secrets map[string]string `json:"secrets"` // *
 }
@@ -297,9 +409,21 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.InputPluginPa
 		p.logger.Fatal("failed to prepare allowed origins", zap.Error(err))
 	}
 
+	var err error
+	switch p.config.EmulateMode_ {
+	case EmulateModeOTLP:
+		p.otlpLogsRequest, err = compileProtoMessage(otlpLogsProtoFile, otlpLogsProto, otlpLogsRequestMessage)
+	case EmulateModeLoki:
+		p.lokiPushRequest, err = compileProtoMessage(lokiPushProtoFile, lokiPushProto, lokiPushRequestMessage)
+	}
+	if err != nil {
+		p.logger.Fatal("failed to init emulation", zap.Error(err), zap.String("emulate_mode", p.config.EmulateMode))
+	}
+
 	p.controller = params.Controller
 	p.controller.DisableStreams()
 	p.sourceIDs = make([]pipeline.SourceID, 0)
+	p.pendingRequests = make(map[pipeline.SourceID]*pendingRequest)
 
 	p.server = &http.Server{
 		Addr:    p.config.Address,
@@ -317,6 +441,7 @@ func (p *Plugin) registerMetrics(ctl *metric.Ctl) {
 	p.requestsInProgress = ctl.RegisterGauge("requests_in_progress", "")
 	p.processBulkSeconds = ctl.RegisterHistogram("process_bulk_seconds", "", metric.SecondsBucketsDetailed)
 	p.errorsTotal = ctl.RegisterCounter("input_http_errors_total", "Total http errors")
+	p.commitTimeoutsTotal = ctl.RegisterCounter("input_http_commit_timeouts_total", "Total requests replied before their events are committed")
 
 	if p.config.Auth.Strategy_ != StrategyDisabled {
 		httpAuthTotal := ctl.RegisterCounterVec("http_auth_success_total", "", "secret_name")
@@ -420,6 +545,10 @@ func (p *Plugin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			zap.Any("headers", r.Header),
 			zap.String("remote_addr", r.RemoteAddr),
 		)
+		if p.config.EmulateMode_ == EmulateModeSplunk {
+			p.serveSplunkAuthFailed(w, r)
+			return
+		}
 		http.Error(w, "auth failed", http.StatusUnauthorized)
 		return
 	}
@@ -477,6 +606,25 @@ func (p *Plugin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		p.logger.Error("unknown elasticsearch request", zap.String("uri", r.RequestURI), zap.String("method", r.Method))
 		return
+	case EmulateModeOTLP:
+		if path == otlpLogsPath {
+			p.serveOTLPLogs(w, r, metadataInfo)
+			return
+		}
+
+		http.Error(w, "", http.StatusNotFound)
+		return
+	case EmulateModeLoki:
+		if path == lokiPushPath {
+			p.serveLokiPush(w, r, metadataInfo)
+			return
+		}
+
+		http.Error(w, "", http.StatusNotFound)
+		return
+	case EmulateModeSplunk:
+		p.serveSplunk(w, r, metadataInfo)
+		return
 	case EmulateModeNo:
 		p.serveBulk(w, r, metadataInfo)
 		return
@@ -490,9 +638,14 @@ func (p *Plugin) serveBulk(w http.ResponseWriter, r *http.Request, meta metadata
 		http.Error(w, "", http.StatusMethodNotAllowed)
 		return
 	}
+	if p.draining.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
 
 	start := time.Now()
 	p.requestsInProgress.Inc()
+	defer p.requestsInProgress.Dec()
 
 	reader := io.Reader(r.Body)
 	if r.Header.Get("Content-Encoding") == "gzip" {
@@ -507,29 +660,72 @@ func (p *Plugin) serveBulk(w http.ResponseWriter, r *http.Request, meta metadata
 		reader = zr
 	}
 
-	if err := p.processBulk(reader, meta); err != nil {
+	sourceID, req := p.startRequest()
+	err := p.processBulk(sourceID, reader, meta)
+	p.passedRequest(sourceID, req)
+	if err != nil {
 		p.errorsTotal.Inc()
 		p.logger.Error("http input read error", zap.Error(err))
 		http.Error(w, "http input read error", http.StatusBadRequest)
 		return
 	}
 
+	if req != nil {
+		if err := p.waitCommit(r.Context(), req); err != nil {
+			p.errorsTotal.Inc()
+			p.commitTimeoutsTotal.Inc()
+			p.logger.Error("events of the request aren't committed", zap.Error(err))
+			http.Error(w, "events aren't committed", http.StatusGatewayTimeout)
+			return
+		}
+	}
+
 	_, _ = w.Write(result)
 
-	p.requestsInProgress.Dec()
 	p.bulkRequestsDoneTotal.Inc()
 	p.processBulkSeconds.Observe(time.Since(start).Seconds())
 }
 
-func (p *Plugin) processBulk(r io.Reader, meta metadata.MetaData) error {
+var errBodyTooLarge = errors.New("request body is too large")
+
+// readBody reads the whole request body, the body is decompressed if it's gzipped.
+// It returns errBodyTooLarge if the decompressed body exceeds max_body_size.
+func (p *Plugin) readBody(r *http.Request) ([]byte, error) {
+	reader := io.Reader(r.Body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := p.acquireGzipReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("can't read gzipped body: %w", err)
+		}
+		defer p.putGzipReader(zr)
+		reader = zr
+	}
+
+	// read one byte more to find out that the body is too large
+	body, err := io.ReadAll(io.LimitReader(reader, p.config.MaxBodySize_+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > p.config.MaxBodySize_ {
+		return nil, errBodyTooLarge
+	}
+	return body, nil
+}
+
+// readBodyStatus returns the status code to reply with on the readBody error.
+func readBodyStatus(err error) int {
+	if errors.Is(err, errBodyTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func (p *Plugin) processBulk(sourceID pipeline.SourceID, r io.Reader, meta metadata.MetaData) error {
 	readBuff := p.newReadBuff()
 	eventBuff := p.newEventBuffs()
 	defer p.readBuffs.Put(&readBuff)
 	defer p.eventBuffs.Put(&eventBuff)
 
-	sourceID := p.getSourceID()
-	defer p.putSourceID(sourceID)
-
 	for {
 		n, err := r.Read(readBuff)
 		if n == 0 && err == io.EOF {
@@ -561,10 +757,10 @@ func (p *Plugin) processChunk(sourceID pipeline.SourceID, readBuff []byte, event
 
 		if len(eventBuff) != 0 {
 			eventBuff = append(eventBuff, readBuff[nlPos:pos]...)
-			_ = p.controller.In(sourceID, "http", pipeline.NewOffsets(int64(pos), nil), eventBuff, true, meta)
+			p.in(sourceID, int64(pos), eventBuff, meta)
 			eventBuff = eventBuff[:0]
 		} else {
-			_ = p.controller.In(sourceID, "http", pipeline.NewOffsets(int64(pos), nil), readBuff[nlPos:pos], true, meta)
+			p.in(sourceID, int64(pos), readBuff[nlPos:pos], meta)
 		}
 
 		pos++
@@ -573,7 +769,7 @@ func (p *Plugin) processChunk(sourceID pipeline.SourceID, readBuff []byte, event
 
 	if isLastChunk {
 		// flush buffers if we can't find the newline character
-		_ = p.controller.In(sourceID, "http", pipeline.NewOffsets(int64(pos), nil), append(eventBuff, readBuff[nlPos:]...), true, meta)
+		p.in(sourceID, int64(pos), append(eventBuff, readBuff[nlPos:]...), meta)
 		eventBuff = eventBuff[:0]
 	} else {
 		eventBuff = append(eventBuff, readBuff[nlPos:]...)
@@ -593,8 +789,20 @@ func (p *Plugin) Stop() {
 	}
 }
 
-func (p *Plugin) Commit(_ *pipeline.Event) {
-	// todo: don't reply with OK till all events in request will be committed
+// Drain rejects the new requests, the requests in progress are processed till the pipeline is stopped.
+func (p *Plugin) Drain() {
+	p.draining.Store(true)
+}
+
+// Commit commits the event and the events of the request collapsed into it, e.g. by the join action.
+func (p *Plugin) Commit(event *pipeline.Event) {
+	p.committed(event.SourceID, 1+len(event.CollapsedOffsets()))
+}
+
+// Discard is called by the pipeline for the events which are discarded by the actions,
+// they are considered as committed by the request.
+func (p *Plugin) Discard(event *pipeline.Event) {
+	p.committed(event.SourceID, 1+len(event.CollapsedOffsets()))
 }
 
 // PassEvent decides pass or discard event.
@@ -637,7 +845,10 @@ func (p *Plugin) authBasic(req *http.Request) (string, bool) {
 
 func (p *Plugin) authBearer(req *http.Request) (string, bool) {
 	authHeader := req.Header.Get(p.config.Auth.Header)
-	const prefix = "Bearer "
+	prefix := "Bearer "
+	if p.config.EmulateMode_ == EmulateModeSplunk {
+		prefix = splunkAuthPrefix
+	}
 	if !strings.HasPrefix(authHeader, prefix) {
 		return "", false
 	}
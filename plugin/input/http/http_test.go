@@ -17,6 +17,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/klauspost/compress/snappy"
 	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/test"
@@ -50,7 +51,7 @@ func TestProcessChunksMany(t *testing.T) {
 	p, _, output := test.NewPipelineMock(nil, "passive")
 	p.SetInput(getInputInfo(&Config{Address: ":0"}))
 	input := p.GetInput().(*Plugin)
-	p.Start()
+	require.NoError(t, p.Start())
 
 	wg := &sync.WaitGroup{}
 	wg.Add(3)
@@ -82,7 +83,7 @@ func TestProcessChunksEventBuff(t *testing.T) {
 	p, _, output := test.NewPipelineMock(nil, "passive")
 	p.SetInput(getInputInfo(&Config{Address: ":0"}))
 	input := p.GetInput().(*Plugin)
-	p.Start()
+	require.NoError(t, p.Start())
 
 	wg := &sync.WaitGroup{}
 	wg.Add(2)
@@ -113,7 +114,7 @@ func TestProcessChunksContinue(t *testing.T) {
 	p, _, output := test.NewPipelineMock(nil, "passive")
 	p.SetInput(getInputInfo(&Config{Address: ":0"}))
 	input := p.GetInput().(*Plugin)
-	p.Start()
+	require.NoError(t, p.Start())
 
 	wg := &sync.WaitGroup{}
 	wg.Add(3)
@@ -146,7 +147,7 @@ func TestProcessChunksContinueMany(t *testing.T) {
 	p, _, output := test.NewPipelineMock(nil, "passive")
 	p.SetInput(getInputInfo(&Config{Address: ":0"}))
 	input := p.GetInput().(*Plugin)
-	p.Start()
+	require.NoError(t, p.Start())
 
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
@@ -177,7 +178,7 @@ func TestServeChunks(t *testing.T) {
 	p, _, output := test.NewPipelineMock(nil, "passive")
 	input := getInputInfo(&Config{Address: ":0"})
 	p.SetInput(input)
-	p.Start()
+	require.NoError(t, p.Start())
 
 	wg := &sync.WaitGroup{}
 	wg.Add(2)
@@ -273,7 +274,7 @@ func TestServePartialRequest(t *testing.T) {
 		wg.Done()
 	})
 
-	p.Start()
+	require.NoError(t, p.Start())
 
 	resp := httptest.NewRecorder()
 	reader := NewPartialReader([]byte(`{"hello":"`))
@@ -314,7 +315,7 @@ func TestServeChunksContinue(t *testing.T) {
 	p, _, output := test.NewPipelineMock(nil, "passive")
 	input := getInputInfo(&Config{Address: ":0"})
 	p.SetInput(input)
-	p.Start()
+	require.NoError(t, p.Start())
 
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
@@ -480,7 +481,7 @@ func TestPluginAuth(t *testing.T) {
 			inputInfo := getInputInfo(conf)
 			pipelineMock.SetInput(inputInfo)
 			// init http plugin
-			pipelineMock.Start()
+			require.NoError(t, pipelineMock.Start())
 			pipelineMock.Stop()
 
 			ok, login := inputInfo.Plugin.(*Plugin).auth(tc.Request)
@@ -550,7 +551,7 @@ func BenchmarkHttpInputJson(b *testing.B) {
 			go worker(jobs)
 		}
 
-		p.Start()
+		require.NoError(b, p.Start())
 		time.Sleep(100 * time.Millisecond) // http listen start delay
 
 		go func() {
@@ -636,7 +637,7 @@ func TestGzip(t *testing.T) {
 
 			pipelineMock.SetInput(inputInfo)
 			// init http plugin
-			pipelineMock.Start()
+			require.NoError(t, pipelineMock.Start())
 
 			wg := sync.WaitGroup{}
 			wg.Add(tc.ExpectedEvents)
@@ -661,6 +662,86 @@ func TestGzip(t *testing.T) {
 	}
 }
 
+func TestMaxBodySize(t *testing.T) {
+	t.Parallel()
+
+	gzipped := func(body []byte) []byte {
+		buf := new(bytes.Buffer)
+		gzw := gzip.NewWriter(buf)
+		_, _ = gzw.Write(body)
+		require.NoError(t, gzw.Close())
+		return buf.Bytes()
+	}
+	// the bomb is small, but it's too large after the decompression
+	bomb := bytes.Repeat([]byte(" "), 1<<20)
+
+	cases := []struct {
+		name            string
+		mode            string
+		path            string
+		contentType     string
+		contentEncoding string
+		body            []byte
+		code            int
+	}{
+		{
+			name:            "otlp",
+			mode:            "otlp",
+			path:            otlpLogsPath,
+			contentType:     "application/json",
+			contentEncoding: "gzip",
+			body:            gzipped([]byte(otlpLogsRequestJSON)),
+			code:            http.StatusOK,
+		},
+		{
+			name:            "otlp_gzip_bomb",
+			mode:            "otlp",
+			path:            otlpLogsPath,
+			contentType:     "application/json",
+			contentEncoding: "gzip",
+			body:            gzipped(bomb),
+			code:            http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:        "loki_snappy_bomb",
+			mode:        "loki",
+			path:        lokiPushPath,
+			contentType: "application/x-protobuf",
+			body:        snappy.Encode(nil, bomb),
+			code:        http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:            "splunk_gzip_bomb",
+			mode:            "splunk",
+			path:            "/services/collector/raw",
+			contentEncoding: "gzip",
+			body:            gzipped(bomb),
+			code:            http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, _, _ := test.NewPipelineMock(nil, "passive")
+			inputInfo := getInputInfo(&Config{Address: "off", EmulateMode: tt.mode, MaxBodySize: "4096"})
+			inputInfo.Config.(*Config).Meta = nil
+			p.SetInput(inputInfo)
+			plugin := p.GetInput().(*Plugin)
+			require.NoError(t, p.Start())
+			defer p.Stop()
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("Content-Encoding", tt.contentEncoding)
+			resp := httptest.NewRecorder()
+			plugin.ServeHTTP(resp, req)
+			require.Equal(t, tt.code, resp.Code, resp.Body.String())
+		})
+	}
+}
+
 func TestCORSPrepareAllowedOrigins(t *testing.T) {
 	t.Parallel()
 	r := require.New(t)
@@ -0,0 +1,258 @@
+package http
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/pipeline/metadata"
+	insaneJSON "github.com/ozontech/insane-json"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	lokiPushPath = "/loki/api/v1/push"
+
+	lokiPushProtoFile      = "loki_push.proto"
+	lokiPushRequestMessage = "PushRequest"
+)
+
+var errWrongLokiLabels = errors.New("wrong labels")
+
+//go:embed loki_push.proto
+var lokiPushProto string
+
+// serveLokiPush handles the Loki push API request in the JSON or snappy-compressed protobuf encoding.
+func (p *Plugin) serveLokiPush(w http.ResponseWriter, r *http.Request, meta metadata.MetaData) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	if p.draining.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	start := time.Now()
+	p.requestsInProgress.Inc()
+	defer p.requestsInProgress.Dec()
+
+	body, err := p.readBody(r)
+	if err != nil {
+		p.errorsTotal.Inc()
+		p.logger.Error("http input read error", zap.Error(err))
+		http.Error(w, "http input read error", readBodyStatus(err))
+		return
+	}
+
+	// Loki treats all the requests which aren't JSON as protobuf
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isProtobuf := contentType != contentTypeJSON
+	if isProtobuf {
+		body, err = p.lokiProtobufToJSON(body)
+		if err != nil {
+			p.errorsTotal.Inc()
+			p.logger.Error("can't decode loki push request", zap.Error(err))
+			http.Error(w, "can't decode loki push request", readBodyStatus(err))
+			return
+		}
+	}
+
+	root, err := insaneJSON.DecodeBytes(body)
+	if err != nil {
+		p.errorsTotal.Inc()
+		p.logger.Error("can't decode loki push request", zap.Error(err))
+		http.Error(w, "can't decode loki push request", http.StatusBadRequest)
+		return
+	}
+	defer insaneJSON.Release(root)
+
+	sourceID, req := p.startRequest()
+	err = p.processLokiPush(sourceID, root, isProtobuf, meta)
+	p.passedRequest(sourceID, req)
+	if err != nil {
+		p.errorsTotal.Inc()
+		p.logger.Error("can't process loki push request", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req != nil {
+		if err := p.waitCommit(r.Context(), req); err != nil {
+			p.errorsTotal.Inc()
+			p.commitTimeoutsTotal.Inc()
+			p.logger.Error("events of the request aren't committed", zap.Error(err))
+			http.Error(w, "events aren't committed", http.StatusGatewayTimeout)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	p.bulkRequestsDoneTotal.Inc()
+	p.processBulkSeconds.Observe(time.Since(start).Seconds())
+}
+
+func (p *Plugin) lokiProtobufToJSON(body []byte) ([]byte, error) {
+	// the decoded length is checked to not allocate the memory for the snappy bomb
+	n, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, fmt.Errorf("can't decompress snappy: %w", err)
+	}
+	if int64(n) > p.config.MaxBodySize_ {
+		return nil, errBodyTooLarge
+	}
+
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("can't decompress snappy: %w", err)
+	}
+	return protobufToJSON(p.lokiPushRequest, data, protojson.MarshalOptions{})
+}
+
+// processLokiPush passes every entry of the request streams as the event:
+//
+//	{"timestamp": "1704103200000000001", "message": "hello", "trace_id": "123"}
+//
+// The timestamp is in unix nanoseconds and the structured metadata of the entry is added as the fields,
+// so the event can be sent back to Loki by the loki output as is.
+// The stream labels are added to the event meta.
+// The labels of all streams are parsed before passing, so the request is either passed or rejected as a whole.
+func (p *Plugin) processLokiPush(sourceID pipeline.SourceID, req *insaneJSON.Root, isProtobuf bool, meta metadata.MetaData) error {
+	streams := req.Dig("streams").AsArray()
+	streamsMeta := make([]metadata.MetaData, 0, len(streams))
+	for _, stream := range streams {
+		streamMeta, err := lokiStreamMeta(stream, isProtobuf, meta)
+		if err != nil {
+			return err
+		}
+		streamsMeta = append(streamsMeta, streamMeta)
+	}
+
+	eventBuff := p.newEventBuffs()
+	defer p.eventBuffs.Put(&eventBuff)
+
+	event := insaneJSON.Spawn()
+	defer insaneJSON.Release(event)
+
+	offset := int64(0)
+	for i, stream := range streams {
+		entries := stream.Dig("values").AsArray()
+		if isProtobuf {
+			entries = stream.Dig("entries").AsArray()
+		}
+		for _, entry := range entries {
+			event.MutateToObject()
+			if isProtobuf {
+				lokiProtobufEntryToEvent(event, entry)
+			} else {
+				lokiJSONEntryToEvent(event, entry)
+			}
+
+			eventBuff = event.Encode(eventBuff[:0])
+			offset++
+			p.in(sourceID, offset, eventBuff, streamsMeta[i])
+		}
+	}
+
+	return nil
+}
+
+// lokiStreamMeta returns the request meta with the labels of the stream.
+// The meta outlives the request, so the labels are copied.
+func lokiStreamMeta(stream *insaneJSON.Node, isProtobuf bool, meta metadata.MetaData) (metadata.MetaData, error) {
+	streamMeta := make(metadata.MetaData, len(meta))
+	for k, v := range meta {
+		streamMeta[k] = v
+	}
+
+	if isProtobuf {
+		if err := parseLokiLabels(stream.Dig("labels").AsString(), streamMeta); err != nil {
+			return nil, err
+		}
+		return streamMeta, nil
+	}
+
+	for _, label := range stream.Dig("stream").AsFields() {
+		value := label.AsFieldValue()
+		if !value.IsString() {
+			return nil, fmt.Errorf("%w: label %q value must be a string", errWrongLokiLabels, label.AsString())
+		}
+		streamMeta[strings.Clone(label.AsString())] = strings.Clone(value.AsString())
+	}
+	return streamMeta, nil
+}
+
+// lokiJSONEntryToEvent converts the entry ["<unix nano>", "<line>", {<structured metadata>}].
+func lokiJSONEntryToEvent(event *insaneJSON.Root, entry *insaneJSON.Node) {
+	values := entry.AsArray()
+	if len(values) > 0 {
+		event.AddFieldNoAlloc(event, "timestamp").MutateToString(values[0].AsString())
+	}
+	if len(values) > 1 {
+		event.AddFieldNoAlloc(event, "message").MutateToString(values[1].AsString())
+	}
+	if len(values) > 2 {
+		for _, field := range values[2].AsFields() {
+			event.AddFieldNoAlloc(event, field.AsString()).MutateToString(field.AsFieldValue().AsString())
+		}
+	}
+}
+
+// lokiProtobufEntryToEvent converts the entry {"timestamp": "<RFC3339>", "line": "<line>", "structuredMetadata": [{"name": "<name>", "value": "<value>"}]}.
+func lokiProtobufEntryToEvent(event *insaneJSON.Root, entry *insaneJSON.Node) {
+	// the zero timestamp is omitted
+	ts := time.Unix(0, 0)
+	if tsNode := entry.Dig("timestamp"); tsNode != nil {
+		ts, _ = time.Parse(time.RFC3339Nano, tsNode.AsString())
+	}
+	event.AddFieldNoAlloc(event, "timestamp").MutateToString(strconv.FormatInt(ts.UnixNano(), 10))
+
+	event.AddFieldNoAlloc(event, "message").MutateToString(entry.Dig("line").AsString())
+	for _, pair := range entry.Dig("structuredMetadata").AsArray() {
+		event.AddFieldNoAlloc(event, pair.Dig("name").AsString()).MutateToString(pair.Dig("value").AsString())
+	}
+}
+
+// parseLokiLabels parses the labels in the Prometheus format, e.g. {app="api", env="prod"}.
+func parseLokiLabels(s string, labels map[string]string) error {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return fmt.Errorf("%w %q: must be enclosed in braces", errWrongLokiLabels, s)
+	}
+
+	rest := s[1 : len(s)-1]
+	for {
+		rest = strings.TrimLeft(rest, " ,")
+		if rest == "" {
+			return nil
+		}
+
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return fmt.Errorf("%w %q: label without value", errWrongLokiLabels, s)
+		}
+		name := strings.TrimSpace(rest[:eq])
+		rest = strings.TrimLeft(rest[eq+1:], " ")
+
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return fmt.Errorf("%w %q: label %q value must be quoted", errWrongLokiLabels, s, name)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return fmt.Errorf("%w %q: label %q value must be quoted", errWrongLokiLabels, s, name)
+		}
+
+		labels[strings.Clone(name)] = value
+		rest = rest[len(quoted):]
+	}
+}
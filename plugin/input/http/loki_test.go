@@ -0,0 +1,174 @@
+package http
+
+import (
+	"bytes"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestParseLokiLabels(t *testing.T) {
+	cases := []struct {
+		in     string
+		labels map[string]string
+		err    bool
+	}{
+		{in: `{}`, labels: map[string]string{}},
+		{in: `{app="api"}`, labels: map[string]string{"app": "api"}},
+		{in: ` { app = "api", env="prod",} `, labels: map[string]string{"app": "api", "env": "prod"}},
+		{in: `{msg="a \"b\", c\\d"}`, labels: map[string]string{"msg": `a "b", c\d`}},
+		{in: `app="api"`, err: true},
+		{in: `{app}`, err: true},
+		{in: `{app=api}`, err: true},
+		{in: `{app="api}`, err: true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.in, func(t *testing.T) {
+			labels := map[string]string{}
+			err := parseLokiLabels(tt.in, labels)
+			if tt.err {
+				require.ErrorIs(t, err, errWrongLokiLabels)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.labels, labels)
+		})
+	}
+}
+
+func TestServeLokiPush(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		contentType string
+		body        func(t *testing.T, plugin *Plugin) []byte
+	}{
+		{
+			name:        "json",
+			contentType: "application/json",
+			body: func(_ *testing.T, _ *Plugin) []byte {
+				return []byte(`{"streams": [
+					{"stream": {"app": "api", "env": "prod"}, "values": [
+						["1704103200000000001", "hello", {"trace_id": "123"}],
+						["1704103200000000002", "world"]
+					]},
+					{"stream": {"app": "web"}, "values": [["1704103200000000003", "!"]]}
+				]}`)
+			},
+		},
+		{
+			name:        "protobuf",
+			contentType: "application/x-protobuf",
+			body: func(t *testing.T, plugin *Plugin) []byte {
+				msg := dynamicpb.NewMessage(plugin.lokiPushRequest)
+				require.NoError(t, protojson.Unmarshal([]byte(`{"streams": [
+					{"labels": "{app=\"api\", env=\"prod\"}", "entries": [
+						{"timestamp": "2024-01-01T10:00:00.000000001Z", "line": "hello", "structuredMetadata": [{"name": "trace_id", "value": "123"}]},
+						{"timestamp": "2024-01-01T10:00:00.000000002Z", "line": "world"}
+					]},
+					{"labels": "{app=\"web\"}", "entries": [{"timestamp": "2024-01-01T10:00:00.000000003Z", "line": "!"}]}
+				]}`), msg))
+				data, err := proto.Marshal(msg)
+				require.NoError(t, err)
+				return snappy.Encode(nil, data)
+			},
+		},
+	}
+
+	// the stream labels are in the meta, they're added to the events as the fields
+	expected := []string{
+		`{"timestamp":"1704103200000000001","message":"hello","trace_id":"123","app":"api","env":"prod"}`,
+		`{"timestamp":"1704103200000000002","message":"world","app":"api","env":"prod"}`,
+		`{"timestamp":"1704103200000000003","message":"!","app":"web"}`,
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, _, output := test.NewPipelineMock(nil, "passive")
+			inputInfo := getInputInfo(&Config{Address: "off", EmulateMode: "loki"})
+			inputInfo.Config.(*Config).Meta = nil
+			p.SetInput(inputInfo)
+			plugin := p.GetInput().(*Plugin)
+
+			mu := sync.Mutex{}
+			outEvents := make([]string, 0)
+			outMeta := make([]map[string]string, 0)
+			output.SetOutFn(func(event *pipeline.Event) {
+				mu.Lock()
+				outEvents = append(outEvents, event.Root.EncodeToString())
+				outMeta = append(outMeta, maps.Clone(event.Meta))
+				mu.Unlock()
+			})
+			require.NoError(t, p.Start())
+			defer p.Stop()
+
+			req := httptest.NewRequest(http.MethodPost, lokiPushPath, bytes.NewReader(tt.body(t, plugin)))
+			req.Header.Set("Content-Type", tt.contentType)
+			resp := httptest.NewRecorder()
+			plugin.ServeHTTP(resp, req)
+
+			require.Equal(t, http.StatusNoContent, resp.Code, resp.Body.String())
+
+			require.Eventually(t, func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(outEvents) == len(expected)
+			}, 5*time.Second, 10*time.Millisecond)
+			for i, event := range expected {
+				require.JSONEq(t, event, outEvents[i])
+			}
+			require.Equal(t, map[string]string{"app": "api", "env": "prod"}, outMeta[0])
+			require.Equal(t, map[string]string{"app": "web"}, outMeta[2])
+		})
+	}
+}
+
+func TestServeLokiPushWrongLabels(t *testing.T) {
+	t.Parallel()
+
+	p, _, output := test.NewPipelineMock(nil, "passive")
+	p.SetInput(getInputInfo(&Config{Address: "off", EmulateMode: "loki"}))
+	plugin := p.GetInput().(*Plugin)
+
+	mu := sync.Mutex{}
+	outEvents := 0
+	output.SetOutFn(func(_ *pipeline.Event) {
+		mu.Lock()
+		outEvents++
+		mu.Unlock()
+	})
+	require.NoError(t, p.Start())
+	defer p.Stop()
+
+	// the request is rejected as a whole, the events of the valid stream aren't passed
+	body := `{"streams": [
+		{"stream": {"app": "api"}, "values": [["1704103200000000001", "hello"]]},
+		{"stream": {"app": 1}, "values": [["1704103200000000002", "world"]]}
+	]}`
+	req := httptest.NewRequest(http.MethodPost, lokiPushPath, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	plugin.ServeHTTP(resp, req)
+
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Zero(t, outEvents)
+}
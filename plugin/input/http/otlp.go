@@ -0,0 +1,233 @@
+package http
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/pipeline/metadata"
+	insaneJSON "github.com/ozontech/insane-json"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	otlpLogsPath = "/v1/logs"
+
+	otlpLogsProtoFile      = "otlp_logs.proto"
+	otlpLogsRequestMessage = "ExportLogsServiceRequest"
+
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+//go:embed otlp_logs.proto
+var otlpLogsProto string
+
+// serveOTLPLogs handles the OTLP/HTTP logs export request in the protobuf or JSON encoding.
+func (p *Plugin) serveOTLPLogs(w http.ResponseWriter, r *http.Request, meta metadata.MetaData) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	if p.draining.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != contentTypeProtobuf && contentType != contentTypeJSON {
+		p.errorsTotal.Inc()
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	start := time.Now()
+	p.requestsInProgress.Inc()
+	defer p.requestsInProgress.Dec()
+
+	body, err := p.readBody(r)
+	if err != nil {
+		p.errorsTotal.Inc()
+		p.logger.Error("http input read error", zap.Error(err))
+		http.Error(w, "http input read error", readBodyStatus(err))
+		return
+	}
+
+	isProtobuf := contentType == contentTypeProtobuf
+	if isProtobuf {
+		body, err = protobufToJSON(p.otlpLogsRequest, body, protojson.MarshalOptions{UseEnumNumbers: true})
+		if err != nil {
+			p.errorsTotal.Inc()
+			p.logger.Error("can't decode otlp logs request", zap.Error(err))
+			http.Error(w, "can't decode otlp logs request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	root, err := insaneJSON.DecodeBytes(body)
+	if err != nil {
+		p.errorsTotal.Inc()
+		p.logger.Error("can't decode otlp logs request", zap.Error(err))
+		http.Error(w, "can't decode otlp logs request", http.StatusBadRequest)
+		return
+	}
+	defer insaneJSON.Release(root)
+
+	// the bytes are base64-encoded by protojson, but the OTLP JSON encoding uses hex
+	sourceID, req := p.startRequest()
+	p.processOTLPLogs(sourceID, root, isProtobuf, meta)
+	p.passedRequest(sourceID, req)
+
+	if req != nil {
+		if err := p.waitCommit(r.Context(), req); err != nil {
+			p.errorsTotal.Inc()
+			p.commitTimeoutsTotal.Inc()
+			p.logger.Error("events of the request aren't committed", zap.Error(err))
+			http.Error(w, "events aren't committed", http.StatusGatewayTimeout)
+			return
+		}
+	}
+
+	// the empty ExportLogsServiceResponse means the full success
+	w.Header().Set("Content-Type", contentType)
+	if !isProtobuf {
+		_, _ = w.Write(empty)
+	}
+
+	p.bulkRequestsDoneTotal.Inc()
+	p.processBulkSeconds.Observe(time.Since(start).Seconds())
+}
+
+// processOTLPLogs passes every log record of the request as the event.
+func (p *Plugin) processOTLPLogs(sourceID pipeline.SourceID, req *insaneJSON.Root, base64IDs bool, meta metadata.MetaData) {
+	eventBuff := p.newEventBuffs()
+	defer p.eventBuffs.Put(&eventBuff)
+
+	event := insaneJSON.Spawn()
+	defer insaneJSON.Release(event)
+
+	offset := int64(0)
+	for _, resourceLogs := range req.Dig("resourceLogs").AsArray() {
+		resource := resourceLogs.Dig("resource", "attributes")
+		for _, scopeLogs := range resourceLogs.Dig("scopeLogs").AsArray() {
+			scope := scopeLogs.Dig("scope")
+			for _, record := range scopeLogs.Dig("logRecords").AsArray() {
+				event.MutateToObject()
+				otlpLogRecordToEvent(event, record, resource, scope, base64IDs)
+
+				eventBuff = event.Encode(eventBuff[:0])
+				offset++
+				p.in(sourceID, offset, eventBuff, meta)
+			}
+		}
+	}
+}
+
+// otlpLogRecordToEvent flattens the log record with its resource and scope into the event:
+//
+//	{
+//		"time": "2024-01-01T10:00:00.000000001Z",
+//		"severity_number": 9,
+//		"severity_text": "INFO",
+//		"body": "hello",
+//		"attributes": {"key": "value"},
+//		"trace_id": "5b8efff798038103d269b633813fc60c",
+//		"span_id": "eee19b7ec3c1b174",
+//		"resource": {"service.name": "api"},
+//		"scope": {"name": "logger", "version": "1.0.0", "attributes": {"key": "value"}}
+//	}
+func otlpLogRecordToEvent(event *insaneJSON.Root, record, resource, scope *insaneJSON.Node, base64IDs bool) {
+	ts := record.Dig("timeUnixNano").AsUint64()
+	if ts == 0 {
+		ts = record.Dig("observedTimeUnixNano").AsUint64()
+	}
+	if ts != 0 {
+		event.AddFieldNoAlloc(event, "time").MutateToString(time.Unix(0, int64(ts)).UTC().Format(time.RFC3339Nano))
+	}
+
+	if severityNumber := record.Dig("severityNumber").AsInt(); severityNumber != 0 {
+		event.AddFieldNoAlloc(event, "severity_number").MutateToInt(severityNumber)
+	}
+	if severityText := record.Dig("severityText"); severityText != nil {
+		event.AddFieldNoAlloc(event, "severity_text").MutateToString(severityText.AsString())
+	}
+	if body := record.Dig("body"); body != nil {
+		setOTLPAnyValue(event, event.AddFieldNoAlloc(event, "body"), body)
+	}
+	setOTLPAttributes(event, event.Node, "attributes", record.Dig("attributes"))
+
+	for _, id := range [...]struct{ from, to string }{{"traceId", "trace_id"}, {"spanId", "span_id"}} {
+		value := record.Dig(id.from).AsString()
+		if value == "" {
+			continue
+		}
+		if base64IDs {
+			raw, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				continue
+			}
+			value = hex.EncodeToString(raw)
+		}
+		event.AddFieldNoAlloc(event, id.to).MutateToString(value)
+	}
+
+	setOTLPAttributes(event, event.Node, "resource", resource)
+
+	if scope != nil {
+		scopeNode := event.AddFieldNoAlloc(event, "scope").MutateToObject()
+		if name := scope.Dig("name"); name != nil {
+			scopeNode.AddFieldNoAlloc(event, "name").MutateToString(name.AsString())
+		}
+		if version := scope.Dig("version"); version != nil {
+			scopeNode.AddFieldNoAlloc(event, "version").MutateToString(version.AsString())
+		}
+		setOTLPAttributes(event, scopeNode, "attributes", scope.Dig("attributes"))
+	}
+}
+
+// setOTLPAttributes converts the list of the OTLP key-values into the object field of the node.
+func setOTLPAttributes(root *insaneJSON.Root, node *insaneJSON.Node, field string, attributes *insaneJSON.Node) {
+	kvs := attributes.AsArray()
+	if len(kvs) == 0 {
+		return
+	}
+
+	object := node.AddFieldNoAlloc(root, field).MutateToObject()
+	for _, kv := range kvs {
+		setOTLPAnyValue(root, object.AddFieldNoAlloc(root, kv.Dig("key").AsString()), kv.Dig("value"))
+	}
+}
+
+// setOTLPAnyValue converts the OTLP AnyValue into the plain JSON value.
+func setOTLPAnyValue(root *insaneJSON.Root, dst, value *insaneJSON.Node) {
+	switch {
+	case value.Dig("stringValue") != nil:
+		dst.MutateToString(value.Dig("stringValue").AsString())
+	case value.Dig("boolValue") != nil:
+		dst.MutateToBool(value.Dig("boolValue").AsBool())
+	case value.Dig("intValue") != nil:
+		// int64 is encoded as the string in JSON
+		dst.MutateToInt64(value.Dig("intValue").AsInt64())
+	case value.Dig("doubleValue") != nil:
+		dst.MutateToFloat(value.Dig("doubleValue").AsFloat())
+	case value.Dig("bytesValue") != nil:
+		dst.MutateToString(value.Dig("bytesValue").AsString())
+	case value.Dig("arrayValue") != nil:
+		dst.MutateToArray()
+		for _, elem := range value.Dig("arrayValue", "values").AsArray() {
+			setOTLPAnyValue(root, dst.AddElementNoAlloc(root), elem)
+		}
+	case value.Dig("kvlistValue") != nil:
+		dst.MutateToObject()
+		for _, kv := range value.Dig("kvlistValue", "values").AsArray() {
+			setOTLPAnyValue(root, dst.AddFieldNoAlloc(root, kv.Dig("key").AsString()), kv.Dig("value"))
+		}
+	default:
+		dst.MutateToNull()
+	}
+}
@@ -0,0 +1,154 @@
+package http
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// the OTLP JSON encoding of the request, the trace and span ids are hex-encoded
+const otlpLogsRequestJSON = `{
+  "resourceLogs": [{
+    "resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "api"}}]},
+    "scopeLogs": [{
+      "scope": {"name": "logger", "version": "1.0.0"},
+      "logRecords": [
+        {
+          "timeUnixNano": "1704103200000000001",
+          "severityNumber": 9,
+          "severityText": "INFO",
+          "body": {"stringValue": "hello"},
+          "attributes": [
+            {"key": "count", "value": {"intValue": "10"}},
+            {"key": "ok", "value": {"boolValue": true}},
+            {"key": "tags", "value": {"arrayValue": {"values": [{"stringValue": "a"}, {"doubleValue": 1.5}]}}},
+            {"key": "user", "value": {"kvlistValue": {"values": [{"key": "id", "value": {"intValue": 1}}]}}}
+          ],
+          "traceId": "5b8efff798038103d269b633813fc60c",
+          "spanId": "eee19b7ec3c1b174"
+        },
+        {
+          "observedTimeUnixNano": "1704103200000000002",
+          "body": {"kvlistValue": {"values": [{"key": "msg", "value": {"stringValue": "world"}}]}}
+        }
+      ]
+    }]
+  }]
+}`
+
+var otlpLogsEvents = []string{
+	`{"time":"2024-01-01T10:00:00.000000001Z","severity_number":9,"severity_text":"INFO","body":"hello",` +
+		`"attributes":{"count":10,"ok":true,"tags":["a",1.5],"user":{"id":1}},` +
+		`"trace_id":"5b8efff798038103d269b633813fc60c","span_id":"eee19b7ec3c1b174",` +
+		`"resource":{"service.name":"api"},"scope":{"name":"logger","version":"1.0.0"}}`,
+	`{"time":"2024-01-01T10:00:00.000000002Z","body":{"msg":"world"},"resource":{"service.name":"api"},"scope":{"name":"logger","version":"1.0.0"}}`,
+}
+
+func TestServeOTLPLogs(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		contentType string
+		body        func(t *testing.T, plugin *Plugin) []byte
+		response    string
+	}{
+		{
+			name:        "json",
+			contentType: "application/json",
+			body: func(_ *testing.T, _ *Plugin) []byte {
+				return []byte(otlpLogsRequestJSON)
+			},
+			response: `{}`,
+		},
+		{
+			name:        "protobuf",
+			contentType: "application/x-protobuf",
+			body: func(t *testing.T, plugin *Plugin) []byte {
+				// protojson expects the base64-encoded bytes
+				protoJSON := bytes.ReplaceAll([]byte(otlpLogsRequestJSON), []byte("5b8efff798038103d269b633813fc60c"), []byte("W47/95gDgQPSabYzgT/GDA=="))
+				protoJSON = bytes.ReplaceAll(protoJSON, []byte("eee19b7ec3c1b174"), []byte("7uGbfsPBsXQ="))
+
+				msg := dynamicpb.NewMessage(plugin.otlpLogsRequest)
+				require.NoError(t, protojson.Unmarshal(protoJSON, msg))
+				body, err := proto.Marshal(msg)
+				require.NoError(t, err)
+				return body
+			},
+			response: ``,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, _, output := test.NewPipelineMock(nil, "passive")
+			inputInfo := getInputInfo(&Config{Address: "off", EmulateMode: "otlp"})
+			inputInfo.Config.(*Config).Meta = nil
+			p.SetInput(inputInfo)
+			plugin := p.GetInput().(*Plugin)
+
+			mu := sync.Mutex{}
+			outEvents := make([]string, 0)
+			output.SetOutFn(func(event *pipeline.Event) {
+				mu.Lock()
+				outEvents = append(outEvents, event.Root.EncodeToString())
+				mu.Unlock()
+			})
+			require.NoError(t, p.Start())
+			defer p.Stop()
+
+			req := httptest.NewRequest(http.MethodPost, otlpLogsPath, bytes.NewReader(tt.body(t, plugin)))
+			req.Header.Set("Content-Type", tt.contentType)
+			resp := httptest.NewRecorder()
+			plugin.ServeHTTP(resp, req)
+
+			require.Equal(t, http.StatusOK, resp.Code)
+			require.Equal(t, tt.contentType, resp.Header().Get("Content-Type"))
+			require.Equal(t, tt.response, resp.Body.String())
+
+			require.Eventually(t, func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(outEvents) == len(otlpLogsEvents)
+			}, 5*time.Second, 10*time.Millisecond)
+			for i, event := range otlpLogsEvents {
+				require.JSONEq(t, event, outEvents[i])
+			}
+		})
+	}
+}
+
+func TestServeOTLPLogsErrors(t *testing.T) {
+	t.Parallel()
+
+	p, _, _ := test.NewPipelineMock(nil, "passive")
+	p.SetInput(getInputInfo(&Config{Address: "off", EmulateMode: "otlp"}))
+	plugin := p.GetInput().(*Plugin)
+	require.NoError(t, p.Start())
+	defer p.Stop()
+
+	serve := func(path, contentType, body string) int {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", contentType)
+		resp := httptest.NewRecorder()
+		plugin.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	require.Equal(t, http.StatusNotFound, serve("/v1/traces", "application/json", `{}`))
+	require.Equal(t, http.StatusUnsupportedMediaType, serve(otlpLogsPath, "text/plain", `{}`))
+	require.Equal(t, http.StatusBadRequest, serve(otlpLogsPath, "application/json", `{`))
+	require.Equal(t, http.StatusBadRequest, serve(otlpLogsPath, "application/x-protobuf", "\xff\xff"))
+}
@@ -0,0 +1,43 @@
+package http
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// compileProtoMessage compiles the embedded proto-file and returns the descriptor of the message.
+func compileProtoMessage(fileName, content, message string) (protoreflect.MessageDescriptor, error) {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{
+				fileName: content,
+			}),
+		}),
+	}
+
+	files, err := compiler.Compile(context.Background(), fileName)
+	if err != nil {
+		return nil, fmt.Errorf("can't compile proto-file %q: %w", fileName, err)
+	}
+
+	msgDesc := files.FindFileByPath(fileName).Messages().ByName(protoreflect.Name(message))
+	if msgDesc == nil {
+		return nil, fmt.Errorf("can't find message %q in proto-file %q", message, fileName)
+	}
+	return msgDesc, nil
+}
+
+// protobufToJSON converts the protobuf-encoded message to JSON.
+func protobufToJSON(msgDesc protoreflect.MessageDescriptor, data []byte, opts protojson.MarshalOptions) ([]byte, error) {
+	msg := dynamicpb.NewMessage(msgDesc)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal proto: %w", err)
+	}
+	return opts.Marshal(msg)
+}
@@ -0,0 +1,230 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/pipeline/metadata"
+	insaneJSON "github.com/ozontech/insane-json"
+	"go.uber.org/zap"
+)
+
+const (
+	splunkAuthPrefix = "Splunk "
+
+	// HEC status codes
+	splunkCodeSuccess           = 0
+	splunkCodeTokenRequired     = 2
+	splunkCodeInvalidToken      = 4
+	splunkCodeNoData            = 5
+	splunkCodeInvalidDataFormat = 6
+	splunkCodeServerBusy        = 9
+	splunkCodeEventRequired     = 12
+	splunkCodeEventBlank        = 13
+	splunkCodeHealthy           = 17
+)
+
+// splunkRawQueryFields are the query params of the raw endpoint added to the events.
+var splunkRawQueryFields = []string{"host", "source", "sourcetype", "index"}
+
+type splunkResponse struct {
+	Text               string `json:"text"`
+	Code               int    `json:"code"`
+	InvalidEventNumber *int   `json:"invalid-event-number,omitempty"`
+}
+
+type splunkError struct {
+	code        int
+	text        string
+	eventNumber int
+}
+
+func (e *splunkError) Error() string {
+	return fmt.Sprintf("%s, event number %d", e.text, e.eventNumber)
+}
+
+func writeSplunkResponse(w http.ResponseWriter, status int, resp splunkResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// serveSplunk handles the Splunk HTTP Event Collector requests.
+func (p *Plugin) serveSplunk(w http.ResponseWriter, r *http.Request, meta metadata.MetaData) {
+	switch r.URL.Path {
+	case "/services/collector", "/services/collector/event", "/services/collector/event/1.0":
+		p.serveSplunkEvents(w, r, meta, p.processSplunkEvents)
+	case "/services/collector/raw", "/services/collector/raw/1.0":
+		p.serveSplunkEvents(w, r, meta, p.processSplunkRaw)
+	case "/services/collector/health", "/services/collector/health/1.0":
+		writeSplunkResponse(w, http.StatusOK, splunkResponse{Text: "HEC is healthy", Code: splunkCodeHealthy})
+	default:
+		writeSplunkResponse(w, http.StatusNotFound, splunkResponse{Text: "The requested URL was not found on this server.", Code: http.StatusNotFound})
+	}
+}
+
+// serveSplunkAuthFailed replies like HEC does on the missing or unknown token.
+func (p *Plugin) serveSplunkAuthFailed(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(p.config.Auth.Header) == "" {
+		writeSplunkResponse(w, http.StatusUnauthorized, splunkResponse{Text: "Token is required", Code: splunkCodeTokenRequired})
+		return
+	}
+	writeSplunkResponse(w, http.StatusForbidden, splunkResponse{Text: "Invalid token", Code: splunkCodeInvalidToken})
+}
+
+func (p *Plugin) serveSplunkEvents(
+	w http.ResponseWriter,
+	r *http.Request,
+	meta metadata.MetaData,
+	process func(sourceID pipeline.SourceID, body []byte, r *http.Request, meta metadata.MetaData) error,
+) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	if p.draining.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	start := time.Now()
+	p.requestsInProgress.Inc()
+	defer p.requestsInProgress.Dec()
+
+	body, err := p.readBody(r)
+	if err != nil {
+		p.errorsTotal.Inc()
+		p.logger.Error("http input read error", zap.Error(err))
+		writeSplunkResponse(w, readBodyStatus(err), splunkResponse{Text: "Invalid data format", Code: splunkCodeInvalidDataFormat})
+		return
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		writeSplunkResponse(w, http.StatusBadRequest, splunkResponse{Text: "No data", Code: splunkCodeNoData})
+		return
+	}
+
+	sourceID, req := p.startRequest()
+	err = process(sourceID, body, r, meta)
+	p.passedRequest(sourceID, req)
+	if err != nil {
+		p.errorsTotal.Inc()
+		p.logger.Error("can't process splunk request", zap.Error(err))
+
+		var splunkErr *splunkError
+		if errors.As(err, &splunkErr) {
+			writeSplunkResponse(w, http.StatusBadRequest, splunkResponse{
+				Text:               splunkErr.text,
+				Code:               splunkErr.code,
+				InvalidEventNumber: &splunkErr.eventNumber,
+			})
+			return
+		}
+		writeSplunkResponse(w, http.StatusBadRequest, splunkResponse{Text: "Invalid data format", Code: splunkCodeInvalidDataFormat})
+		return
+	}
+
+	if req != nil {
+		if err := p.waitCommit(r.Context(), req); err != nil {
+			p.errorsTotal.Inc()
+			p.commitTimeoutsTotal.Inc()
+			p.logger.Error("events of the request aren't committed", zap.Error(err))
+			writeSplunkResponse(w, http.StatusGatewayTimeout, splunkResponse{Text: "Server is busy", Code: splunkCodeServerBusy})
+			return
+		}
+	}
+
+	writeSplunkResponse(w, http.StatusOK, splunkResponse{Text: "Success", Code: splunkCodeSuccess})
+
+	p.bulkRequestsDoneTotal.Inc()
+	p.processBulkSeconds.Observe(time.Since(start).Seconds())
+}
+
+// processSplunkEvents passes the batch of the concatenated HEC event objects,
+// every object is passed as is, e.g. {"time": 1704103200.001, "host": "h", "event": "hello", "fields": {"k": "v"}}.
+// The batch is validated before passing, so it's either passed or rejected as a whole.
+func (p *Plugin) processSplunkEvents(sourceID pipeline.SourceID, body []byte, _ *http.Request, meta metadata.MetaData) error {
+	events := make([]json.RawMessage, 0)
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	for i := 0; ; i++ {
+		var event json.RawMessage
+		err := decoder.Decode(&event)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return &splunkError{code: splunkCodeInvalidDataFormat, text: "Invalid data format", eventNumber: i}
+		}
+
+		if err := checkSplunkEvent(event, i); err != nil {
+			return err
+		}
+		events = append(events, event)
+	}
+
+	for i, event := range events {
+		p.in(sourceID, int64(i+1), event, meta)
+	}
+	return nil
+}
+
+func checkSplunkEvent(event json.RawMessage, eventNumber int) error {
+	root, err := insaneJSON.DecodeBytes(event)
+	if err != nil || !root.IsObject() {
+		insaneJSON.Release(root)
+		return &splunkError{code: splunkCodeInvalidDataFormat, text: "Invalid data format", eventNumber: eventNumber}
+	}
+	defer insaneJSON.Release(root)
+
+	node := root.Dig("event")
+	if node == nil {
+		return &splunkError{code: splunkCodeEventRequired, text: "Event field is required", eventNumber: eventNumber}
+	}
+	if node.IsNull() || (node.IsString() && node.AsString() == "") {
+		return &splunkError{code: splunkCodeEventBlank, text: "Event field cannot be blank", eventNumber: eventNumber}
+	}
+	return nil
+}
+
+// processSplunkRaw passes every line of the body as the event {"event": "<line>"},
+// the host, source, sourcetype and index query params are added to the events.
+func (p *Plugin) processSplunkRaw(sourceID pipeline.SourceID, body []byte, r *http.Request, meta metadata.MetaData) error {
+	eventBuff := p.newEventBuffs()
+	defer p.eventBuffs.Put(&eventBuff)
+
+	event := insaneJSON.Spawn()
+	defer insaneJSON.Release(event)
+
+	query := r.URL.Query()
+	offset := int64(0)
+	for len(body) > 0 {
+		line := body
+		if pos := bytes.IndexByte(body, '\n'); pos >= 0 {
+			line, body = body[:pos], body[pos+1:]
+		} else {
+			body = nil
+		}
+		line = bytes.TrimRight(line, "\r")
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		event.MutateToObject()
+		event.AddFieldNoAlloc(event, "event").MutateToBytes(line)
+		for _, field := range splunkRawQueryFields {
+			if value := query.Get(field); value != "" {
+				event.AddFieldNoAlloc(event, field).MutateToString(value)
+			}
+		}
+
+		eventBuff = event.Encode(eventBuff[:0])
+		offset++
+		p.in(sourceID, offset, eventBuff, meta)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/require"
+)
+
+func newSplunkPlugin(t *testing.T, config *Config) (*Plugin, func() []string) {
+	p, _, output := test.NewPipelineMock(nil, "passive")
+	config.Address = "off"
+	config.EmulateMode = "splunk"
+	inputInfo := getInputInfo(config)
+	inputInfo.Config.(*Config).Meta = nil
+	p.SetInput(inputInfo)
+
+	mu := sync.Mutex{}
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(event *pipeline.Event) {
+		mu.Lock()
+		outEvents = append(outEvents, event.Root.EncodeToString())
+		mu.Unlock()
+	})
+	require.NoError(t, p.Start())
+	t.Cleanup(p.Stop)
+
+	return p.GetInput().(*Plugin), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), outEvents...)
+	}
+}
+
+func TestServeSplunk(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		path     string
+		body     string
+		expected []string
+	}{
+		{
+			name: "event",
+			path: "/services/collector/event",
+			body: `{"time": 1704103200.001, "host": "h", "event": "hello"}{"event": {"message": "world"}, "fields": {"k": "v"}}
+				{"event": "!", "sourcetype": "st"}`,
+			expected: []string{
+				`{"time":1704103200.001,"host":"h","event":"hello"}`,
+				`{"event":{"message":"world"},"fields":{"k":"v"}}`,
+				`{"event":"!","sourcetype":"st"}`,
+			},
+		},
+		{
+			name: "raw",
+			path: "/services/collector/raw?host=h&sourcetype=st",
+			body: "hello\r\n\nworld",
+			expected: []string{
+				`{"event":"hello","host":"h","sourcetype":"st"}`,
+				`{"event":"world","host":"h","sourcetype":"st"}`,
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			plugin, outEvents := newSplunkPlugin(t, &Config{})
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			resp := httptest.NewRecorder()
+			plugin.ServeHTTP(resp, req)
+
+			require.Equal(t, http.StatusOK, resp.Code)
+			require.JSONEq(t, `{"text":"Success","code":0}`, resp.Body.String())
+
+			require.Eventually(t, func() bool {
+				return len(outEvents()) == len(tt.expected)
+			}, 5*time.Second, 10*time.Millisecond)
+			for i, event := range tt.expected {
+				require.JSONEq(t, event, outEvents()[i])
+			}
+		})
+	}
+}
+
+func TestServeSplunkErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		path     string
+		body     string
+		code     int
+		response string
+	}{
+		{
+			name:     "no data",
+			path:     "/services/collector/event",
+			body:     " \n",
+			code:     http.StatusBadRequest,
+			response: `{"text":"No data","code":5}`,
+		},
+		{
+			name:     "invalid json",
+			path:     "/services/collector/event",
+			body:     `{"event": "hello"}{"event": `,
+			code:     http.StatusBadRequest,
+			response: `{"text":"Invalid data format","code":6,"invalid-event-number":1}`,
+		},
+		{
+			name:     "not object",
+			path:     "/services/collector/event",
+			body:     `{"event": "hello"} "world"`,
+			code:     http.StatusBadRequest,
+			response: `{"text":"Invalid data format","code":6,"invalid-event-number":1}`,
+		},
+		{
+			name:     "event required",
+			path:     "/services/collector/event",
+			body:     `{"host": "h"}`,
+			code:     http.StatusBadRequest,
+			response: `{"text":"Event field is required","code":12,"invalid-event-number":0}`,
+		},
+		{
+			name:     "event blank",
+			path:     "/services/collector/event",
+			body:     `{"event": "hello"}{"event": "hello"}{"event": ""}`,
+			code:     http.StatusBadRequest,
+			response: `{"text":"Event field cannot be blank","code":13,"invalid-event-number":2}`,
+		},
+		{
+			name:     "health",
+			path:     "/services/collector/health",
+			code:     http.StatusOK,
+			response: `{"text":"HEC is healthy","code":17}`,
+		},
+		{
+			name:     "not found",
+			path:     "/services/collector/ack",
+			body:     `{"acks": [0]}`,
+			code:     http.StatusNotFound,
+			response: `{"text":"The requested URL was not found on this server.","code":404}`,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			plugin, outEvents := newSplunkPlugin(t, &Config{})
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			resp := httptest.NewRecorder()
+			plugin.ServeHTTP(resp, req)
+
+			require.Equal(t, tt.code, resp.Code)
+			require.JSONEq(t, tt.response, resp.Body.String())
+			// the invalid batch is rejected as a whole
+			require.Empty(t, outEvents())
+		})
+	}
+}
+
+func TestServeSplunkAuth(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		header   string
+		code     int
+		response string
+	}{
+		{
+			name:     "ok",
+			header:   "Splunk 00000000-0000-0000-0000-000000000000",
+			code:     http.StatusOK,
+			response: `{"text":"Success","code":0}`,
+		},
+		{
+			name:     "token required",
+			code:     http.StatusUnauthorized,
+			response: `{"text":"Token is required","code":2}`,
+		},
+		{
+			name:     "invalid token",
+			header:   "Splunk 11111111-1111-1111-1111-111111111111",
+			code:     http.StatusForbidden,
+			response: `{"text":"Invalid token","code":4}`,
+		},
+		{
+			name:     "bearer",
+			header:   "Bearer 00000000-0000-0000-0000-000000000000",
+			code:     http.StatusForbidden,
+			response: `{"text":"Invalid token","code":4}`,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			plugin, _ := newSplunkPlugin(t, &Config{
+				Auth: AuthConfig{
+					Strategy: "bearer",
+					Secrets:  map[string]string{"legacy": "00000000-0000-0000-0000-000000000000"},
+				},
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/services/collector/event", strings.NewReader(`{"event": "hello"}`))
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp := httptest.NewRecorder()
+			plugin.ServeHTTP(resp, req)
+
+			require.Equal(t, tt.code, resp.Code)
+			require.JSONEq(t, tt.response, resp.Body.String())
+		})
+	}
+}
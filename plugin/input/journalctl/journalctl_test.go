@@ -12,6 +12,7 @@ import (
 	"github.com/ozontech/file.d/plugin/output/devnull"
 	"github.com/ozontech/file.d/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func setInput(p *pipeline.Pipeline, in pipeline.InputPlugin, cfg pipeline.AnyConfig) {
@@ -62,7 +63,7 @@ func TestPipeline(t *testing.T) {
 		wg.Done()
 	})
 
-	p.Start()
+	require.NoError(t, p.Start())
 	wg.Wait()
 	p.Stop()
 
@@ -113,7 +114,7 @@ func TestOffsets(t *testing.T) {
 		setInput(p, in, config)
 		setOutput(p, func(_ *pipeline.Event) {})
 
-		p.Start()
+		require.NoError(t, p.Start())
 		wg.Wait()
 		p.Stop()
 	}
@@ -12,6 +12,7 @@ import (
 	"github.com/ozontech/file.d/plugin/input/k8s/meta"
 	"github.com/ozontech/file.d/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPipeline(t *testing.T) {
@@ -41,7 +42,7 @@ func TestPipeline(t *testing.T) {
 		k8sContainerID = strings.Clone(e.Root.Dig("k8s_container_id").AsString())
 		wg.Done()
 	})
-	p.Start()
+	require.NoError(t, p.Start())
 
 	item := &meta.MetaItem{
 		Namespace:     "sre",
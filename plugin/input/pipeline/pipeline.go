@@ -0,0 +1,243 @@
+package pipeline
+
+import (
+	"sync"
+
+	"github.com/ozontech/file.d/decoder"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It receives events from other pipelines of the same `file.d` process which use the [pipeline output](/plugin/output/pipeline/README.md).
+So a common processing stage (e.g. k8s meta, masking) can be shared across several pipelines without any network hop.
+
+The event is committed to the input of the original pipeline only after this pipeline has committed or discarded it.
+Commits are passed back in the order the events were received, so the offsets of the original input are saved correctly.
+
+The events which aren't committed when this pipeline is stopped, e.g. on the config reload, are passed back to the original pipeline,
+which sends them again after the pipeline is restarted. Such events may be duplicated.
+
+**Example:**
+```yaml
+pipelines:
+  k8s:
+    input:
+      type: k8s
+    actions:
+      - type: mask
+        ...
+    output:
+      type: pipeline
+      pipeline: logs
+  logs:
+    input:
+      type: pipeline
+    output:
+      type: elasticsearch
+      ...
+```
+}*/
+
+type Plugin struct {
+	controller pipeline.InputPluginController
+	logger     *zap.SugaredLogger
+	name       string
+
+	mu      sync.Mutex
+	sources map[pipeline.SourceID]*source
+	// stopped is set on stop, the pending events are released to their senders then.
+	stopped bool
+}
+
+// Sender is the output of another pipeline which passes the events into the input.
+type Sender interface {
+	// Commit is called after the event is committed or discarded by the pipeline.
+	Commit(event *pipeline.Event)
+	// Release is called on the pipeline stop with the events which aren't committed yet
+	// in the order they were received. The sender must pass them again or report them as undelivered.
+	Release(events []*pipeline.Event)
+}
+
+// source keeps the events of the original pipeline until they are committed in this pipeline.
+type source struct {
+	events map[int64]*pendingEvent
+	// first is the offset of the first uncommitted event.
+	first int64
+	// next is the offset of the next event.
+	next int64
+}
+
+type pendingEvent struct {
+	event  *pipeline.Event
+	sender Sender
+	isDone bool
+}
+
+type Config struct{}
+
+var (
+	inputsMu = &sync.RWMutex{}
+	inputs   = make(map[string]*Plugin)
+)
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterInput(&pipeline.PluginStaticInfo{
+		Type:    "pipeline",
+		Factory: Factory,
+	})
+}
+
+func Factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+// Get returns the input of the pipeline with the given name.
+// It returns nil if the pipeline isn't started or doesn't use the pipeline input.
+func Get(pipelineName string) *Plugin {
+	inputsMu.RLock()
+	defer inputsMu.RUnlock()
+
+	return inputs[pipelineName]
+}
+
+func (p *Plugin) Start(_ pipeline.AnyConfig, params *pipeline.InputPluginParams) {
+	p.controller = params.Controller
+	p.logger = params.Logger
+	p.name = params.PipelineName
+	p.sources = make(map[pipeline.SourceID]*source)
+
+	// events are passed between pipelines as JSON
+	p.controller.SuggestDecoder(decoder.JSON)
+
+	inputsMu.Lock()
+	inputs[p.name] = p
+	inputsMu.Unlock()
+}
+
+func (p *Plugin) Stop() {
+	inputsMu.Lock()
+	// the pipeline may be already restarted with the new input
+	if inputs[p.name] == p {
+		delete(inputs, p.name)
+	}
+	inputsMu.Unlock()
+
+	// the pending events won't be committed by the stopped pipeline, so they are released to be sent again
+	p.mu.Lock()
+	p.stopped = true
+	released := make(map[Sender][]*pipeline.Event)
+	for sourceID, src := range p.sources {
+		for offset := src.first; offset < src.next; offset++ {
+			pending := src.events[offset]
+			released[pending.sender] = append(released[pending.sender], pending.event)
+		}
+		delete(p.sources, sourceID)
+	}
+	p.mu.Unlock()
+
+	for sender, events := range released {
+		p.logger.Infof("releasing %d uncommitted events", len(events))
+		sender.Release(events)
+	}
+}
+
+// In passes the event of another pipeline into this pipeline.
+// The event is committed with the sender after this pipeline has committed or discarded it.
+func (p *Plugin) In(sourceID pipeline.SourceID, event *pipeline.Event, data []byte, sender Sender) {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		sender.Release([]*pipeline.Event{event})
+		return
+	}
+	src := p.sources[sourceID]
+	if src == nil {
+		src = &source{
+			events: make(map[int64]*pendingEvent),
+			first:  1,
+			next:   1,
+		}
+		p.sources[sourceID] = src
+	}
+	offset := src.next
+	src.next++
+	src.events[offset] = &pendingEvent{
+		event:  event,
+		sender: sender,
+	}
+	p.mu.Unlock()
+
+	// don't hold the lock here since the event pool may block until some events are committed
+	seqID := p.controller.In(sourceID, event.SourceName, pipeline.NewOffsets(offset, nil), data, false, nil)
+	if seqID == pipeline.EventSeqIDError {
+		p.done(sourceID, offset)
+	}
+}
+
+// Commit commits the event and the events collapsed into it, e.g. by the join action.
+func (p *Plugin) Commit(event *pipeline.Event) {
+	p.done(event.SourceID, event.Offset, event.CollapsedOffsets()...)
+}
+
+// Discard is called by the pipeline for the events which are discarded and won't be committed.
+func (p *Plugin) Discard(event *pipeline.Event) {
+	p.done(event.SourceID, event.Offset, event.CollapsedOffsets()...)
+}
+
+// Drain keeps receiving the events on the pipeline drain,
+// since the events come from the pipelines which are drained at the same time.
+func (p *Plugin) Drain() {}
+
+// PassEvent decides pass or discard event.
+func (p *Plugin) PassEvent(_ *pipeline.Event) bool {
+	return true
+}
+
+// done marks the event and the events collapsed into it as processed and commits all processed events
+// from the start of the source in the order they were received.
+func (p *Plugin) done(sourceID pipeline.SourceID, offset int64, collapsedOffsets ...int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// the events are already released to their senders
+	if p.stopped {
+		return
+	}
+
+	src := p.sources[sourceID]
+	if src == nil {
+		p.logger.Errorf("can't find source %d of the event with offset %d", sourceID, offset)
+		return
+	}
+
+	p.markDone(src, sourceID, offset)
+	for _, collapsed := range collapsedOffsets {
+		p.markDone(src, sourceID, collapsed)
+	}
+
+	for src.first < src.next {
+		pending := src.events[src.first]
+		if !pending.isDone {
+			return
+		}
+
+		pending.sender.Commit(pending.event)
+		delete(src.events, src.first)
+		src.first++
+	}
+
+	// all events are committed, so forget the source
+	delete(p.sources, sourceID)
+}
+
+// markDone marks the event with the offset as processed.
+func (p *Plugin) markDone(src *source, sourceID pipeline.SourceID, offset int64) {
+	pending := src.events[offset]
+	if pending == nil {
+		p.logger.Errorf("can't find event with offset %d of source %d", offset, sourceID)
+		return
+	}
+	pending.isDone = true
+}
@@ -0,0 +1,168 @@
+package pipeline
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/decoder"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/pipeline/metadata"
+	"github.com/ozontech/file.d/plugin/output/devnull"
+	"github.com/ozontech/file.d/test"
+	insaneJSON "github.com/ozontech/insane-json"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSender struct {
+	mu       sync.Mutex
+	commits  []*pipeline.Event
+	released []*pipeline.Event
+}
+
+func (c *fakeSender) Commit(event *pipeline.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.commits = append(c.commits, event)
+}
+
+func (c *fakeSender) Release(events []*pipeline.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.released = append(c.released, events...)
+}
+
+func (c *fakeSender) getReleased() []*pipeline.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*pipeline.Event(nil), c.released...)
+}
+
+func (c *fakeSender) getCommits() []*pipeline.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*pipeline.Event(nil), c.commits...)
+}
+
+type fakeInputController struct{}
+
+func (c *fakeInputController) In(_ pipeline.SourceID, _ string, _ pipeline.Offsets, _ []byte, _ bool, _ metadata.MetaData) uint64 {
+	return 1
+}
+func (c *fakeInputController) UseSpread()                          {}
+func (c *fakeInputController) DisableStreams()                     {}
+func (c *fakeInputController) SuggestDecoder(_ decoder.Type)       {}
+func (c *fakeInputController) IncReadOps()                         {}
+func (c *fakeInputController) IncMaxEventSizeExceeded(_ ...string) {}
+
+func newEvent(t *testing.T, json string) *pipeline.Event {
+	root, err := insaneJSON.DecodeString(json)
+	require.NoError(t, err)
+	return &pipeline.Event{Root: root}
+}
+
+func TestCommitOrder(t *testing.T) {
+	params := test.NewEmptyInputPluginParams()
+	params.Controller = &fakeInputController{}
+
+	p := &Plugin{}
+	p.Start(&Config{}, params)
+	defer p.Stop()
+
+	r := require.New(t)
+	r.Equal(p, Get(params.PipelineName))
+
+	upstream := &fakeSender{}
+	events := []*pipeline.Event{newEvent(t, `{"a":1}`), newEvent(t, `{"a":2}`), newEvent(t, `{"a":3}`)}
+	for _, event := range events {
+		p.In(1, event, []byte(event.Root.EncodeToString()), upstream)
+	}
+
+	// commit and discard events out of order
+	p.Commit(&pipeline.Event{SourceID: 1, Offset: 3})
+	r.Empty(upstream.getCommits(), "events must be committed in order")
+
+	p.Discard(&pipeline.Event{SourceID: 1, Offset: 2})
+	r.Empty(upstream.getCommits(), "events must be committed in order")
+
+	p.Commit(&pipeline.Event{SourceID: 1, Offset: 1})
+	r.Equal(events, upstream.getCommits(), "all events must be committed in order")
+}
+
+func TestStopReleasesPending(t *testing.T) {
+	params := test.NewEmptyInputPluginParams()
+	params.Controller = &fakeInputController{}
+
+	p := &Plugin{}
+	p.Start(&Config{}, params)
+
+	r := require.New(t)
+
+	upstream := &fakeSender{}
+	events := []*pipeline.Event{newEvent(t, `{"a":1}`), newEvent(t, `{"a":2}`), newEvent(t, `{"a":3}`)}
+	for _, event := range events {
+		p.In(1, event, []byte(event.Root.EncodeToString()), upstream)
+	}
+
+	p.Commit(&pipeline.Event{SourceID: 1, Offset: 1})
+	p.Commit(&pipeline.Event{SourceID: 1, Offset: 3})
+	r.Equal(events[:1], upstream.getCommits())
+
+	p.Stop()
+	r.Nil(Get(params.PipelineName))
+	r.Equal(events[1:], upstream.getReleased(), "uncommitted events must be released in order")
+
+	// the late commits of the stopped pipeline are ignored
+	p.Commit(&pipeline.Event{SourceID: 1, Offset: 2})
+	r.Equal(events[:1], upstream.getCommits())
+
+	// the events passed after the stop are released at once
+	event := newEvent(t, `{"a":4}`)
+	p.In(1, event, []byte(event.Root.EncodeToString()), upstream)
+	r.Equal(append(events[1:], event), upstream.getReleased())
+}
+
+func TestForward(t *testing.T) {
+	const eventsCount = 10
+
+	p := test.NewPipeline(nil, "passive")
+	input := &Plugin{}
+	p.SetInput(&pipeline.InputPluginInfo{
+		PluginStaticInfo: &pipeline.PluginStaticInfo{
+			Config: &Config{},
+		},
+		PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{
+			Plugin: input,
+		},
+	})
+
+	outPlugin, outCfg := devnull.Factory()
+	output := outPlugin.(*devnull.Plugin)
+	wg := &sync.WaitGroup{}
+	wg.Add(eventsCount)
+	output.SetOutFn(func(_ *pipeline.Event) {
+		wg.Done()
+	})
+	p.SetOutput(&pipeline.OutputPluginInfo{
+		PluginStaticInfo: &pipeline.PluginStaticInfo{
+			Config: outCfg,
+		},
+		PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{
+			Plugin: output,
+		},
+	})
+	require.NoError(t, p.Start())
+
+	upstream := &fakeSender{}
+	events := make([]*pipeline.Event, 0, eventsCount)
+	for i := 0; i < eventsCount; i++ {
+		event := newEvent(t, `{"message":"hello"}`)
+		event.SourceID = 1
+		events = append(events, event)
+		input.In(1, event, []byte(event.Root.EncodeToString()+"\n"), upstream)
+	}
+
+	wg.Wait()
+	p.Stop()
+
+	require.Equal(t, events, upstream.getCommits(), "all events must be committed in order")
+}
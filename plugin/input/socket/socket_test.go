@@ -48,7 +48,7 @@ func doTest(t *testing.T, config *Config, clients int, parallel bool) {
 		},
 	})
 
-	p.Start()
+	require.NoError(t, p.Start())
 
 	connWrite := func(conn net.Conn, wg *sync.WaitGroup) {
 		_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
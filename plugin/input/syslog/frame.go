@@ -0,0 +1,99 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+var errFrameTooLarge = errors.New("frame is too large")
+
+// frameReader reads the syslog messages from the stream framed as described in RFC 6587.
+// The framing is detected per frame: the octet-counted frame "<length> <message>" starts with a digit,
+// the non-transparent frame is terminated by the new line.
+type frameReader struct {
+	r       *bufio.Reader
+	maxSize int
+	buf     []byte
+}
+
+func newFrameReader(r io.Reader, maxSize int) *frameReader {
+	return &frameReader{
+		r:       bufio.NewReader(r),
+		maxSize: maxSize,
+	}
+}
+
+// next returns the next message, it's valid until the next call.
+func (f *frameReader) next() ([]byte, error) {
+	for {
+		first, err := f.r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+
+		switch c := first[0]; {
+		case c == '\n' || c == '\r':
+			// the empty lines between the frames are skipped
+			_, _ = f.r.ReadByte()
+		case c >= '1' && c <= '9':
+			return f.readOctetCounted()
+		default:
+			return f.readNonTransparent()
+		}
+	}
+}
+
+// readOctetCounted reads the frame with the message length, so the message can contain the new lines.
+func (f *frameReader) readOctetCounted() ([]byte, error) {
+	length := 0
+	for {
+		c, err := f.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if c == ' ' {
+			break
+		}
+		if c < '0' || c > '9' {
+			return nil, fmt.Errorf("wrong frame length: unexpected %q", c)
+		}
+
+		length = length*10 + int(c-'0')
+		if length > f.maxSize {
+			return nil, errFrameTooLarge
+		}
+	}
+
+	f.buf = slices.Grow(f.buf[:0], length)[:length]
+	if _, err := io.ReadFull(f.r, f.buf); err != nil {
+		return nil, err
+	}
+	return f.buf, nil
+}
+
+// readNonTransparent reads the frame terminated by the new line, the last frame of the stream may be not terminated.
+func (f *frameReader) readNonTransparent() ([]byte, error) {
+	f.buf = f.buf[:0]
+	for {
+		line, err := f.r.ReadSlice('\n')
+		f.buf = append(f.buf, line...)
+		if len(f.buf) > f.maxSize+1 {
+			return nil, errFrameTooLarge
+		}
+
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil && (!errors.Is(err, io.EOF) || len(f.buf) == 0) {
+			return nil, err
+		}
+
+		f.buf = bytes.TrimSuffix(f.buf, []byte{'\n'})
+		f.buf = bytes.TrimSuffix(f.buf, []byte{'\r'})
+		return f.buf, nil
+	}
+}
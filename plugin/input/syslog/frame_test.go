@@ -0,0 +1,96 @@
+package syslog
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameReader(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      string
+		maxSize int
+		out     []string
+		err     error
+	}{
+		{
+			name: "non_transparent",
+			in:   "<34>1 a\n<34>1 b\r\n\n<34>1 c",
+			out:  []string{"<34>1 a", "<34>1 b", "<34>1 c"},
+		},
+		{
+			name: "octet_counted",
+			in:   "7 <34>1 a8 <34>1 \nb\n7 <34>1 c",
+			out:  []string{"<34>1 a", "<34>1 \nb", "<34>1 c"},
+		},
+		{
+			name: "mixed",
+			in:   "7 <34>1 a<34>1 b\n7 <34>1 c",
+			out:  []string{"<34>1 a", "<34>1 b", "<34>1 c"},
+		},
+		{
+			name: "truncated_octet_counted",
+			in:   "10 <34>1 a",
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			name: "wrong_length",
+			in:   "7a <34>1 a",
+			err:  errors.New(`wrong frame length: unexpected 'a'`),
+		},
+		{
+			name:    "too_large_octet_counted",
+			in:      "100 <34>1 a",
+			maxSize: 10,
+			err:     errFrameTooLarge,
+		},
+		{
+			name:    "too_large_non_transparent",
+			in:      "<34>1 a\n<34>1 bbbbbbbbbbbbb\n",
+			maxSize: 10,
+			out:     []string{"<34>1 a"},
+			err:     errFrameTooLarge,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			maxSize := tt.maxSize
+			if maxSize == 0 {
+				maxSize = 1024
+			}
+			r := newFrameReader(strings.NewReader(tt.in), maxSize)
+
+			out := make([]string, 0)
+			var err error
+			for {
+				var frame []byte
+				frame, err = r.next()
+				if err != nil {
+					break
+				}
+				out = append(out, string(frame))
+			}
+
+			require.Equal(t, tt.out, nilIfEmpty(out))
+			if tt.err == nil {
+				require.ErrorIs(t, err, io.EOF)
+			} else if errors.Is(err, tt.err) {
+				require.ErrorIs(t, err, tt.err)
+			} else {
+				require.EqualError(t, err, tt.err.Error())
+			}
+		})
+	}
+}
+
+func nilIfEmpty(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,382 @@
+package syslog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/pipeline/metadata"
+	"github.com/ozontech/file.d/xtls"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It receives the syslog messages from the network devices and the syslog daemons over TCP, TLS or UDP.
+
+The TCP stream framing is detected per message as described in [RFC 6587](https://www.rfc-editor.org/rfc/rfc6587):
+* the octet-counted frame `<length> <message>` starts with a digit, the message can contain the new lines;
+* the non-transparent frame is terminated by the new line.
+
+Every UDP datagram is a single message.
+
+The messages are passed as is, so the pipeline `decoder` should be set to `syslog_rfc5424` or `syslog_rfc3164` to parse them.
+The peer address and the common name of the TLS client certificate are added to the event meta, see Meta params.
+
+> ⚠ The connection is closed if the message is larger than `max_message_size` or the frame is malformed.
+}*/
+
+/*{ examples
+TCP with RFC 5424 messages:
+```yaml
+pipelines:
+  example_pipeline:
+    settings:
+      decoder: syslog_rfc5424
+    input:
+      type: syslog
+      network: tcp
+      address: ':6514'
+    ...
+```
+---
+TLS with the client certificates verification:
+```yaml
+pipelines:
+  example_pipeline:
+    settings:
+      decoder: syslog_rfc5424
+    input:
+      type: syslog
+      network: tcp
+      address: ':6514'
+      ca_cert: './cert.pem'
+      private_key: './key.pem'
+      client_ca_cert: './client_ca.pem'
+    ...
+```
+---
+UDP with RFC 3164 messages:
+```yaml
+pipelines:
+  example_pipeline:
+    settings:
+      decoder: syslog_rfc3164
+    input:
+      type: syslog
+      network: udp
+      address: ':514'
+    ...
+```
+}*/
+
+const (
+	networkTcp = "tcp"
+	networkUdp = "udp"
+
+	sourceName = "syslog"
+
+	metaRemoteAddr  = "remote_addr"
+	metaTLSClientCN = "tls_client_cn"
+
+	handshakeTimeout = 10 * time.Second
+)
+
+type Plugin struct {
+	config     *Config
+	controller pipeline.InputPluginController
+	logger     *zap.Logger
+
+	stopChan chan struct{}
+
+	// plugin metrics
+	connectionsMetric   *metric.Gauge
+	droppedFramesMetric *metric.Counter
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > Which network type to listen.
+	Network string `json:"network" default:"tcp" options:"tcp|udp"` // *
+
+	// > @3@4@5@6
+	// >
+	// > An address to listen to.
+	// >
+	// > For example:
+	// > - 1.2.3.4:514
+	// > - :6514
+	Address string `json:"address" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > CA certificate in PEM encoding. This can be a path or the content of the certificate.
+	// > If both ca_cert and private_key are set, the server starts accepting connections in TLS mode.
+	// >> Works only if `network` is set to `tcp`.
+	CACert string `json:"ca_cert" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > CA private key in PEM encoding. This can be a path or the content of the key.
+	// >> Works only if `network` is set to `tcp`.
+	PrivateKey string `json:"private_key" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > CA certificate in PEM encoding to verify the client certificates. This can be a path or the content of the certificate.
+	// > If set, the clients must present the certificates signed by the CA.
+	// >> Works only in TLS mode.
+	ClientCACert string `json:"client_ca_cert" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Max size of the message in bytes.
+	MaxMessageSize int `json:"max_message_size" default:"65536"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterInput(&pipeline.PluginStaticInfo{
+		Type:    "syslog",
+		Factory: Factory,
+	})
+}
+
+func Factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.InputPluginParams) {
+	p.logger = params.Logger.Desugar()
+	p.config = config.(*Config)
+	p.controller = params.Controller
+	p.registerMetrics(params.MetricCtl)
+
+	if p.config.MaxMessageSize <= 0 {
+		p.logger.Fatal("max_message_size must be positive")
+	}
+
+	p.stopChan = make(chan struct{})
+
+	var (
+		ln  net.Listener
+		pc  net.PacketConn
+		err error
+	)
+	switch p.config.Network {
+	case networkTcp:
+		if p.config.CACert == "" && p.config.PrivateKey == "" {
+			ln, err = net.Listen(p.config.Network, p.config.Address)
+			break
+		}
+
+		tlsBuilder := xtls.NewConfigBuilder()
+		err = tlsBuilder.AppendX509KeyPair(p.config.CACert, p.config.PrivateKey)
+		if err == nil && p.config.ClientCACert != "" {
+			err = tlsBuilder.AppendClientCA(p.config.ClientCACert)
+		}
+		if err == nil {
+			ln, err = tls.Listen(p.config.Network, p.config.Address, tlsBuilder.Build())
+		}
+	case networkUdp:
+		pc, err = net.ListenPacket(p.config.Network, p.config.Address)
+	default:
+		p.logger.Fatal("unknown network type")
+	}
+	if err != nil {
+		p.logger.Fatal("can't start listen", zap.Error(err),
+			zap.String("network", p.config.Network), zap.String("address", p.config.Address))
+	}
+
+	p.logger.Info("start listen", zap.String("network", p.config.Network), zap.String("address", p.config.Address))
+	if ln != nil {
+		go p.listen(ln)
+	} else {
+		go p.listenPacket(pc)
+	}
+}
+
+func (p *Plugin) registerMetrics(ctl *metric.Ctl) {
+	p.connectionsMetric = ctl.RegisterGauge("input_syslog_connections", "Number of the open syslog connections")
+	p.droppedFramesMetric = ctl.RegisterCounter("input_syslog_dropped_frames_total", "Total malformed or too large syslog frames")
+}
+
+func (p *Plugin) Stop() {
+	p.logger.Info("stop listen")
+	close(p.stopChan)
+}
+
+func (p *Plugin) Commit(_ *pipeline.Event) {
+}
+
+func (p *Plugin) PassEvent(_ *pipeline.Event) bool {
+	return true
+}
+
+func (p *Plugin) listen(ln net.Listener) {
+	wg := &sync.WaitGroup{}
+
+	defer func() {
+		wg.Wait()
+		_ = ln.Close()
+	}()
+
+	go func() {
+		<-p.stopChan
+		_ = ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			// after stopping plugin it's normal to get "use of closed network connection" error
+			if !strings.Contains(err.Error(), "use of closed network connection") {
+				p.logger.Error("failed to accept connection", zap.Error(err))
+			}
+			select {
+			case <-time.After(100 * time.Millisecond):
+				continue
+			case <-p.stopChan:
+				return
+			}
+		}
+
+		wg.Add(1)
+		go p.handleConn(conn, wg)
+	}
+}
+
+func (p *Plugin) handleConn(c net.Conn, wg *sync.WaitGroup) {
+	p.connectionsMetric.Inc()
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		_ = c.Close()
+		p.connectionsMetric.Dec()
+		wg.Done()
+	}()
+
+	// the connection is closed on stop, so the plugin doesn't wait for the clients to disconnect
+	go func() {
+		select {
+		case <-p.stopChan:
+			_ = c.Close()
+		case <-done:
+		}
+	}()
+
+	meta := metadata.MetaData{metaRemoteAddr: addrHost(c.RemoteAddr())}
+	if tlsConn, ok := c.(*tls.Conn); ok {
+		cn, err := handshake(tlsConn)
+		if err != nil {
+			p.logger.Error("tls handshake failed", zap.Error(err), zap.String("remote_addr", c.RemoteAddr().String()))
+			return
+		}
+		if cn != "" {
+			meta[metaTLSClientCN] = cn
+		}
+	}
+
+	sourceID := calcSourceID(c.RemoteAddr())
+	frames := newFrameReader(c, p.config.MaxMessageSize)
+	offset := int64(0)
+	for {
+		frame, err := frames.next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				p.droppedFramesMetric.Inc()
+				p.logger.Error("connection dropped", zap.Error(err), zap.String("remote_addr", c.RemoteAddr().String()))
+			}
+			return
+		}
+
+		offset++
+		_ = p.controller.In(sourceID, sourceName, pipeline.NewOffsets(offset, nil), frame, offset == 1, meta)
+	}
+}
+
+// handshake returns the common name of the client certificate.
+func handshake(c *tls.Conn) (string, error) {
+	_ = c.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := c.Handshake(); err != nil {
+		return "", err
+	}
+	_ = c.SetDeadline(time.Time{})
+
+	certs := c.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", nil
+	}
+	return certs[0].Subject.CommonName, nil
+}
+
+func (p *Plugin) listenPacket(pc net.PacketConn) {
+	defer func() {
+		_ = pc.Close()
+	}()
+
+	go func() {
+		<-p.stopChan
+		_ = pc.Close()
+	}()
+
+	buf := make([]byte, 65535) // max udp-packet size = 64kb
+
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				p.logger.Error("connection dropped", zap.Error(err))
+			}
+			return
+		}
+
+		p.handlePacket(buf[:n], addr)
+	}
+}
+
+func (p *Plugin) handlePacket(packet []byte, addr net.Addr) {
+	packet = bytes.TrimRight(packet, "\r\n")
+	if len(packet) == 0 {
+		return
+	}
+	if len(packet) > p.config.MaxMessageSize {
+		p.droppedFramesMetric.Inc()
+		return
+	}
+
+	meta := metadata.MetaData{metaRemoteAddr: addrHost(addr)}
+	_ = p.controller.In(calcSourceID(addr), sourceName, pipeline.NewOffsets(0, nil), packet, true, meta)
+}
+
+func addrHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+func calcSourceID(addr net.Addr) pipeline.SourceID {
+	return pipeline.SourceID(xxhash.Sum64String(addr.Network() + "_" + addr.String()))
+}
+
+/*{ meta-params
+**`remote_addr`** *`string`*
+
+The IP address of the peer.
+
+**`tls_client_cn`** *`string`*
+
+The common name of the TLS client certificate, it's set only if the client presented the certificate.
+}*/
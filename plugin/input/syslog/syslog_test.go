@@ -0,0 +1,172 @@
+package syslog
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin/output/devnull"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/require"
+)
+
+type syslogTest struct {
+	p   *pipeline.Pipeline
+	mu  sync.Mutex
+	out []string
+}
+
+func newSyslogTest(t *testing.T, config *Config) *syslogTest {
+	t.Helper()
+	p := test.NewPipeline(nil, "passive")
+
+	test.NewConfig(config, nil)
+	p.SetInput(&pipeline.InputPluginInfo{
+		PluginStaticInfo: &pipeline.PluginStaticInfo{
+			Config: config,
+		},
+		PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{
+			Plugin: &Plugin{},
+		},
+	})
+
+	outPlugin, outCfg := devnull.Factory()
+	output := outPlugin.(*devnull.Plugin)
+	p.SetOutput(&pipeline.OutputPluginInfo{
+		PluginStaticInfo: &pipeline.PluginStaticInfo{
+			Config: outCfg,
+		},
+		PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{
+			Plugin: output,
+		},
+	})
+
+	st := &syslogTest{p: p}
+	output.SetOutFn(func(e *pipeline.Event) {
+		st.mu.Lock()
+		st.out = append(st.out, e.Root.EncodeToString())
+		st.mu.Unlock()
+	})
+
+	require.NoError(t, p.Start())
+	return st
+}
+
+func (st *syslogTest) waitOut(t *testing.T, count int) []string {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		return len(st.out) >= count
+	}, 10*time.Second, 10*time.Millisecond)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.out
+}
+
+// the messages are JSON to be decoded by the default test pipeline decoder
+func TestSyslogTCP(t *testing.T) {
+	st := newSyslogTest(t, &Config{Network: networkTcp, Address: "127.0.0.1:5514"})
+	defer st.p.Stop()
+
+	conn, err := net.Dial(networkTcp, "127.0.0.1:5514")
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("{\"a\":1}\n8 {\"b\":\n2}{\"c\":3}\n"))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	require.Equal(t, []string{
+		`{"a":1,"remote_addr":"127.0.0.1"}`,
+		`{"b":2,"remote_addr":"127.0.0.1"}`,
+		`{"c":3,"remote_addr":"127.0.0.1"}`,
+	}, st.waitOut(t, 3))
+}
+
+func TestSyslogUDP(t *testing.T) {
+	st := newSyslogTest(t, &Config{Network: networkUdp, Address: "127.0.0.1:5515"})
+	defer st.p.Stop()
+
+	conn, err := net.Dial(networkUdp, "127.0.0.1:5515")
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("{\"a\":\n1}\n"))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	require.Equal(t, []string{`{"a":1,"remote_addr":"127.0.0.1"}`}, st.waitOut(t, 1))
+}
+
+func TestSyslogTLSClientCN(t *testing.T) {
+	ca, caKey, caPEM, _ := genCert(t, "ca", nil, nil)
+	_, _, serverPEM, serverKeyPEM := genCert(t, "server", ca, caKey)
+	_, _, clientPEM, clientKeyPEM := genCert(t, "client.example.com", ca, caKey)
+
+	st := newSyslogTest(t, &Config{
+		Network:      networkTcp,
+		Address:      "127.0.0.1:5516",
+		CACert:       serverPEM,
+		PrivateKey:   serverKeyPEM,
+		ClientCACert: caPEM,
+	})
+	defer st.p.Stop()
+
+	clientCert, err := tls.X509KeyPair([]byte(clientPEM), []byte(clientKeyPEM))
+	require.NoError(t, err)
+	conn, err := tls.Dial(networkTcp, "127.0.0.1:5516", &tls.Config{
+		Certificates:       []tls.Certificate{clientCert},
+		InsecureSkipVerify: true,
+	})
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("7 {\"a\":1}"))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	out := st.waitOut(t, 1)
+	require.JSONEq(t, `{"a":1,"remote_addr":"127.0.0.1","tls_client_cn":"client.example.com"}`, out[0])
+}
+
+// genCert generates the certificate signed by the parent or the self-signed CA if the parent is nil.
+func genCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return cert, key, string(certPEM), string(keyPEM)
+}
@@ -493,7 +493,7 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 		IsDeadQueueAvailable: p.router.IsDeadQueueAvailable(),
 	}
 
-	onError := func(err error, events []*pipeline.Event) {
+	onError := func(failure *pipeline.Failure) {
 		var level zapcore.Level
 		if p.config.FatalOnFailedInsert && !p.router.IsDeadQueueAvailable() {
 			level = zapcore.FatalLevel
@@ -501,13 +501,11 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 			level = zapcore.ErrorLevel
 		}
 
-		p.logger.Log(level, "can't insert to the table", zap.Error(err),
+		p.logger.Log(level, "can't insert to the table", zap.Error(failure.Err),
 			zap.Int("retries", p.config.Retry),
 			zap.String("table", p.config.Table))
 
-		for i := range events {
-			p.router.Fail(events[i])
-		}
+		p.router.FailBatch(failure)
 	}
 
 	p.batcher = pipeline.NewRetriableBatcher(
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -30,6 +31,8 @@ const (
 	outPluginType = "elasticsearch"
 
 	NDJSONContentType = "application/x-ndjson"
+
+	indexValueMetaPrefix = "@meta."
 )
 
 type Plugin struct {
@@ -116,7 +119,8 @@ type Config struct {
 	// >
 	// > A comma-separated list of event fields which will be used for replacement `index_format`.
 	// > There is a special field `@@time` which equals the current time. Use the `time_format` to define a time format.
-	// > E.g. `[service, @@time]`
+	// > The `@@meta.<key>` value is replaced with the value of the `<key>` of the event metadata.
+	// > E.g. `[service, @@meta.tenant, @@time]`
 	IndexValues []string `json:"index_values" default:"[@time]" slice:"true"` // *
 
 	// > @3@4@5@6
@@ -271,7 +275,7 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 		IsDeadQueueAvailable: p.router.IsDeadQueueAvailable(),
 	}
 
-	onError := func(err error, events []*pipeline.Event) {
+	onError := func(failure *pipeline.Failure) {
 		var level zapcore.Level
 		if p.config.FatalOnFailedInsert && !p.router.IsDeadQueueAvailable() {
 			level = zapcore.FatalLevel
@@ -279,13 +283,11 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 			level = zapcore.ErrorLevel
 		}
 
-		p.logger.Log(level, "can't send to the elastic", zap.Error(err),
+		p.logger.Log(level, "can't send to the elastic", zap.Error(failure.Err),
 			zap.Int("retries", p.config.Retry),
 		)
 
-		for i := range events {
-			p.router.Fail(events[i])
-		}
+		p.router.FailBatch(failure)
 	}
 
 	p.batcher = pipeline.NewRetriableBatcher(
@@ -501,6 +503,12 @@ func (p *Plugin) appendIndexName(outBuf []byte, event *pipeline.Event) []byte {
 
 		if value == "@time" {
 			outBuf = append(outBuf, p.time...)
+		} else if key, ok := strings.CutPrefix(value, indexValueMetaPrefix); ok {
+			value, _ := event.GetMeta(key)
+			if value == "" {
+				value = "not_set"
+			}
+			outBuf = append(outBuf, value...)
 		} else {
 			value := event.Root.Dig(value).AsString()
 			if value == "" {
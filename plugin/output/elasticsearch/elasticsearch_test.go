@@ -34,6 +34,29 @@ func TestAppendEvent(t *testing.T) {
 	assert.Equal(t, expected, string(result), "wrong request content")
 }
 
+func TestAppendEventWithMetaIndex(t *testing.T) {
+	p := &Plugin{}
+	config := &Config{
+		Endpoints:   []string{"test"},
+		IndexFormat: "test-%-%",
+		IndexValues: []string{"@meta.tenant", "@meta.absent"},
+		BatchSize:   "1",
+	}
+	test.NewConfig(config, map[string]int{"gomaxprocs": 1})
+
+	p.Start(config, test.NewEmptyOutputPluginParams())
+
+	root, _ := insaneJSON.DecodeBytes([]byte(`{"tenant":"field"}`))
+	defer insaneJSON.Release(root)
+
+	event := &pipeline.Event{Root: root}
+	event.SetMeta("tenant", "meta")
+	result := p.appendEvent(nil, event)
+
+	expected := fmt.Sprintf("%s\n%s\n", `{"index":{"_index":"test-meta-not_set"}}`, `{"tenant":"field"}`)
+	assert.Equal(t, expected, string(result), "wrong request content")
+}
+
 func TestAppendEventWithIndexOpType(t *testing.T) {
 	p := &Plugin{}
 	config := &Config{
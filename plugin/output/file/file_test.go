@@ -226,7 +226,7 @@ func TestStart(t *testing.T) {
 	p := newPipeline(t, config)
 	assert.NotNil(t, p, "could not create new pipeline")
 
-	p.Start()
+	require.NoError(t, p.Start())
 
 	// check log file created and empty
 	matches := test.GetMatches(t, logFilePattern)
@@ -277,7 +277,7 @@ func TestStart(t *testing.T) {
 	// Start new pipeline like pod restart
 	// start pipeline again
 	p2 := newPipeline(t, config)
-	p2.Start()
+	require.NoError(t, p2.Start())
 	// waite ticker 1st tick
 	time.Sleep(250 * time.Millisecond)
 	// check old file log file is sealed up
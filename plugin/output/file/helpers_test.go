@@ -9,6 +9,7 @@ import (
 	"github.com/ozontech/file.d/plugin/input/fake"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
@@ -63,7 +64,8 @@ func newPipeline(t *testing.T, configOutput *Config) *pipeline.Pipeline {
 		},
 	}
 
-	p := pipeline.New("test_pipeline", settings, prometheus.NewRegistry(), zap.NewNop())
+	p, err := pipeline.New("test_pipeline", settings, prometheus.NewRegistry(), zap.NewNop())
+	require.NoError(t, err)
 	p.DisableParallelism()
 	p.EnableEventLog()
 
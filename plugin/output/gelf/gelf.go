@@ -240,7 +240,7 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 		IsDeadQueueAvailable: p.router.IsDeadQueueAvailable(),
 	}
 
-	onError := func(err error, events []*pipeline.Event) {
+	onError := func(failure *pipeline.Failure) {
 		var level zapcore.Level
 		if p.config.FatalOnFailedInsert && !p.router.IsDeadQueueAvailable() {
 			level = zapcore.FatalLevel
@@ -248,13 +248,11 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 			level = zapcore.ErrorLevel
 		}
 
-		p.logger.Desugar().Log(level, "can't send to gelf", zap.Error(err),
+		p.logger.Desugar().Log(level, "can't send to gelf", zap.Error(failure.Err),
 			zap.Int("retries", p.config.Retry),
 		)
 
-		for i := range events {
-			p.router.Fail(events[i])
-		}
+		p.router.FailBatch(failure)
 	}
 
 	p.batcher = pipeline.NewRetriableBatcher(
@@ -243,7 +243,7 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 		IsDeadQueueAvailable: p.router.IsDeadQueueAvailable(),
 	}
 
-	onError := func(err error, events []*pipeline.Event) {
+	onError := func(failure *pipeline.Failure) {
 		var level zapcore.Level
 		if p.config.FatalOnFailedInsert && !p.router.IsDeadQueueAvailable() {
 			level = zapcore.FatalLevel
@@ -251,13 +251,11 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 			level = zapcore.ErrorLevel
 		}
 
-		p.logger.Log(level, "can't send to the http endpoint", zap.Error(err),
+		p.logger.Log(level, "can't send to the http endpoint", zap.Error(failure.Err),
 			zap.Int("retries", p.config.Retry),
 		)
 
-		for i := range events {
-			p.router.Fail(events[i])
-		}
+		p.router.FailBatch(failure)
 	}
 
 	p.batcher = pipeline.NewRetriableBatcher(
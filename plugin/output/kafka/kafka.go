@@ -72,6 +72,12 @@ type Config struct {
 	// > Which event field to use as topic name. It works only if `should_use_topic_field` is set.
 	TopicField string `json:"topic_field" default:"topic"` // *
 
+	// > @3@4@5@6
+	// >
+	// > List of the event metadata keys to send as the message headers.
+	// > The keys absent in the event metadata are skipped.
+	MetaHeaders []string `json:"meta_headers" slice:"true"` // *
+
 	// > @3@4@5@6
 	// >
 	// > How many workers will be instantiated to send batches.
@@ -273,7 +279,7 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 		IsDeadQueueAvailable: p.router.IsDeadQueueAvailable(),
 	}
 
-	onError := func(err error, events []*pipeline.Event) {
+	onError := func(failure *pipeline.Failure) {
 		var level zapcore.Level
 		if p.config.FatalOnFailedInsert && !p.router.IsDeadQueueAvailable() {
 			level = zapcore.FatalLevel
@@ -285,9 +291,7 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 			zap.Int("retries", p.config.Retry),
 		)
 
-		for i := range events {
-			p.router.Fail(events[i])
-		}
+		p.router.FailBatch(failure)
 	}
 
 	p.batcher = pipeline.NewRetriableBatcher(
@@ -346,6 +350,7 @@ func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) err
 		data.messages[i].Timestamp = time.Now()
 		data.messages[i].Value = outBuf[start:]
 		data.messages[i].Topic = topic
+		data.messages[i].Headers = p.appendMetaHeaders(data.messages[i].Headers[:0], event)
 		data.messages[i].Context = nil // cause we set context on produce batch
 		i++
 	})
@@ -359,6 +364,15 @@ func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) err
 	return nil
 }
 
+func (p *Plugin) appendMetaHeaders(headers []kgo.RecordHeader, event *pipeline.Event) []kgo.RecordHeader {
+	for _, key := range p.config.MetaHeaders {
+		if value, ok := event.GetMeta(key); ok {
+			headers = append(headers, kgo.RecordHeader{Key: key, Value: []byte(value)})
+		}
+	}
+	return headers
+}
+
 func (p *Plugin) Stop() {
 	p.batcher.Stop()
 	p.cancelFunc()
@@ -6,8 +6,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ozontech/file.d/cfg"
@@ -63,6 +66,17 @@ type Config struct {
 	// > label=value
 	Labels []Label `json:"labels" slice:"true"` // *
 
+	// > @3@4@5@6
+	// >
+	// > List of the event metadata keys to send as the stream labels along with the `labels`.
+	// > The events of the batch are grouped into the streams by the values of these labels.
+	// > The keys absent in the event metadata are skipped.
+	// >
+	// > Example meta labels
+	// >
+	// > [tenant, k8s_namespace]
+	MetaLabels []string `json:"meta_labels" slice:"true"` // *
+
 	// > @3@4@5@6
 	// >
 	// > Message field from log to be mapped to loki
@@ -280,7 +294,7 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 		IsDeadQueueAvailable: p.router.IsDeadQueueAvailable(),
 	}
 
-	onError := func(err error, events []*pipeline.Event) {
+	onError := func(failure *pipeline.Failure) {
 		var level zapcore.Level
 		if p.config.FatalOnFailedInsert && !p.router.IsDeadQueueAvailable() {
 			level = zapcore.FatalLevel
@@ -288,12 +302,10 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 			level = zapcore.ErrorLevel
 		}
 
-		p.logger.Log(level, "can't send data to loki", zap.Error(err),
+		p.logger.Log(level, "can't send data to loki", zap.Error(failure.Err),
 			zap.Int("retries", p.config.Retry))
 
-		for i := range events {
-			p.router.Fail(events[i])
-		}
+		p.router.FailBatch(failure)
 	}
 
 	p.batcher = pipeline.NewRetriableBatcher(
@@ -338,12 +350,20 @@ func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) err
 	root := insaneJSON.Spawn()
 	defer insaneJSON.Release(root)
 
+	var eventsLabels []map[string]string
+	if len(p.config.MetaLabels) > 0 {
+		eventsLabels = make([]map[string]string, 0, p.config.BatchSize_)
+	}
+
 	dataArr := root.AddFieldNoAlloc(root, "data").MutateToArray()
 	batch.ForEach(func(event *pipeline.Event) {
 		dataArr.AddElementNoAlloc(root).MutateToNode(event.Root.Node)
+		if eventsLabels != nil {
+			eventsLabels = append(eventsLabels, p.eventLabels(event))
+		}
 	})
 
-	code, err := p.send(root)
+	code, err := p.send(root, eventsLabels)
 	if err != nil {
 		p.sendErrorMetric.WithLabelValues(strconv.Itoa(code)).Inc()
 		p.logger.Error("can't send data to Loki", zap.String("address", p.config.Address), zap.Error(err))
@@ -368,11 +388,15 @@ type request struct {
 	Streams []stream `json:"streams"`
 }
 
-func (p *Plugin) send(root *insaneJSON.Root) (int, error) {
+// send sends the messages of the root, eventsLabels are the stream labels of the messages
+// if the labels are taken from the event metadata.
+func (p *Plugin) send(root *insaneJSON.Root, eventsLabels []map[string]string) (int, error) {
 	messages := root.Dig("data").AsArray()
 	values := make([][]any, 0, len(messages))
+	streams := make([]stream, 0, 1)
+	streamIndexes := make(map[string]int)
 
-	for _, msg := range messages {
+	for i, msg := range messages {
 		tsNode := msg.Dig(p.config.TimestampField)
 		ts := tsNode.AsString()
 		tsNode.Suicide()
@@ -393,16 +417,30 @@ func (p *Plugin) send(root *insaneJSON.Root) (int, error) {
 			json.RawMessage(msg.EncodeToString()),
 		}
 
-		values = append(values, logLine)
+		if eventsLabels == nil {
+			values = append(values, logLine)
+			continue
+		}
+
+		labels := eventsLabels[i]
+		key := labelsKey(labels)
+		index, ok := streamIndexes[key]
+		if !ok {
+			index = len(streams)
+			streamIndexes[key] = index
+			streams = append(streams, stream{StreamLabels: labels})
+		}
+		streams[index].Values = append(streams[index].Values, logLine)
 	}
 
+	if eventsLabels == nil {
+		streams = append(streams, stream{
+			StreamLabels: p.labels,
+			Values:       values,
+		})
+	}
 	output := request{
-		Streams: []stream{
-			{
-				StreamLabels: p.labels,
-				Values:       values,
-			},
-		},
+		Streams: streams,
 	}
 
 	data, err := json.Marshal(output)
@@ -459,6 +497,31 @@ func (p *Plugin) getCustomHeaders() map[string]string {
 	return headers
 }
 
+// eventLabels returns the static labels with the labels from the event metadata.
+func (p *Plugin) eventLabels(event *pipeline.Event) map[string]string {
+	labels := maps.Clone(p.labels)
+	for _, key := range p.config.MetaLabels {
+		if value, ok := event.GetMeta(key); ok {
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+// labelsKey returns the key of the stream with the labels.
+func labelsKey(labels map[string]string) string {
+	keys := slices.Sorted(maps.Keys(labels))
+
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(labels[k])
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
+
 func (p *Plugin) parseLabels() map[string]string {
 	labels := make(map[string]string, len(p.config.Labels))
 
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ozontech/file.d/pipeline"
 	"github.com/stretchr/testify/require"
 )
 
@@ -71,6 +72,25 @@ func TestPluginParseLabels(t *testing.T) {
 	}
 }
 
+func TestPluginEventLabels(t *testing.T) {
+	pl := &Plugin{
+		config: &Config{
+			Labels:     []Label{{Label: "env", Value: "prod"}},
+			MetaLabels: []string{"tenant", "absent"},
+		},
+	}
+	pl.labels = pl.parseLabels()
+
+	event := &pipeline.Event{}
+	event.SetMeta("tenant", "test")
+	event.SetMeta("other", "value")
+
+	labels := pl.eventLabels(event)
+	require.Equal(t, map[string]string{"env": "prod", "tenant": "test"}, labels)
+	require.Equal(t, map[string]string{"env": "prod"}, pl.labels, "static labels must not be changed")
+	require.Equal(t, "env=prod\x00tenant=test\x00", labelsKey(labels))
+}
+
 func TestPluginGetAuthHeaders(t *testing.T) {
 	type testCase struct {
 		name     string
@@ -0,0 +1,173 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	pipelineInput "github.com/ozontech/file.d/plugin/input/pipeline"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It passes events to another pipeline of the same `file.d` process which uses the [pipeline input](/plugin/input/pipeline/README.md).
+
+The event is committed only after the target pipeline has committed or discarded it,
+so the offsets of the input are saved only when the event has really been processed.
+If the target pipeline isn't started yet, the plugin waits for it.
+The events which aren't committed by the target pipeline before it's stopped, e.g. on the config reload, are sent again after its restart.
+
+If this pipeline is stopped while it waits for the target one, the events are passed to the dead queue if it's configured.
+Otherwise they aren't committed, so the input reads them again after the restart if it supports that.
+}*/
+
+const retryInterval = time.Second
+
+type Plugin struct {
+	config     *Config
+	controller pipeline.OutputPluginController
+	router     *pipeline.Router
+	logger     *zap.SugaredLogger
+
+	// sourceSeed distinguishes the sources of this pipeline from the sources of other ones in the target pipeline.
+	sourceSeed uint64
+	buffers    sync.Pool
+	shouldStop atomic.Bool
+
+	// released waits for the events which are sent again after the target pipeline is stopped,
+	// releaseMu makes the stop and the release of the events mutually exclusive.
+	released  sync.WaitGroup
+	releaseMu sync.Mutex
+
+	undeliveredEventsMetric *metric.Counter
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The name of the pipeline to pass events to. The pipeline must use the `pipeline` input.
+	Pipeline string `json:"pipeline" required:"true"` // *
+}
+
+// ValidatePipeline checks that the events aren't passed to the pipeline itself.
+func (c *Config) ValidatePipeline(pipelineName string) error {
+	if c.Pipeline == pipelineName {
+		return fmt.Errorf("pipeline %q can't pass events to itself", pipelineName)
+	}
+	return nil
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterOutput(&pipeline.PluginStaticInfo{
+		Type:    "pipeline",
+		Factory: Factory,
+	})
+}
+
+func Factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginParams) {
+	p.config = config.(*Config)
+	p.controller = params.Controller
+	p.router = params.Router
+	p.logger = params.Logger
+	p.undeliveredEventsMetric = params.MetricCtl.RegisterCounter(
+		"output_pipeline_undelivered_events_total",
+		"Total events which aren't passed to the target pipeline since this pipeline is stopped",
+	)
+
+	p.sourceSeed = xxhash.Sum64String(params.PipelineName)
+	p.buffers = sync.Pool{
+		New: func() any {
+			buf := make([]byte, 0, params.PipelineSettings.AvgEventSize)
+			return &buf
+		},
+	}
+}
+
+func (p *Plugin) Stop() {
+	p.releaseMu.Lock()
+	p.shouldStop.Store(true)
+	p.releaseMu.Unlock()
+
+	p.released.Wait()
+}
+
+func (p *Plugin) Out(event *pipeline.Event) {
+	input := p.getInput()
+	if input == nil {
+		p.undelivered(event)
+		return
+	}
+
+	buf := p.buffers.Get().(*[]byte)
+	*buf = event.Root.Encode((*buf)[:0])
+	*buf = append(*buf, '\n')
+
+	input.In(pipeline.SourceID(p.sourceSeed^uint64(event.SourceID)), event, *buf, p)
+
+	p.buffers.Put(buf)
+}
+
+// Commit is called by the target pipeline input after the event is committed.
+func (p *Plugin) Commit(event *pipeline.Event) {
+	p.controller.Commit(event)
+}
+
+// Release sends again the events which aren't committed by the stopped target pipeline,
+// they are sent after the target pipeline is restarted.
+func (p *Plugin) Release(events []*pipeline.Event) {
+	p.releaseMu.Lock()
+	defer p.releaseMu.Unlock()
+
+	if p.shouldStop.Load() {
+		for _, event := range events {
+			p.undelivered(event)
+		}
+		return
+	}
+
+	p.released.Add(1)
+	go func() {
+		defer p.released.Done()
+		for _, event := range events {
+			p.Out(event)
+		}
+	}()
+}
+
+// undelivered reports the event which can't be passed since this pipeline is stopped before the target one is started.
+// The event is passed to the dead queue if it's configured, otherwise it isn't committed.
+func (p *Plugin) undelivered(event *pipeline.Event) {
+	p.undeliveredEventsMetric.Inc()
+	if p.router != nil && p.router.IsDeadQueueAvailable() {
+		p.router.Fail(event)
+		return
+	}
+	p.logger.Errorf("event isn't passed to pipeline %q since the pipeline isn't started: %s", p.config.Pipeline, event.Root.EncodeToString())
+}
+
+// getInput waits for the target pipeline, it returns nil if the plugin is stopped.
+func (p *Plugin) getInput() *pipelineInput.Plugin {
+	for {
+		input := pipelineInput.Get(p.config.Pipeline)
+		if input != nil {
+			return input
+		}
+		if p.shouldStop.Load() {
+			return nil
+		}
+
+		p.logger.Warnf("pipeline %q isn't started or doesn't use pipeline input, waiting", p.config.Pipeline)
+		time.Sleep(retryInterval)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/ozontech/file.d/test"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
@@ -167,7 +168,7 @@ func TestStart(t *testing.T) {
 		}, nil
 	})
 	assert.NotNil(t, p, "could not create new pipeline")
-	p.Start()
+	require.NoError(t, p.Start())
 	time.Sleep(300 * time.Microsecond)
 
 	test.SendPack(t, p, tests.firstPack)
@@ -347,7 +348,7 @@ func TestStartWithMultiBuckets(t *testing.T) {
 		}, nil
 	})
 	assert.NotNil(t, p, "could not create new pipeline")
-	p.Start()
+	require.NoError(t, p.Start())
 	time.Sleep(300 * time.Microsecond)
 
 	test.SendPack(t, p, tests.firstPack)
@@ -406,7 +407,8 @@ func newPipeline(t *testing.T, configOutput *Config, objStoreF objStoreFactory)
 		},
 	}
 
-	p := pipeline.New("test_pipeline", settings, prometheus.NewRegistry(), zap.NewNop())
+	p, err := pipeline.New("test_pipeline", settings, prometheus.NewRegistry(), zap.NewNop())
+	require.NoError(t, err)
 	p.DisableParallelism()
 	p.EnableEventLog()
 
@@ -461,7 +463,7 @@ func TestStartPanic(t *testing.T) {
 
 	assert.NotNil(t, p, "could not create new pipeline")
 
-	assert.Panics(t, p.Start)
+	assert.Panics(t, func() { _ = p.Start() })
 }
 
 func TestStartWithSendProblems(t *testing.T) {
@@ -540,7 +542,7 @@ func TestStartWithSendProblems(t *testing.T) {
 
 	assert.NotNil(t, p, "could not create new pipeline")
 
-	p.Start()
+	require.NoError(t, p.Start())
 	time.Sleep(300 * time.Microsecond)
 	test.SendPack(t, p, tests.firstPack)
 	time.Sleep(writeFileSleep)
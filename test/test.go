@@ -64,7 +64,9 @@ func startCasePipeline(act func(pipeline *pipeline.Pipeline), out func(event *pi
 			out(event)
 		}
 	})
-	p.Start()
+	if err := p.Start(); err != nil {
+		panic(err)
+	}
 
 	act(p)
 
@@ -109,6 +111,11 @@ func NewPipeline(actions []*pipeline.ActionPluginStaticInfo, pipelineOpts ...str
 		eventTimeout = 10 * time.Millisecond
 	}
 
+	maintenanceInterval := time.Second * 5
+	if Opts(pipelineOpts).Has("short_maintenance_interval") {
+		maintenanceInterval = 50 * time.Millisecond
+	}
+
 	capacity := 256
 	if perf {
 		parallel = true
@@ -117,7 +124,7 @@ func NewPipeline(actions []*pipeline.ActionPluginStaticInfo, pipelineOpts ...str
 
 	settings := &pipeline.Settings{
 		Capacity:            capacity,
-		MaintenanceInterval: time.Second * 5,
+		MaintenanceInterval: maintenanceInterval,
 		EventTimeout:        eventTimeout,
 		Antispam: pipeline.AntispamSettings{
 			Threshold: pipeline.DefaultAntispamThreshold,
@@ -141,7 +148,10 @@ func NewPipeline(actions []*pipeline.ActionPluginStaticInfo, pipelineOpts ...str
 		pName += strconv.Itoa(rand.Int())
 	}
 
-	p := pipeline.New(pName, settings, prometheus.NewRegistry(), zap.NewNop())
+	p, err := pipeline.New(pName, settings, prometheus.NewRegistry(), zap.NewNop())
+	if err != nil {
+		panic(err)
+	}
 	if !parallel {
 		p.DisableParallelism()
 	}
@@ -179,7 +189,9 @@ func NewPipeline(actions []*pipeline.ActionPluginStaticInfo, pipelineOpts ...str
 	}
 
 	if !passive {
-		p.Start()
+		if err := p.Start(); err != nil {
+			panic(err)
+		}
 	}
 
 	return p
@@ -219,6 +231,13 @@ func NewEmptyOutputPluginParams() *pipeline.OutputPluginParams {
 	}
 }
 
+func NewEmptyInputPluginParams() *pipeline.InputPluginParams {
+	return &pipeline.InputPluginParams{
+		PluginDefaultParams: newDefaultParams(),
+		Logger:              newLogger().Named("input"),
+	}
+}
+
 func NewEmptyActionPluginParams() *pipeline.ActionPluginParams {
 	return &pipeline.ActionPluginParams{
 		PluginDefaultParams: newDefaultParams(),
@@ -89,7 +89,47 @@ func (b ConfigBuilder) AppendCARoot(caCert string) error {
 		}
 	}
 
-	b.cfg.RootCAs = x509.NewCertPool()
+	pool, err := parseCertPool(certContent)
+	if err != nil {
+		return err
+	}
+	b.cfg.RootCAs = pool
+
+	return nil
+}
+
+// AppendClientCA requires the clients to present the certificates signed by the CA.
+// If caCert is a path to a PEM encoded file, it reads and appends the content to the tls config.
+func (b ConfigBuilder) AppendClientCA(caCert string) error {
+	if caCert == "" {
+		return ErrEmptyCert
+	}
+
+	var (
+		certContent = []byte(caCert)
+		err         error
+	)
+	// is this path to the PEM encoded CA cert?
+	if !isPEM(certContent) {
+		certContent, err = b.readFile(caCert)
+		if err != nil {
+			return fmt.Errorf("can't read client CA cert file=%q: %w", caCert, err)
+		}
+	}
+
+	pool, err := parseCertPool(certContent)
+	if err != nil {
+		return err
+	}
+	b.cfg.ClientCAs = pool
+	b.cfg.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return nil
+}
+
+// parseCertPool parses all the certificates of the PEM encoded content.
+func parseCertPool(certContent []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
 
 	// certContent can contain many certificates, we have to parse them all
 	for len(certContent) > 0 {
@@ -104,13 +144,13 @@ func (b ConfigBuilder) AppendCARoot(caCert string) error {
 
 		cert, err := x509.ParseCertificate(block.Bytes)
 		if err != nil {
-			return fmt.Errorf("can't parse CA cert: %w", err)
+			return nil, fmt.Errorf("can't parse CA cert: %w", err)
 		}
 
-		b.cfg.RootCAs.AddCert(cert)
+		pool.AddCert(cert)
 	}
 
-	return nil
+	return pool, nil
 }
 
 func (b ConfigBuilder) SetSkipVerify(val bool) {